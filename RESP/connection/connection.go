@@ -1,6 +1,7 @@
 package connection
 
 import (
+	"goredis/interface/resp"
 	"goredis/lib/sync/wait"
 	"net"
 	"sync"
@@ -12,6 +13,12 @@ type Connection struct {
 	waitingReply wait.Wait  // wait for reply
 	mutex        sync.Mutex // mutex for connection
 	selectedDB   int        // selected database
+
+	// transaction state
+	multiState bool                       // whether the connection is inside MULTI
+	queue      [][][]byte                 // commands queued by MULTI
+	watching   map[resp.WatchedKey]uint32 // watched keys and their versions
+	txErrors   []error                    // errors found while queueing commands
 }
 
 // create a new connection instance
@@ -58,3 +65,51 @@ func (c *Connection) SelectDB(db int) error {
 	c.selectedDB = db
 	return nil
 }
+
+// whether the connection is inside a transaction
+func (c *Connection) InMultiState() bool {
+	return c.multiState
+}
+
+// enter or leave a transaction, leaving it drops the queued commands and watched keys
+func (c *Connection) SetMultiState(state bool) {
+	if !state {
+		c.watching = nil
+		c.queue = nil
+		c.txErrors = nil
+	}
+	c.multiState = state
+}
+
+// get the commands queued in the transaction
+func (c *Connection) GetQueuedCmdLine() [][][]byte {
+	return c.queue
+}
+
+// queue a command in the transaction
+func (c *Connection) EnqueueCmd(cmdLine [][]byte) {
+	c.queue = append(c.queue, cmdLine)
+}
+
+// drop the queued commands
+func (c *Connection) ClearQueuedCmds() {
+	c.queue = nil
+}
+
+// get the watched keys and their versions
+func (c *Connection) GetWatching() map[resp.WatchedKey]uint32 {
+	if c.watching == nil {
+		c.watching = make(map[resp.WatchedKey]uint32)
+	}
+	return c.watching
+}
+
+// record an error found while queueing a command
+func (c *Connection) AddTxError(err error) {
+	c.txErrors = append(c.txErrors, err)
+}
+
+// get the errors found while queueing commands
+func (c *Connection) GetTxErrors() []error {
+	return c.txErrors
+}
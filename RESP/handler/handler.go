@@ -7,6 +7,7 @@ import (
 	"goredis/config"
 	"goredis/database"
 	databaseinterface "goredis/interface/database"
+	"goredis/interface/resp"
 	"goredis/lib/logger"
 	"goredis/lib/sync/atomic"
 	"goredis/resp/connection"
@@ -55,12 +56,21 @@ func (h *RespHandler) Handle(ctx context.Context, conn net.Conn) {
 
 	ch := parser.ParseStream(conn)
 	fmt.Println("ch:", ch)
-	for payload := range ch { // read the payload from the channel
+	// pending keeps the commands received while the connection was blocked
+	var pending []*parser.Parser
+	for {
+		var payload *parser.Parser
+		if len(pending) > 0 {
+			payload, pending = pending[0], pending[1:]
+		} else {
+			var ok bool
+			if payload, ok = <-ch; !ok {
+				return
+			}
+		}
 		fmt.Println("在通道中读取到数据:", payload)
 		if payload.Err != nil {
-			if payload.Err == io.EOF ||
-				payload.Err == io.ErrUnexpectedEOF ||
-				strings.Contains(payload.Err.Error(), "use of closed network connection") {
+			if isClosedErr(payload.Err) {
 				h.closeClient(client)
 				logger.Info("Client disconnected")
 				return
@@ -87,6 +97,13 @@ func (h *RespHandler) Handle(ctx context.Context, conn net.Conn) {
 		}
 
 		result := h.db.Exec(client, r.Args)
+		if blocked, ok := result.(databaseinterface.BlockedReply); ok {
+			result, pending, ok = h.waitBlocked(client, blocked, ch, pending)
+			if !ok {
+				logger.Info("Client disconnected")
+				return
+			}
+		}
 
 		if result == nil {
 			_ = client.Write(unknownCommandError)
@@ -98,6 +115,37 @@ func (h *RespHandler) Handle(ctx context.Context, conn net.Conn) {
 	}
 }
 
+// isClosedErr reports whether the parser stopped because the connection was closed
+func isClosedErr(err error) bool {
+	return err == io.EOF ||
+		err == io.ErrUnexpectedEOF ||
+		strings.Contains(err.Error(), "use of closed network connection")
+}
+
+// waitBlocked parks the connection until the blocking command replies. Commands received meanwhile
+// are appended to pending, ok is false if the connection was closed while it was blocked.
+func (h *RespHandler) waitBlocked(client *connection.Connection, blocked databaseinterface.BlockedReply,
+	ch <-chan *parser.Parser, pending []*parser.Parser) (resp.Reply, []*parser.Parser, bool) {
+	done := make(chan resp.Reply, 1)
+	go func() {
+		done <- blocked.Wait()
+	}()
+	for {
+		select {
+		case result := <-done:
+			return result, pending, true
+		case payload, ok := <-ch:
+			if !ok || (payload.Err != nil && isClosedErr(payload.Err)) {
+				// AfterClientClose unblocks the waiter
+				h.closeClient(client)
+				<-done
+				return nil, pending, false
+			}
+			pending = append(pending, payload)
+		}
+	}
+}
+
 func (h *RespHandler) closeClient(client *connection.Connection) {
 	_ = client.Close()
 	h.db.AfterClientClose(client)
@@ -31,6 +31,26 @@ func MakeNullReply() *NullReply {
 	return &NullReply{}
 }
 
+// reply null multi bulk --> *-1
+type NullMultiBulkReply struct{}
+
+func (n *NullMultiBulkReply) ToBytes() []byte {
+	return []byte("*-1\r\n")
+}
+func MakeNullMultiBulkReply() *NullMultiBulkReply {
+	return &NullMultiBulkReply{}
+}
+
+// reply queued --> QUEUED
+type QueuedReply struct{}
+
+func (q *QueuedReply) ToBytes() []byte {
+	return []byte("+QUEUED\r\n")
+}
+func MakeQueuedReply() *QueuedReply {
+	return &QueuedReply{}
+}
+
 // reply empty bulk --> $0\r\n\r\n
 type EmptyBulkReply struct{}
 
@@ -67,3 +67,18 @@ func (e *ProtocolErrReply) ToBytes() []byte {
 func MakeProtocolErrReply() *ProtocolErrReply {
 	return &ProtocolErrReply{}
 }
+
+// error reply with a custom error code, e.g. EXECABORT
+type ErrReply struct {
+	Status string
+}
+
+func (e *ErrReply) Error() string {
+	return e.Status
+}
+func (e *ErrReply) ToBytes() []byte {
+	return []byte("-" + e.Status + "\r\n")
+}
+func MakeErrReply(status string) *ErrReply {
+	return &ErrReply{Status: status}
+}
@@ -51,6 +51,23 @@ func MakeMultiBulkReply(args [][]byte) *MultiBulkReply {
 	return &MultiBulkReply{Args: args}
 }
 
+// multi raw reply, an array whose elements can be any kind of reply
+type MultiRawReply struct {
+	Replies []resp.Reply
+}
+
+func (r *MultiRawReply) ToBytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("*" + strconv.Itoa(len(r.Replies)) + "\r\n")
+	for _, rep := range r.Replies {
+		buf.Write(rep.ToBytes())
+	}
+	return buf.Bytes()
+}
+func MakeMultiRawReply(replies []resp.Reply) *MultiRawReply {
+	return &MultiRawReply{Replies: replies}
+}
+
 // standard error reply
 type StandardErrorReply struct {
 	Err string
@@ -19,8 +19,8 @@ const aofBufferSize = 1 << 16
 type CmdLine = [][]byte // CmdLine represents a command line in Redis, which is an array of byte slices.
 
 type payload struct {
-	cmdLine CmdLine // The command line to be executed.
-	dbIndex int     // The index of the database to be used.
+	cmdLines []CmdLine // The command lines to be executed, they are written to the file as one unit.
+	dbIndex  int       // The index of the database to be used.
 }
 
 type AofHandler struct {
@@ -55,21 +55,23 @@ func NewAofHandler(db database.Database) (*AofHandler, error) {
 	return aofhandler, nil
 }
 
-// increase command and dbIndex to aofChan
-func (h *AofHandler) AddCommand(dbIndex int, cmdLine CmdLine) {
+// increase command and dbIndex to aofChan,
+// several command lines passed in one call are written to the file contiguously
+func (h *AofHandler) AddCommand(dbIndex int, cmdLines ...CmdLine) {
 	if h.aofChan == nil || !config.Properties.AppendOnly {
 		h.aofChan = make(chan *payload, 100)
 	}
 
 	h.aofChan <- &payload{
-		cmdLine: cmdLine,
-		dbIndex: dbIndex,
+		cmdLines: cmdLines,
+		dbIndex:  dbIndex,
 	}
 }
 
 // write aof file
 func (h *AofHandler) WriteAofFile() error {
-	h.currentDB = 0
+	// the file may end in any db after a previous run, so the first command always selects its db
+	h.currentDB = -1
 	for p := range h.aofChan { // read from aofChan
 		fmt.Println("select db: " + strconv.Itoa(p.dbIndex))
 		fmt.Println("current db: " + strconv.Itoa(h.currentDB))
@@ -82,7 +84,10 @@ func (h *AofHandler) WriteAofFile() error {
 				continue
 			}
 		}
-		data := reply.MakeMultiBulkReply(p.cmdLine).ToBytes()
+		data := make([]byte, 0)
+		for _, cmdLine := range p.cmdLines {
+			data = append(data, reply.MakeMultiBulkReply(cmdLine).ToBytes()...)
+		}
 		_, err := h.aofFile.Write(data)
 		if err != nil {
 			logger.Error("write aof file error: " + err.Error())
@@ -4,21 +4,53 @@ import (
 	"fmt"
 	"goredis/interface/resp"
 	"goredis/resp/reply"
+	"strconv"
 )
 
 func makeRouter() map[string]CmdFunc {
 	routerMap := make(map[string]CmdFunc)
 	routerMap["exists"] = defaultFunc
 	routerMap["type"] = defaultFunc
+	routerMap["object"] = objectFunc
+	routerMap["dump"] = defaultFunc
+	routerMap["restore"] = defaultFunc
 	routerMap["set"] = defaultFunc
 	routerMap["get"] = defaultFunc
 	routerMap["setnx"] = defaultFunc
 	routerMap["getset"] = defaultFunc
+	routerMap["strlen"] = defaultFunc
+	routerMap["incr"] = defaultFunc
+	routerMap["decr"] = defaultFunc
+	routerMap["incrby"] = defaultFunc
+	routerMap["decrby"] = defaultFunc
+	routerMap["incrbyfloat"] = defaultFunc
+	routerMap["append"] = defaultFunc
+	routerMap["getrange"] = defaultFunc
+	routerMap["setrange"] = defaultFunc
+	routerMap["getdel"] = defaultFunc
+	routerMap["getex"] = defaultFunc
+	routerMap["setbit"] = defaultFunc
+	routerMap["getbit"] = defaultFunc
+	routerMap["bitcount"] = defaultFunc
+	routerMap["bitpos"] = defaultFunc
+	routerMap["bitfield"] = defaultFunc
+	routerMap["pfadd"] = defaultFunc
+
+	routerMap["expire"] = defaultFunc
+	routerMap["pexpire"] = defaultFunc
+	routerMap["expireat"] = defaultFunc
+	routerMap["pexpireat"] = defaultFunc
+	routerMap["ttl"] = defaultFunc
+	routerMap["pttl"] = defaultFunc
+	routerMap["persist"] = defaultFunc
 
 	routerMap["ping"] = pingFunc
 	routerMap["rename"] = renameFunc
 	routerMap["renamex"] = renameFunc
 	routerMap["flushdb"] = flushDBFunc
+	routerMap["flushall"] = flushDBFunc
+	routerMap["move"] = defaultFunc
+	routerMap["copy"] = copyFunc
 	routerMap["del"] = delFunc
 	routerMap["select"] = selectFunc
 
@@ -30,6 +62,15 @@ func makeRouter() map[string]CmdFunc {
 	routerMap["llen"] = defaultFunc
 	routerMap["lindex"] = defaultFunc
 	routerMap["lset"] = defaultFunc
+	routerMap["lpushx"] = defaultFunc
+	routerMap["rpushx"] = defaultFunc
+	routerMap["linsert"] = defaultFunc
+	routerMap["lrem"] = defaultFunc
+	routerMap["ltrim"] = defaultFunc
+	routerMap["lpos"] = defaultFunc
+	routerMap["lmove"] = moveFunc
+	routerMap["rpoplpush"] = moveFunc
+	routerMap["lmpop"] = mpopFunc
 
 	routerMap["hset"] = defaultFunc
 	routerMap["hsetnx"] = defaultFunc
@@ -43,15 +84,32 @@ func makeRouter() map[string]CmdFunc {
 	routerMap["hmget"] = defaultFunc
 	routerMap["hmset"] = defaultFunc
 	routerMap["hrandfield"] = defaultFunc
+	routerMap["hincrby"] = defaultFunc
+	routerMap["hincrbyfloat"] = defaultFunc
+	routerMap["hstrlen"] = defaultFunc
+	routerMap["hexpire"] = defaultFunc
+	routerMap["hpexpire"] = defaultFunc
+	routerMap["hexpireat"] = defaultFunc
+	routerMap["hpexpireat"] = defaultFunc
+	routerMap["httl"] = defaultFunc
+	routerMap["hpttl"] = defaultFunc
+	routerMap["hexpiretime"] = defaultFunc
+	routerMap["hpexpiretime"] = defaultFunc
+	routerMap["hpersist"] = defaultFunc
 	routerMap["hencoding"] = defaultFunc
+	routerMap["hscan"] = defaultFunc
 
 	routerMap["sadd"] = defaultFunc        // sadd key member [member ...]
 	routerMap["scard"] = defaultFunc       // scard key
 	routerMap["sismember"] = defaultFunc   // sismember key member
+	routerMap["smismember"] = defaultFunc  // smismember key member [member ...]
 	routerMap["smembers"] = defaultFunc    // smembers key
 	routerMap["srem"] = defaultFunc        // srem key member [member ...]
 	routerMap["spop"] = defaultFunc        // spop key [count]
 	routerMap["srandmember"] = defaultFunc // srandmember key [count]
+	routerMap["sscan"] = defaultFunc       // sscan key cursor [MATCH pattern] [COUNT count]
+	routerMap["smove"] = moveFunc          // smove source destination member
+	routerMap["sintercard"] = mpopFunc     // sintercard numkeys key [key ...] [LIMIT limit]
 	return routerMap
 }
 
@@ -64,6 +122,15 @@ func defaultFunc(cluster *ClusterDatabase, conn resp.Connection, args [][]byte)
 	return cluster.relayExec(peer, conn, args)
 }
 
+// OBJECT 命令的处理函数，键是子命令之后的参数
+func objectFunc(cluster *ClusterDatabase, conn resp.Connection, args [][]byte) resp.Reply {
+	if len(args) < 3 {
+		return cluster.db.Exec(conn, args)
+	}
+	peer := cluster.peerPicker.GetNode(string(args[2]))
+	return cluster.relayExec(peer, conn, args)
+}
+
 // PING 命令的处理函数
 func pingFunc(cluster *ClusterDatabase, conn resp.Connection, args [][]byte) resp.Reply {
 	return cluster.db.Exec(conn, args)
@@ -91,6 +158,48 @@ func renameFunc(cluster *ClusterDatabase, conn resp.Connection, args [][]byte) r
 	return cluster.relayExec(srcPeer, conn, args)
 }
 
+// copy 复制键的处理函数，源键和目标键必须在同一个节点
+func copyFunc(cluster *ClusterDatabase, conn resp.Connection, args [][]byte) resp.Reply {
+	if len(args) < 3 {
+		return reply.MakeArgNumErrReply("copy")
+	}
+	srcPeer := cluster.peerPicker.GetNode(string(args[1]))
+	destPeer := cluster.peerPicker.GetNode(string(args[2]))
+	if srcPeer != destPeer {
+		return reply.MakeStandardErrorReply("ERR source and destination keys are on different nodes")
+	}
+	return cluster.relayExec(srcPeer, conn, args)
+}
+
+// moveFunc LMOVE、RPOPLPUSH 和 SMOVE 的处理函数，源键和目标键必须在同一个节点
+func moveFunc(cluster *ClusterDatabase, conn resp.Connection, args [][]byte) resp.Reply {
+	if len(args) < 3 {
+		return reply.MakeArgNumErrReply(string(args[0]))
+	}
+	srcPeer := cluster.peerPicker.GetNode(string(args[1]))
+	destPeer := cluster.peerPicker.GetNode(string(args[2]))
+	if srcPeer != destPeer {
+		return reply.MakeStandardErrorReply("ERR source and destination keys are on different nodes")
+	}
+	return cluster.relayExec(srcPeer, conn, args)
+}
+
+// mpopFunc LMPOP 和 SINTERCARD 的处理函数，键在 numkeys 之后，所有键必须在同一个节点
+func mpopFunc(cluster *ClusterDatabase, conn resp.Connection, args [][]byte) resp.Reply {
+	numKeys, err := strconv.Atoi(string(args[1]))
+	if err != nil || numKeys <= 0 || numKeys+2 > len(args) {
+		// 参数错误由本地数据库返回
+		return cluster.db.Exec(conn, args)
+	}
+	peer := cluster.peerPicker.GetNode(string(args[2]))
+	for _, key := range args[3 : numKeys+2] {
+		if cluster.peerPicker.GetNode(string(key)) != peer {
+			return reply.MakeStandardErrorReply("ERR keys are on different nodes")
+		}
+	}
+	return cluster.relayExec(peer, conn, args)
+}
+
 // flushallFunc 清空数据库的处理函数
 func flushDBFunc(cluster *ClusterDatabase, conn resp.Connection, args [][]byte) resp.Reply {
 	// 广播执行命令到所有节点
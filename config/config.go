@@ -24,6 +24,17 @@ type ServerProperties struct {
 	Requirepass    string   `cfg:"requirepass"`     // password
 	Peers          []string `cfg:"peers"`           // cluster nodes
 	Self           string   `cfg:"self"`            // self node
+
+	MaxMemory        int64  `cfg:"maxmemory"`         // memory limit in bytes, 0 means no limit
+	MaxMemoryPolicy  string `cfg:"maxmemory-policy"`  // how keys are evicted when maxmemory is reached
+	MaxMemorySamples int    `cfg:"maxmemory-samples"` // number of keys sampled to choose a key to evict
+
+	ListMaxListpackSize    int `cfg:"list-max-listpack-size"`    // size limit of a list node, > 0 elements, < 0 -1..-5 for 4kb..64kb
+	HashMaxListpackEntries int `cfg:"hash-max-listpack-entries"` // a hash with more fields is converted to a hash table
+	ZSetMaxListpackEntries int `cfg:"zset-max-listpack-entries"` // a sorted set with more members is converted to a skiplist
+	SetMaxIntsetEntries    int `cfg:"set-max-intset-entries"`    // a set of integers with more members is converted to a hash table
+	SetMaxListpackEntries  int `cfg:"set-max-listpack-entries"`  // a set with more members is converted to a hash table
+	SetMaxListpackValue    int `cfg:"set-max-listpack-value"`    // a set with a longer member is converted to a hash table
 }
 
 var Properties *ServerProperties
@@ -81,6 +92,11 @@ func parse(src io.Reader) *ServerProperties {
 				if err == nil {
 					fieldVal.SetInt(intValue)
 				}
+			case reflect.Int64:
+				bytesValue, err := parseBytes(value)
+				if err == nil {
+					fieldVal.SetInt(bytesValue)
+				}
 			case reflect.Bool:
 				boolValue := "yes" == value
 				fieldVal.SetBool(boolValue)
@@ -95,6 +111,33 @@ func parse(src io.Reader) *ServerProperties {
 	return config
 }
 
+// parseBytes parses a memory size such as 1024, 100mb or 1g,
+// k/m/g are powers of 1000 and kb/mb/gb are powers of 1024 like in redis.conf
+func parseBytes(value string) (int64, error) {
+	value = strings.ToLower(value)
+	units := []struct {
+		suffix string
+		factor int64
+	}{
+		{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+		{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+		{"b", 1},
+	}
+	factor := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSuffix(value, unit.suffix)
+			factor = unit.factor
+			break
+		}
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * factor, nil
+}
+
 func SetupConfig(configFilename string) {
 	file, err := os.Open(configFilename) // open the configuration file
 	if err != nil {
@@ -0,0 +1,551 @@
+package database
+
+import (
+	"goredis/interface/database"
+	"goredis/interface/resp"
+	"goredis/lib/utils"
+	"goredis/resp/reply"
+	"math"
+	"math/bits"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Bitmaps are plain string values, bit 0 is the most significant bit of the first byte.
+
+// maxBitOffset is the largest bit offset of a string of maxStringSize bytes
+const maxBitOffset = maxStringSize*8 - 1
+
+func init() {
+	RegisterCommand("SETBIT", execSetBit, writeFirstKey, 4)
+	RegisterCommand("GETBIT", execGetBit, readFirstKey, 3)
+	RegisterCommand("BITCOUNT", execBitCount, readFirstKey, -2)
+	RegisterCommand("BITPOS", execBitPos, readFirstKey, -3)
+	RegisterCommand("BITOP", execBitOp, prepareBitOp, -4)
+	RegisterCommand("BITFIELD", execBitField, writeFirstKey, -2)
+}
+
+// prepareBitOp writes the destination given after the operation and reads the source keys
+func prepareBitOp(args [][]byte) ([]string, []string) {
+	return []string{string(args[1])}, toKeys(args[2:])
+}
+
+// parseBitOffset parses a bit offset, with hashPrefix an offset "#n" is n times width
+func parseBitOffset(arg []byte, hashPrefix bool, width int64) (int64, reply.ErrorReply) {
+	s := string(arg)
+	multiply := hashPrefix && strings.HasPrefix(s, "#")
+	if multiply {
+		s = s[1:]
+	}
+	offset, err := strconv.ParseInt(s, 10, 64)
+	if err == nil && multiply {
+		if offset > maxBitOffset/width {
+			offset = -1
+		} else {
+			offset *= width
+		}
+	}
+	if err != nil || offset < 0 || offset > maxBitOffset {
+		return 0, reply.MakeStandardErrorReply("bit offset is not an integer or out of range")
+	}
+	return offset, nil
+}
+
+func getBit(value []byte, offset int64) int {
+	index := offset / 8
+	if index >= int64(len(value)) {
+		return 0
+	}
+	return int(value[index]>>(7-uint(offset%8))) & 1
+}
+
+func setBit(value []byte, offset int64, bit int) {
+	mask := byte(1) << (7 - uint(offset%8))
+	if bit == 1 {
+		value[offset/8] |= mask
+	} else {
+		value[offset/8] &^= mask
+	}
+}
+
+// growString pads value with zero bytes to at least size bytes,
+// the value is only reallocated if its capacity is too small
+func growString(value []byte, size int64) []byte {
+	n := len(value)
+	if int64(n) >= size {
+		return value
+	}
+	value = slices.Grow(value, int(size)-n)[:size]
+	clear(value[n:])
+	return value
+}
+
+// setbit: SETBIT key offset value, returns the previous bit
+func execSetBit(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	offset, errReply := parseBitOffset(args[1], false, 1)
+	if errReply != nil {
+		return errReply
+	}
+	bit := string(args[2])
+	if bit != "0" && bit != "1" {
+		return reply.MakeStandardErrorReply("bit is not an integer or out of range")
+	}
+	old, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	value := growString(old, offset/8+1)
+	previous := getBit(value, offset)
+	setBit(value, offset, int(bit[0]-'0'))
+	db.PutEntity(key, &database.DataEntity{Data: value})
+	db.addAof(utils.ToCmdLineWithName("SETBIT", args...))
+	return reply.MakeIntegerReply(int64(previous))
+}
+
+// getbit: GETBIT key offset
+func execGetBit(db *DB, args [][]byte) resp.Reply {
+	offset, errReply := parseBitOffset(args[1], false, 1)
+	if errReply != nil {
+		return errReply
+	}
+	value, errReply := db.getAsString(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	return reply.MakeIntegerReply(int64(getBit(value, offset)))
+}
+
+// parseBitRange parses the optional start end [BYTE|BIT] arguments of BITCOUNT and BITPOS
+// and converts them to a range of bits of the value, ok is false if the range is empty
+func parseBitRange(args [][]byte, size int64) (startBit int64, endBit int64, ok bool, errReply reply.ErrorReply) {
+	if len(args) == 0 {
+		return 0, size*8 - 1, size > 0, nil
+	}
+	if len(args) > 3 {
+		return 0, 0, false, reply.MakeSyntaxErrReply()
+	}
+	start, err := strconv.ParseInt(string(args[0]), 10, 64)
+	if err != nil {
+		return 0, 0, false, reply.MakeStandardErrorReply("value is not an integer or out of range")
+	}
+	end := int64(math.MaxInt64)
+	if len(args) > 1 {
+		if end, err = strconv.ParseInt(string(args[1]), 10, 64); err != nil {
+			return 0, 0, false, reply.MakeStandardErrorReply("value is not an integer or out of range")
+		}
+	}
+	unit := int64(8)
+	if len(args) == 3 {
+		switch strings.ToUpper(string(args[2])) {
+		case "BYTE":
+		case "BIT":
+			unit = 1
+		default:
+			return 0, 0, false, reply.MakeSyntaxErrReply()
+		}
+	}
+
+	total := size * 8 / unit
+	if start < 0 {
+		start += total
+	}
+	if end < 0 {
+		end += total
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= total {
+		end = total - 1
+	}
+	if start > end {
+		return 0, 0, false, nil
+	}
+	return start * unit, end*unit + unit - 1, true, nil
+}
+
+// countBits counts the bits set in the range [startBit, endBit]
+func countBits(value []byte, startBit int64, endBit int64) int64 {
+	var count int64
+	for i := startBit; i <= endBit; {
+		if i%8 == 0 && i+7 <= endBit {
+			count += int64(bits.OnesCount8(value[i/8]))
+			i += 8
+			continue
+		}
+		count += int64(getBit(value, i))
+		i++
+	}
+	return count
+}
+
+// bitcount: BITCOUNT key [start end [BYTE|BIT]]
+func execBitCount(db *DB, args [][]byte) resp.Reply {
+	if len(args) == 2 {
+		return reply.MakeSyntaxErrReply()
+	}
+	value, errReply := db.getAsString(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	startBit, endBit, ok, errReply := parseBitRange(args[1:], int64(len(value)))
+	if errReply != nil {
+		return errReply
+	}
+	if !ok {
+		return reply.MakeIntegerReply(0)
+	}
+	return reply.MakeIntegerReply(countBits(value, startBit, endBit))
+}
+
+// findBit returns the position of the first bit in the range [startBit, endBit], or -1
+func findBit(value []byte, bit int, startBit int64, endBit int64) int64 {
+	skip := byte(0)
+	if bit == 0 {
+		skip = 0xff
+	}
+	for i := startBit; i <= endBit; {
+		if i%8 == 0 && i+7 <= endBit && value[i/8] == skip {
+			i += 8
+			continue
+		}
+		if getBit(value, i) == bit {
+			return i
+		}
+		i++
+	}
+	return -1
+}
+
+// bitpos: BITPOS key bit [start [end [BYTE|BIT]]]
+func execBitPos(db *DB, args [][]byte) resp.Reply {
+	bitArg := string(args[1])
+	if bitArg != "0" && bitArg != "1" {
+		return reply.MakeStandardErrorReply("The bit argument must be 1 or 0.")
+	}
+	bit := int(bitArg[0] - '0')
+	value, errReply := db.getAsString(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	startBit, endBit, ok, errReply := parseBitRange(args[2:], int64(len(value)))
+	if errReply != nil {
+		return errReply
+	}
+	if value == nil {
+		// a missing key is an endless string of zero bits
+		if bit == 1 {
+			return reply.MakeIntegerReply(-1)
+		}
+		return reply.MakeIntegerReply(0)
+	}
+	if !ok {
+		return reply.MakeIntegerReply(-1)
+	}
+	pos := findBit(value, bit, startBit, endBit)
+	if pos < 0 && bit == 0 && len(args) < 4 {
+		// without an end the string is considered padded with zero bits on the right
+		pos = endBit + 1
+	}
+	return reply.MakeIntegerReply(pos)
+}
+
+// bitop: BITOP AND|OR|XOR|NOT destkey key [key ...]
+func execBitOp(db *DB, args [][]byte) resp.Reply {
+	op := strings.ToUpper(string(args[0]))
+	if op != "AND" && op != "OR" && op != "XOR" && op != "NOT" {
+		return reply.MakeSyntaxErrReply()
+	}
+	if op == "NOT" && len(args) != 3 {
+		return reply.MakeStandardErrorReply("BITOP NOT must be called with a single source key.")
+	}
+	destKey := string(args[1])
+	sources := make([][]byte, 0, len(args)-2)
+	maxLen := 0
+	for _, arg := range args[2:] {
+		value, errReply := db.getAsString(string(arg))
+		if errReply != nil {
+			return errReply
+		}
+		sources = append(sources, value)
+		if len(value) > maxLen {
+			maxLen = len(value)
+		}
+	}
+
+	if maxLen == 0 {
+		db.Remove(destKey)
+		db.addAof(utils.ToCmdLine("DEL", destKey))
+		return reply.MakeIntegerReply(0)
+	}
+	// missing keys and the bytes after the end of shorter strings are zero
+	result := make([]byte, maxLen)
+	for i := range result {
+		var b byte
+		if i < len(sources[0]) {
+			b = sources[0][i]
+		}
+		for _, src := range sources[1:] {
+			var other byte
+			if i < len(src) {
+				other = src[i]
+			}
+			switch op {
+			case "AND":
+				b &= other
+			case "OR":
+				b |= other
+			case "XOR":
+				b ^= other
+			}
+		}
+		if op == "NOT" {
+			b = ^b
+		}
+		result[i] = b
+	}
+	db.PutEntity(destKey, &database.DataEntity{Data: result})
+	db.Persist(destKey)
+	db.addAof(utils.ToCmdLineWithName("BITOP", args...))
+	return reply.MakeIntegerReply(int64(maxLen))
+}
+
+// overflow behaviours of BITFIELD
+const (
+	overflowWrap = iota
+	overflowSat
+	overflowFail
+)
+
+// bitFieldOp is a GET, SET or INCRBY subcommand of BITFIELD
+type bitFieldOp struct {
+	name     string
+	signed   bool
+	width    int64
+	offset   int64
+	value    int64 // the value of SET or the increment of INCRBY
+	overflow int
+}
+
+// parseBitFieldType parses a type like i16 or u8
+func parseBitFieldType(arg []byte) (bool, int64, reply.ErrorReply) {
+	s := strings.ToLower(string(arg))
+	errReply := reply.MakeStandardErrorReply("Invalid bitfield type. Use something like i16 u8. " +
+		"Note that u64 is not supported but i64 is.")
+	if len(s) < 2 || (s[0] != 'i' && s[0] != 'u') {
+		return false, 0, errReply
+	}
+	width, err := strconv.ParseInt(s[1:], 10, 64)
+	signed := s[0] == 'i'
+	if err != nil || width < 1 || (signed && width > 64) || (!signed && width > 63) {
+		return false, 0, errReply
+	}
+	return signed, width, nil
+}
+
+// parseBitFieldOps parses the subcommands of BITFIELD
+func parseBitFieldOps(args [][]byte) ([]*bitFieldOp, reply.ErrorReply) {
+	ops := make([]*bitFieldOp, 0)
+	overflow := overflowWrap
+	for i := 0; i < len(args); i++ {
+		name := strings.ToUpper(string(args[i]))
+		if name == "OVERFLOW" {
+			if i+1 >= len(args) {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			switch strings.ToUpper(string(args[i+1])) {
+			case "WRAP":
+				overflow = overflowWrap
+			case "SAT":
+				overflow = overflowSat
+			case "FAIL":
+				overflow = overflowFail
+			default:
+				return nil, reply.MakeStandardErrorReply("Invalid OVERFLOW type specified")
+			}
+			i++
+			continue
+		}
+		argCount := 2
+		if name == "SET" || name == "INCRBY" {
+			argCount = 3
+		} else if name != "GET" {
+			return nil, reply.MakeSyntaxErrReply()
+		}
+		if i+argCount >= len(args) {
+			return nil, reply.MakeSyntaxErrReply()
+		}
+		signed, width, errReply := parseBitFieldType(args[i+1])
+		if errReply != nil {
+			return nil, errReply
+		}
+		offset, errReply := parseBitOffset(args[i+2], true, width)
+		if errReply != nil {
+			return nil, errReply
+		}
+		op := &bitFieldOp{name: name, signed: signed, width: width, offset: offset, overflow: overflow}
+		if argCount == 3 {
+			value, err := strconv.ParseInt(string(args[i+3]), 10, 64)
+			if err != nil {
+				return nil, reply.MakeStandardErrorReply("value is not an integer or out of range")
+			}
+			op.value = value
+		}
+		ops = append(ops, op)
+		i += argCount
+	}
+	return ops, nil
+}
+
+// getBits reads width bits from offset as an unsigned integer
+func getBits(value []byte, offset int64, width int64) uint64 {
+	var n uint64
+	for i := int64(0); i < width; i++ {
+		n = n<<1 | uint64(getBit(value, offset+i))
+	}
+	return n
+}
+
+// setBits writes the lowest width bits of n at offset
+func setBits(value []byte, offset int64, width int64, n uint64) {
+	for i := int64(0); i < width; i++ {
+		setBit(value, offset+i, int(n>>uint(width-1-i))&1)
+	}
+}
+
+// signExtend converts the lowest width bits of n to a signed integer
+func signExtend(n uint64, width int64) int64 {
+	if width < 64 && n&(1<<uint(width-1)) != 0 {
+		n |= math.MaxUint64 << uint(width)
+	}
+	return int64(n)
+}
+
+// wrapBits truncates n to width bits, signed fields keep the sign of the truncated value
+func wrapBits(n uint64, width int64, signed bool) uint64 {
+	if width == 64 {
+		return n
+	}
+	n &= 1<<uint(width) - 1
+	if signed {
+		return uint64(signExtend(n, width))
+	}
+	return n
+}
+
+// checkSignedOverflow checks value+incr against the range of a signed field of width bits,
+// it returns whether it overflows and the value to store with WRAP or SAT
+func checkSignedOverflow(value int64, incr int64, width int64, overflow int) (bool, int64) {
+	max := int64(math.MaxInt64)
+	if width < 64 {
+		max = 1<<uint(width-1) - 1
+	}
+	min := -max - 1
+	maxIncr, minIncr := max-value, min-value
+	if value > max || (width != 64 && incr > maxIncr) || (value >= 0 && incr > 0 && incr > maxIncr) {
+		if overflow == overflowSat {
+			return true, max
+		}
+		return true, int64(wrapBits(uint64(value)+uint64(incr), width, true))
+	}
+	if value < min || (width != 64 && incr < minIncr) || (value < 0 && incr < 0 && incr < minIncr) {
+		if overflow == overflowSat {
+			return true, min
+		}
+		return true, int64(wrapBits(uint64(value)+uint64(incr), width, true))
+	}
+	return false, value + incr
+}
+
+// checkUnsignedOverflow is checkSignedOverflow for an unsigned field
+func checkUnsignedOverflow(value uint64, incr int64, width int64, overflow int) (bool, uint64) {
+	max := uint64(1)<<uint(width) - 1
+	maxIncr, minIncr := int64(max-value), -int64(value)
+	if value > max || (incr > 0 && incr > maxIncr) {
+		if overflow == overflowSat {
+			return true, max
+		}
+		return true, wrapBits(value+uint64(incr), width, false)
+	}
+	if incr < 0 && incr < minIncr {
+		if overflow == overflowSat {
+			return true, 0
+		}
+		return true, wrapBits(value+uint64(incr), width, false)
+	}
+	return false, value + uint64(incr)
+}
+
+// bitfield: BITFIELD key [GET type offset] [SET type offset value] [INCRBY type offset increment] [OVERFLOW WRAP|SAT|FAIL]
+func execBitField(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	ops, errReply := parseBitFieldOps(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	old, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	value := old
+	changed := false
+	// the value is modified in place, the entity is stored again at the end in case it was reallocated
+	results := make([]resp.Reply, 0, len(ops))
+	for _, op := range ops {
+		if op.name == "GET" {
+			n := getBits(value, op.offset, op.width)
+			if op.signed {
+				results = append(results, reply.MakeIntegerReply(signExtend(n, op.width)))
+			} else {
+				results = append(results, reply.MakeIntegerReply(int64(n)))
+			}
+			continue
+		}
+
+		var overflowed bool
+		var newValue uint64
+		var result int64
+		if op.signed {
+			current := signExtend(getBits(value, op.offset, op.width), op.width)
+			var stored int64
+			if op.name == "INCRBY" {
+				overflowed, stored = checkSignedOverflow(current, op.value, op.width, op.overflow)
+				result = stored
+			} else {
+				overflowed, stored = checkSignedOverflow(op.value, 0, op.width, op.overflow)
+				result = current
+			}
+			newValue = uint64(stored)
+		} else {
+			current := getBits(value, op.offset, op.width)
+			if op.name == "INCRBY" {
+				overflowed, newValue = checkUnsignedOverflow(current, op.value, op.width, op.overflow)
+				result = int64(newValue)
+			} else {
+				overflowed, newValue = checkUnsignedOverflow(uint64(op.value), 0, op.width, op.overflow)
+				result = int64(current)
+			}
+		}
+		if overflowed && op.overflow == overflowFail {
+			results = append(results, reply.MakeNullReply())
+			continue
+		}
+		changed = true
+		value = growString(value, (op.offset+op.width-1)/8+1)
+		setBits(value, op.offset, op.width, newValue)
+		results = append(results, reply.MakeIntegerReply(result))
+	}
+
+	if changed {
+		db.PutEntity(key, &database.DataEntity{Data: value})
+		db.addAof(utils.ToCmdLineWithName("BITFIELD", args...))
+	}
+	return reply.MakeMultiRawReply(results)
+}
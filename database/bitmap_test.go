@@ -0,0 +1,134 @@
+package database
+
+import (
+	"bytes"
+	"goredis/resp/connection"
+	"math"
+	"testing"
+)
+
+func TestCheckSignedOverflow(t *testing.T) {
+	tests := []struct {
+		value, incr int64
+		width       int64
+		overflows   bool
+		wrap, sat   int64
+	}{
+		{value: 100, incr: 27, width: 8, wrap: 127, sat: 127},
+		{value: 100, incr: 28, width: 8, overflows: true, wrap: -128, sat: 127},
+		{value: -100, incr: -28, width: 8, wrap: -128, sat: -128},
+		{value: -100, incr: -29, width: 8, overflows: true, wrap: 127, sat: -128},
+		{value: 0, incr: 300, width: 8, overflows: true, wrap: 44, sat: 127},
+		{value: 0, incr: -300, width: 8, overflows: true, wrap: -44, sat: -128},
+		{value: 5, incr: -3, width: 8, wrap: 2, sat: 2},
+		{value: 0, incr: 1, width: 1, overflows: true, wrap: -1, sat: 0},
+		{value: -1, incr: 1, width: 1, wrap: 0, sat: 0},
+		{value: math.MaxInt64, incr: 1, width: 64, overflows: true, wrap: math.MinInt64, sat: math.MaxInt64},
+		{value: math.MinInt64, incr: -1, width: 64, overflows: true, wrap: math.MaxInt64, sat: math.MinInt64},
+		{value: -1, incr: math.MaxInt64, width: 64, wrap: math.MaxInt64 - 1, sat: math.MaxInt64 - 1},
+		{value: 1, incr: math.MinInt64, width: 64, wrap: math.MinInt64 + 1, sat: math.MinInt64 + 1},
+	}
+	for _, tt := range tests {
+		for _, mode := range []int{overflowWrap, overflowSat, overflowFail} {
+			overflows, got := checkSignedOverflow(tt.value, tt.incr, tt.width, mode)
+			if overflows != tt.overflows {
+				t.Errorf("i%d %d%+d: overflow = %v, want %v", tt.width, tt.value, tt.incr, overflows, tt.overflows)
+			}
+			want := tt.wrap
+			if mode == overflowSat {
+				want = tt.sat
+			}
+			if mode != overflowFail && got != want {
+				t.Errorf("i%d %d%+d mode %d: got %d, want %d", tt.width, tt.value, tt.incr, mode, got, want)
+			}
+		}
+	}
+}
+
+func TestCheckUnsignedOverflow(t *testing.T) {
+	const u63Max = uint64(math.MaxInt64)
+	tests := []struct {
+		value     uint64
+		incr      int64
+		width     int64
+		overflows bool
+		wrap, sat uint64
+	}{
+		{value: 250, incr: 5, width: 8, wrap: 255, sat: 255},
+		{value: 250, incr: 6, width: 8, overflows: true, wrap: 0, sat: 255},
+		{value: 5, incr: -5, width: 8, wrap: 0, sat: 0},
+		{value: 5, incr: -6, width: 8, overflows: true, wrap: 255, sat: 0},
+		{value: 0, incr: 1000, width: 8, overflows: true, wrap: 232, sat: 255},
+		{value: 1, incr: 1, width: 1, overflows: true, wrap: 0, sat: 1},
+		{value: u63Max, incr: 1, width: 63, overflows: true, wrap: 0, sat: u63Max},
+		{value: 0, incr: math.MinInt64, width: 63, overflows: true, wrap: 0, sat: 0},
+		{value: 0, incr: math.MaxInt64, width: 63, wrap: u63Max, sat: u63Max},
+	}
+	for _, tt := range tests {
+		for _, mode := range []int{overflowWrap, overflowSat, overflowFail} {
+			overflows, got := checkUnsignedOverflow(tt.value, tt.incr, tt.width, mode)
+			if overflows != tt.overflows {
+				t.Errorf("u%d %d%+d: overflow = %v, want %v", tt.width, tt.value, tt.incr, overflows, tt.overflows)
+			}
+			want := tt.wrap
+			if mode == overflowSat {
+				want = tt.sat
+			}
+			if mode != overflowFail && got != want {
+				t.Errorf("u%d %d%+d mode %d: got %d, want %d", tt.width, tt.value, tt.incr, mode, got, want)
+			}
+		}
+	}
+}
+
+func TestBits(t *testing.T) {
+	tests := []struct {
+		offset, width int64
+		n             uint64
+		want          []byte
+		signed        int64
+	}{
+		{offset: 0, width: 8, n: 0xff, want: []byte{0xff, 0x00, 0x00}, signed: -1},
+		{offset: 4, width: 8, n: 0xab, want: []byte{0x0a, 0xb0, 0x00}, signed: -85},
+		{offset: 7, width: 2, n: 0x3, want: []byte{0x01, 0x80, 0x00}, signed: -1},
+		{offset: 1, width: 5, n: 0x0f, want: []byte{0x3c, 0x00, 0x00}, signed: 15},
+		{offset: 3, width: 16, n: 0x8001, want: []byte{0x10, 0x00, 0x20}, signed: -32767},
+	}
+	for _, tt := range tests {
+		value := make([]byte, 3)
+		setBits(value, tt.offset, tt.width, tt.n)
+		if !bytes.Equal(value, tt.want) {
+			t.Errorf("setBits(%d, %d, %#x) = %x, want %x", tt.offset, tt.width, tt.n, value, tt.want)
+		}
+		if got := getBits(value, tt.offset, tt.width); got != tt.n {
+			t.Errorf("getBits(%d, %d) = %#x, want %#x", tt.offset, tt.width, got, tt.n)
+		}
+		if got := signExtend(tt.n, tt.width); got != tt.signed {
+			t.Errorf("signExtend(%#x, %d) = %d, want %d", tt.n, tt.width, got, tt.signed)
+		}
+	}
+}
+
+// TestSetBitInPlace checks that SETBIT modifies the value without changing replies or command lines which saw it before
+func TestSetBitInPlace(t *testing.T) {
+	d := makeTestDatabase(t)
+	c := connection.NewConnection(nil)
+	setCmd := toCmdLine("set", "k", "a")
+	d.Exec(c, setCmd)
+	get := d.Exec(c, toCmdLine("get", "k"))
+	mget := d.Exec(c, toCmdLine("mget", "k"))
+	d.Exec(c, toCmdLine("setbit", "k", "6", "1"))
+	d.Exec(c, toCmdLine("setbit", "k", "20", "1"))
+	if got := string(get.ToBytes()); got != "$1\r\na\r\n" {
+		t.Errorf("GET reply changed to %q", got)
+	}
+	if got := string(mget.ToBytes()); got != "*1\r\n$1\r\na\r\n" {
+		t.Errorf("MGET reply changed to %q", got)
+	}
+	if got := string(setCmd[2]); got != "a" {
+		t.Errorf("SET command line changed to %q", got)
+	}
+	if got, want := string(d.Exec(c, toCmdLine("get", "k")).ToBytes()), "$3\r\nc\x00\x08\r\n"; got != want {
+		t.Errorf("GET = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,343 @@
+package database
+
+import (
+	"goredis/datastruct/list"
+	"goredis/interface/database"
+	"goredis/interface/resp"
+	"goredis/resp/reply"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Blocking commands (BLPOP, BRPOP, BLMOVE and BLMPOP) first run like their non-blocking counterparts.
+// When every key is empty the connection is registered as a waiter of the keys, while the keys are
+// still locked, and Exec returns a blockedReply on which the handler parks the connection.
+//
+// A command that puts a list on a key with waiters marks the key ready. Once that command is done the
+// waiters of ready keys are served in the order they blocked, each one by executing its command again,
+// so the AOF records the pops that actually happened. A blocking command on a key which already has
+// waiters queues behind them even if the key holds a list, so clients are served in the order they blocked.
+
+// blockingCmds are the commands which block the connection outside of a transaction
+var blockingCmds = map[string]bool{
+	"blpop":  true,
+	"brpop":  true,
+	"blmove": true,
+	"blmpop": true,
+}
+
+// parseBlockTimeout parses a timeout in seconds, 0 blocks forever
+func parseBlockTimeout(arg []byte) (time.Duration, reply.ErrorReply) {
+	seconds, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return 0, reply.MakeStandardErrorReply("timeout is not a float or out of range")
+	}
+	if seconds < 0 {
+		return 0, reply.MakeStandardErrorReply("timeout is negative")
+	}
+	if seconds > float64(math.MaxInt64/int64(time.Second)) {
+		return 0, reply.MakeStandardErrorReply("timeout is out of range")
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// parseBlockingArgs returns the keys a blocking command waits for and its timeout
+func parseBlockingArgs(cmdName string, args [][]byte) ([]string, time.Duration, reply.ErrorReply) {
+	var keys []string
+	timeoutArg := args[len(args)-1]
+	switch cmdName {
+	case "blpop", "brpop":
+		keys = toKeys(args[:len(args)-1])
+	case "blmove":
+		keys = []string{string(args[0])}
+	case "blmpop":
+		timeoutArg = args[0]
+		var errReply reply.ErrorReply
+		if keys, _, _, errReply = parseMPopArgs(args[1:]); errReply != nil {
+			return nil, 0, errReply
+		}
+	}
+	timeout, errReply := parseBlockTimeout(timeoutArg)
+	if errReply != nil {
+		return nil, 0, errReply
+	}
+	return keys, timeout, nil
+}
+
+type blockedKey struct {
+	dbIndex int
+	key     string
+}
+
+// waiter is a connection blocked on some keys, it is also the reply Exec returns for it
+type waiter struct {
+	registry *blockingRegistry
+	client   resp.Connection
+	dbIndex  int
+	cmdLine  CmdLine
+	keys     []string
+	timeout  time.Duration // 0 blocks forever
+
+	mu     sync.Mutex
+	done   bool            // set once the waiter is served, timed out or cancelled
+	result chan resp.Reply // receives the reply of the served command
+}
+
+var _ database.BlockedReply = &waiter{}
+
+// Wait parks the caller until the waiter is served, times out or its connection is closed
+func (w *waiter) Wait() resp.Reply {
+	var timeout <-chan time.Time
+	if w.timeout > 0 {
+		timer := time.NewTimer(w.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case result := <-w.result:
+		return result
+	case <-timeout:
+	}
+	w.mu.Lock()
+	if w.done {
+		// served right when the timeout fired
+		w.mu.Unlock()
+		return <-w.result
+	}
+	w.done = true
+	w.mu.Unlock()
+	w.registry.remove(w)
+	return reply.MakeNullMultiBulkReply()
+}
+
+// ToBytes waits for the reply, for callers which do not know about blocking
+func (w *waiter) ToBytes() []byte {
+	return w.Wait().ToBytes()
+}
+
+// blockingRegistry keeps the waiters of every key in the order they blocked
+type blockingRegistry struct {
+	mu      sync.Mutex
+	waiters map[blockedKey][]*waiter
+	clients map[resp.Connection]*waiter
+	ready   []blockedKey
+	count   atomic.Int32 // number of waiters, lets commands skip the registry when nobody is blocked
+
+	serveMu sync.Mutex // ready keys are served by one command at a time, in order
+}
+
+func makeBlockingRegistry() *blockingRegistry {
+	return &blockingRegistry{
+		waiters: make(map[blockedKey][]*waiter),
+		clients: make(map[resp.Connection]*waiter),
+	}
+}
+
+// block registers the connection as a waiter of the keys
+func (r *blockingRegistry) block(client resp.Connection, dbIndex int, cmdLine CmdLine, keys []string, timeout time.Duration) *waiter {
+	w := &waiter{
+		registry: r,
+		client:   client,
+		dbIndex:  dbIndex,
+		cmdLine:  cmdLine,
+		keys:     keys,
+		timeout:  timeout,
+		result:   make(chan resp.Reply, 1),
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, key := range keys {
+		k := blockedKey{dbIndex: dbIndex, key: key}
+		r.waiters[k] = append(r.waiters[k], w)
+	}
+	r.clients[client] = w
+	r.count.Add(1)
+	return w
+}
+
+// remove unregisters the waiter from all its keys, it can be called more than once
+func (r *blockingRegistry) remove(w *waiter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.clients[w.client] != w {
+		return
+	}
+	delete(r.clients, w.client)
+	r.count.Add(-1)
+	for _, key := range w.keys {
+		k := blockedKey{dbIndex: w.dbIndex, key: key}
+		queue := r.waiters[k]
+		for i, other := range queue {
+			if other == w {
+				queue = append(queue[:i:i], queue[i+1:]...)
+				break
+			}
+		}
+		if len(queue) == 0 {
+			delete(r.waiters, k)
+		} else {
+			r.waiters[k] = queue
+		}
+	}
+}
+
+// signal marks the key as ready if a connection is blocked on it
+func (r *blockingRegistry) signal(dbIndex int, key string) {
+	if r.count.Load() == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	k := blockedKey{dbIndex: dbIndex, key: key}
+	if len(r.waiters[k]) > 0 {
+		r.ready = append(r.ready, k)
+	}
+}
+
+// signalDB marks every key of the db with waiters as ready, after SWAPDB changed its data
+func (r *blockingRegistry) signalDB(dbIndex int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for k := range r.waiters {
+		if k.dbIndex == dbIndex {
+			r.ready = append(r.ready, k)
+		}
+	}
+}
+
+// nextReady pops the first ready key
+func (r *blockingRegistry) nextReady() (blockedKey, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.ready) == 0 {
+		return blockedKey{}, false
+	}
+	k := r.ready[0]
+	r.ready = r.ready[1:]
+	return k, true
+}
+
+// first returns the waiter which blocked first on the key
+func (r *blockingRegistry) first(k blockedKey) *waiter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if queue := r.waiters[k]; len(queue) > 0 {
+		return queue[0]
+	}
+	return nil
+}
+
+// cancel unblocks the waiter of a closed connection
+func (r *blockingRegistry) cancel(client resp.Connection) {
+	r.mu.Lock()
+	w := r.clients[client]
+	r.mu.Unlock()
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	if !w.done {
+		w.done = true
+		w.result <- reply.MakeNullMultiBulkReply()
+	}
+	w.mu.Unlock()
+	r.remove(w)
+}
+
+// signalList is called by DB for every value it stores, a list may wake the waiters of the key
+func (db *DB) signalList(key string, entity *database.DataEntity) {
+	if _, ok := entity.Data.(*list.QuickList); ok {
+		db.signalReady(key)
+	}
+}
+
+// execBlocking executes a blocking command outside of a transaction,
+// it returns a waiter if every key of the command is empty
+func (d *StandaloneDatabase) execBlocking(db *DB, client resp.Connection, cmdLine CmdLine) resp.Reply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd := cmdTable[cmdName]
+	if !ValidateArity(cmd.arity, cmdLine) {
+		return reply.MakeArgNumErrReply(cmdName)
+	}
+	keys, timeout, errReply := parseBlockingArgs(cmdName, cmdLine[1:])
+	if errReply != nil {
+		return errReply
+	}
+	writeKeys, readKeys := cmd.prepare(cmdLine[1:])
+	if !allowedOnOOM[cmdName] && !db.freeMemory() {
+		return makeOOMReply()
+	}
+	db.locker.RWLocks(writeKeys, readKeys)
+	defer db.locker.RWUnLocks(writeKeys, readKeys)
+	// a list pushed to a key with waiters belongs to them until they are served,
+	// the command waits behind them and the keys are marked ready to serve the queue in order
+	if d.hasWaiters(db.index, keys) {
+		w := d.blocking.block(client, db.index, cmdLine, keys, timeout)
+		for _, key := range keys {
+			d.blocking.signal(db.index, key)
+		}
+		return w
+	}
+	result := db.execWithLock(cmd, cmdLine, writeKeys)
+	if _, empty := result.(*reply.NullMultiBulkReply); !empty {
+		return result
+	}
+	// the keys are still locked, so a push cannot happen before the waiter is registered
+	return d.blocking.block(client, db.index, cmdLine, keys, timeout)
+}
+
+// hasWaiters reports whether a connection is blocked on one of the keys of the db
+func (d *StandaloneDatabase) hasWaiters(dbIndex int, keys []string) bool {
+	if d.blocking.count.Load() == 0 {
+		return false
+	}
+	for _, key := range keys {
+		if d.blocking.first(blockedKey{dbIndex: dbIndex, key: key}) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// serveBlocked serves the waiters of the keys made ready by the commands executed so far
+func (d *StandaloneDatabase) serveBlocked() {
+	if d.blocking.count.Load() == 0 {
+		return
+	}
+	d.blocking.serveMu.Lock()
+	defer d.blocking.serveMu.Unlock()
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for {
+		k, ok := d.blocking.nextReady()
+		if !ok {
+			return
+		}
+		for {
+			w := d.blocking.first(k)
+			if w == nil || !d.serve(w) {
+				break
+			}
+		}
+	}
+}
+
+// serve executes the command of the waiter again, it returns false if its keys are still empty
+func (d *StandaloneDatabase) serve(w *waiter) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.done {
+		result := d.dbSet[w.dbIndex].Exec(w.client, w.cmdLine)
+		if _, empty := result.(*reply.NullMultiBulkReply); empty {
+			return false
+		}
+		w.done = true
+		w.result <- result
+	}
+	d.blocking.remove(w)
+	return true
+}
@@ -0,0 +1,55 @@
+package database
+
+import (
+	"goredis/config"
+	"goredis/interface/database"
+	"goredis/resp/connection"
+	"testing"
+)
+
+func makeTestDatabase(t *testing.T) *StandaloneDatabase {
+	t.Helper()
+	config.Properties.AppendOnly = false
+	d := NewStandaloneDatabase()
+	t.Cleanup(d.Close)
+	return d
+}
+
+func toCmdLine(args ...string) CmdLine {
+	cmdLine := make(CmdLine, len(args))
+	for i, arg := range args {
+		cmdLine[i] = []byte(arg)
+	}
+	return cmdLine
+}
+
+// TestBlockingFIFO checks that a BLPOP arriving before the waiters of a pushed key are served
+// does not take the element from the client which blocked first
+func TestBlockingFIFO(t *testing.T) {
+	d := makeTestDatabase(t)
+	a, b, c := connection.NewConnection(nil), connection.NewConnection(nil), connection.NewConnection(nil)
+
+	blockedA, ok := d.Exec(a, toCmdLine("blpop", "k", "0")).(database.BlockedReply)
+	if !ok {
+		t.Fatal("BLPOP on an empty key did not block")
+	}
+	// the push runs without serving the waiters, as if the next command came in before serveBlocked
+	if got := string(d.exec(b, toCmdLine("rpush", "k", "x")).ToBytes()); got != ":1\r\n" {
+		t.Fatalf("RPUSH = %q", got)
+	}
+	blockedC, ok := d.Exec(c, toCmdLine("blpop", "k", "0")).(database.BlockedReply)
+	if !ok {
+		t.Fatal("BLPOP behind a waiter did not block")
+	}
+	if got, want := string(blockedA.Wait().ToBytes()), "*2\r\n$1\r\nk\r\n$1\r\nx\r\n"; got != want {
+		t.Errorf("first waiter got %q, want %q", got, want)
+	}
+
+	d.Exec(b, toCmdLine("rpush", "k", "y"))
+	if got, want := string(blockedC.Wait().ToBytes()), "*2\r\n$1\r\nk\r\n$1\r\ny\r\n"; got != want {
+		t.Errorf("second waiter got %q, want %q", got, want)
+	}
+	if got := string(d.Exec(b, toCmdLine("exists", "k")).ToBytes()); got != ":0\r\n" {
+		t.Errorf("EXISTS = %q, want :0", got)
+	}
+}
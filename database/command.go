@@ -5,17 +5,71 @@ import (
 )
 
 type command struct {
-	exec  ExecFunc
-	arity int
+	exec    ExecFunc
+	prepare PreFunc // prepare returns the keys the command writes and reads
+	arity   int
 }
 
 var cmdTable = make(map[string]*command)
 
+// PreFunc analyses the command line and returns the keys the command writes and reads,
+// args does not include the command name
+type PreFunc func(args [][]byte) ([]string, []string)
+
 // all redis like ping,set,commands are implemented in the form of a function
-func RegisterCommand(name string, exec ExecFunc, arity int) {
+func RegisterCommand(name string, exec ExecFunc, prepare PreFunc, arity int) {
 	name = strings.ToLower(name)
 	cmdTable[name] = &command{
-		exec:  exec,
-		arity: arity,
+		exec:    exec,
+		prepare: prepare,
+		arity:   arity,
+	}
+}
+
+// noPrepare is used by commands that do not touch any key
+func noPrepare(args [][]byte) ([]string, []string) {
+	return nil, nil
+}
+
+// writeFirstKey is used by commands that write the key given as the first argument
+func writeFirstKey(args [][]byte) ([]string, []string) {
+	return []string{string(args[0])}, nil
+}
+
+// readFirstKey is used by commands that read the key given as the first argument
+func readFirstKey(args [][]byte) ([]string, []string) {
+	return nil, []string{string(args[0])}
+}
+
+// writeAllKeys is used by commands whose arguments are all keys to write
+func writeAllKeys(args [][]byte) ([]string, []string) {
+	return toKeys(args), nil
+}
+
+// readAllKeys is used by commands whose arguments are all keys to read
+func readAllKeys(args [][]byte) ([]string, []string) {
+	return nil, toKeys(args)
+}
+
+// prepareRename writes both the source and the destination key
+func prepareRename(args [][]byte) ([]string, []string) {
+	return []string{string(args[0]), string(args[1])}, nil
+}
+
+// prepareSetStore writes the destination given as the first argument and reads the other keys
+func prepareSetStore(args [][]byte) ([]string, []string) {
+	return []string{string(args[0])}, toKeys(args[1:])
+}
+
+// prepareZRangeStore writes the destination and reads the source of ZRANGESTORE
+func prepareZRangeStore(args [][]byte) ([]string, []string) {
+	return []string{string(args[0])}, []string{string(args[1])}
+}
+
+func toKeys(args [][]byte) []string {
+	keys := make([]string, len(args))
+	for i, arg := range args {
+		keys[i] = string(arg)
 	}
+	return keys
 }
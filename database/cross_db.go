@@ -0,0 +1,245 @@
+package database
+
+import (
+	"goredis/dump"
+	"goredis/interface/resp"
+	"goredis/lib/utils"
+	"goredis/resp/reply"
+	"strconv"
+	"strings"
+)
+
+// Commands working on more than one db are executed by StandaloneDatabase, not by a single DB.
+// MOVE and COPY ... DB lock their keys in both dbs, SWAPDB and FLUSHALL hold the database exclusively.
+// Inside MULTI they are queued, and EXEC runs the whole transaction with the database held exclusively.
+
+// isCrossDB reports whether the command line works on other dbs than the current one
+func isCrossDB(cmdName string, args [][]byte, current int) bool {
+	switch cmdName {
+	case "move", "swapdb", "flushall":
+		return true
+	case "copy":
+		if len(args) < 3 {
+			return false
+		}
+		_, dbIndex, _ := parseCopyArgs(args[3:])
+		return dbIndex >= 0 && dbIndex != current
+	}
+	return false
+}
+
+// parseDBIndex parses a db index argument and checks its range
+func (d *StandaloneDatabase) parseDBIndex(arg []byte) (int, reply.ErrorReply) {
+	index, err := strconv.Atoi(string(arg))
+	if err != nil {
+		return 0, reply.MakeStandardErrorReply("value is not an integer or out of range")
+	}
+	if index < 0 || index >= len(d.dbSet) {
+		return 0, reply.MakeStandardErrorReply("DB index is out of range")
+	}
+	return index, nil
+}
+
+// lockAcross locks a key in each of two different dbs, in the order of the db indexes,
+// so that commands moving keys in opposite directions cannot deadlock
+func lockAcross(src *DB, srcKey string, dst *DB, dstKey string) func() {
+	first, firstKey, second, secondKey := src, srcKey, dst, dstKey
+	if dst.index < src.index {
+		first, firstKey, second, secondKey = dst, dstKey, src, srcKey
+	}
+	first.locker.Lock(firstKey)
+	second.locker.Lock(secondKey)
+	return func() {
+		second.locker.UnLock(secondKey)
+		first.locker.UnLock(firstKey)
+	}
+}
+
+// move: MOVE key db
+func execMove(d *StandaloneDatabase, src *DB, args [][]byte) resp.Reply {
+	if len(args) != 3 {
+		return reply.MakeArgNumErrReply("move")
+	}
+	key := string(args[1])
+	dstIndex, errReply := d.parseDBIndex(args[2])
+	if errReply != nil {
+		return errReply
+	}
+	dst := d.dbSet[dstIndex]
+	if dst == src {
+		return reply.MakeStandardErrorReply("source and destination objects are the same")
+	}
+
+	unlock := lockAcross(src, key, dst, key)
+	defer unlock()
+	entity, ok := src.GetEntity(key)
+	if !ok {
+		return reply.MakeIntegerReply(0)
+	}
+	if _, exists := dst.GetEntity(key); exists {
+		return reply.MakeIntegerReply(0)
+	}
+	expireTime, hasTTL := src.ExpireTime(key)
+	dst.PutEntity(key, entity)
+	if hasTTL {
+		dst.Expire(key, expireTime)
+	} else {
+		dst.Persist(key)
+	}
+	src.Remove(key)
+	src.addVersion(key)
+	dst.addVersion(key)
+	src.addAof(utils.ToCmdLine("MOVE", key, strconv.Itoa(dstIndex)))
+	return reply.MakeIntegerReply(1)
+}
+
+// parseCopyArgs parses the options of COPY source destination [DB destination-db] [REPLACE],
+// args starts after the destination, dbIndex is -1 when DB is not given
+func parseCopyArgs(args [][]byte) (replace bool, dbIndex int, errReply reply.ErrorReply) {
+	dbIndex = -1
+	for i := 0; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "REPLACE":
+			replace = true
+		case "DB":
+			if i+1 >= len(args) {
+				return false, -1, reply.MakeSyntaxErrReply()
+			}
+			index, err := strconv.Atoi(string(args[i+1]))
+			if err != nil {
+				return false, -1, reply.MakeStandardErrorReply("value is not an integer or out of range")
+			}
+			if index < 0 {
+				return false, -1, reply.MakeStandardErrorReply("DB index is out of range")
+			}
+			dbIndex = index
+			i++
+		default:
+			return false, -1, reply.MakeSyntaxErrReply()
+		}
+	}
+	return replace, dbIndex, nil
+}
+
+// copy: COPY source destination DB destination-db [REPLACE], copying inside the current db is executed by the DB itself
+func execCopyAcross(d *StandaloneDatabase, src *DB, args [][]byte) resp.Reply {
+	if len(args) < 3 {
+		return reply.MakeArgNumErrReply("copy")
+	}
+	srcKey, dstKey := string(args[1]), string(args[2])
+	replace, dstIndex, errReply := parseCopyArgs(args[3:])
+	if errReply != nil {
+		return errReply
+	}
+	if dstIndex >= len(d.dbSet) {
+		return reply.MakeStandardErrorReply("DB index is out of range")
+	}
+	dst := d.dbSet[dstIndex]
+	if !src.freeMemory() {
+		return makeOOMReply()
+	}
+
+	unlock := lockAcross(src, srcKey, dst, dstKey)
+	defer unlock()
+	result := copyEntity(src, srcKey, dst, dstKey, replace)
+	if result == 1 {
+		dst.addVersion(dstKey)
+		src.addAof(utils.ToCmdLineWithName("COPY", args[1:]...))
+	}
+	return reply.MakeIntegerReply(result)
+}
+
+// copyEntity copies the value and ttl of srcKey to dstKey, the keys must be locked by the caller.
+// It returns 1 if the key was copied.
+func copyEntity(src *DB, srcKey string, dst *DB, dstKey string, replace bool) int64 {
+	entity, ok := src.GetEntity(srcKey)
+	if !ok {
+		return 0
+	}
+	if _, exists := dst.GetEntity(dstKey); exists && !replace {
+		return 0
+	}
+	// going through the serialization format gives a deep copy of every type
+	payload, err := dump.Marshal(entity)
+	if err != nil {
+		return 0
+	}
+	copied, err := dump.Unmarshal(payload)
+	if err != nil {
+		return 0
+	}
+	dst.PutEntity(dstKey, copied)
+	if expireTime, hasTTL := src.ExpireTime(srcKey); hasTTL {
+		dst.Expire(dstKey, expireTime)
+	} else {
+		dst.Persist(dstKey)
+	}
+	return 1
+}
+
+// swapdb: SWAPDB index1 index2, connections using a db see the data of the other one at once
+func execSwapDB(d *StandaloneDatabase, args [][]byte) resp.Reply {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return swapDB(d, args)
+}
+
+// swapDB swaps the data of two dbs, the caller holds the database exclusively
+func swapDB(d *StandaloneDatabase, args [][]byte) resp.Reply {
+	if len(args) != 3 {
+		return reply.MakeArgNumErrReply("swapdb")
+	}
+	first, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		return reply.MakeStandardErrorReply("invalid first DB index")
+	}
+	second, err := strconv.Atoi(string(args[2]))
+	if err != nil {
+		return reply.MakeStandardErrorReply("invalid second DB index")
+	}
+	if first < 0 || first >= len(d.dbSet) || second < 0 || second >= len(d.dbSet) {
+		return reply.MakeStandardErrorReply("DB index is out of range")
+	}
+
+	if first != second {
+		a, b := d.dbSet[first], d.dbSet[second]
+		// transactions watching a key of either db must fail
+		a.touchWatchedKeys(a.data, b.data)
+		b.touchWatchedKeys(a.data, b.data)
+		// the lockers stay with the dbs, so that the lock of a key never changes while it is held
+		a.data, b.data = b.data, a.data
+		a.ttlMap, b.ttlMap = b.ttlMap, a.ttlMap
+		a.hashTTLKeys, b.hashTTLKeys = b.hashTTLKeys, a.hashTTLKeys
+		// connections blocked in either db may find a list now
+		d.blocking.signalDB(first)
+		d.blocking.signalDB(second)
+	}
+	d.dbSet[first].addAof(utils.ToCmdLine("SWAPDB", strconv.Itoa(first), strconv.Itoa(second)))
+	return reply.MakeOKReply()
+}
+
+// flushall: FLUSHALL [ASYNC|SYNC]
+func execFlushAll(d *StandaloneDatabase, args [][]byte) resp.Reply {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return flushAll(d, args)
+}
+
+// flushAll removes the keys of all dbs, the caller holds the database exclusively
+func flushAll(d *StandaloneDatabase, args [][]byte) resp.Reply {
+	if len(args) > 2 {
+		return reply.MakeArgNumErrReply("flushall")
+	}
+	if len(args) == 2 {
+		mode := strings.ToUpper(string(args[1]))
+		if mode != "ASYNC" && mode != "SYNC" {
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+
+	for _, db := range d.dbSet {
+		db.Flush()
+	}
+	d.dbSet[0].addAof(utils.ToCmdLine("FLUSHALL"))
+	return reply.MakeOKReply()
+}
@@ -2,29 +2,55 @@ package database
 
 // hash 数据结构实现
 import (
+	"goredis/config"
 	"goredis/datastruct/dict"
 	"goredis/datastruct/hash"
 	"goredis/datastruct/set"
 	"goredis/datastruct/zset"
 	"goredis/interface/database"
 	"goredis/interface/resp"
+	"goredis/lib/sync/lock"
 	"goredis/resp/reply"
 	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	dataDictSize = 1 << 12 // dataDictSize is the number of shards of the keyspace
+	ttlDictSize  = 1 << 8  // ttlDictSize is the number of shards of the ttl dict
 )
 
 type DB struct {
-	index  int
-	data   dict.Dict
-	addAof func(line CmdLine) // addAof is a function to add commands to AOF.
+	index       int
+	data        *dict.ConcurrentDict
+	ttlMap      dict.Dict              // ttlMap stores the expire time of volatile keys.
+	versionMap  dict.Dict              // versionMap stores the *watchedKey of the keys watched by some connections.
+	hashTTLKeys dict.Dict              // hashTTLKeys stores the hashes which have fields with a ttl.
+	locker      *lock.Locks            // locker is the key locks of data, it makes every command atomic on the keys it declares.
+	addAof      func(lines ...CmdLine) // addAof is a function to add commands to AOF.
+	freeMemory  func() bool            // freeMemory evicts keys when maxmemory is reached, false means out of memory.
+	signalReady func(key string)       // signalReady wakes the connections blocked on a key which got a list.
 }
 
 func MakeDB() *DB {
+	data := dict.MakeConcurrent(dataDictSize)
 	return &DB{
-		index: 0,
-		data:  dict.MakeSyncDict(),
-		addAof: func(line CmdLine) {
+		index:       0,
+		data:        data,
+		ttlMap:      dict.MakeConcurrent(ttlDictSize),
+		versionMap:  dict.MakeConcurrent(ttlDictSize),
+		hashTTLKeys: dict.MakeConcurrent(ttlDictSize),
+		locker:      data.Locks(),
+		addAof: func(lines ...CmdLine) {
 			// do nothing
 		},
+		freeMemory: func() bool {
+			return true
+		},
+		signalReady: func(key string) {
+			// nobody can block
+		},
 	}
 }
 
@@ -44,8 +70,62 @@ func (db *DB) Exec(c resp.Connection, cmdLine CmdLine) resp.Reply {
 	if !ValidateArity(cmd.arity, cmdLine) {
 		return reply.MakeArgNumErrReply(cmdName)
 	}
-	// check the db index
-	return cmd.exec(db, cmdLine[1:])
+	// lock the keys of the command, so that it is atomic against other connections
+	writeKeys, readKeys := cmd.prepare(cmdLine[1:])
+	// make room before writing, commands that can grow the dataset are refused when it is not possible
+	if len(writeKeys) > 0 && !allowedOnOOM[cmdName] && !db.freeMemory() {
+		return makeOOMReply()
+	}
+	// expired hash fields are deleted before the command can see them
+	db.expireHashFields(writeKeys)
+	db.expireHashFields(readKeys)
+	db.locker.RWLocks(writeKeys, readKeys)
+	defer db.locker.RWUnLocks(writeKeys, readKeys)
+	return db.execWithLock(cmd, cmdLine, writeKeys)
+}
+
+// execCommand executes a command whose keys are already locked by the caller
+func (db *DB) execCommand(cmdLine CmdLine) resp.Reply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd, ok := cmdTable[cmdName]
+	if !ok {
+		return reply.MakeStandardErrorReply("ERR unknown command '" + cmdName + "'")
+	}
+	if !ValidateArity(cmd.arity, cmdLine) {
+		return reply.MakeArgNumErrReply(cmdName)
+	}
+	writeKeys, _ := cmd.prepare(cmdLine[1:])
+	return db.execWithLock(cmd, cmdLine, writeKeys)
+}
+
+func (db *DB) execWithLock(cmd *command, cmdLine CmdLine, writeKeys []string) resp.Reply {
+	result := cmd.exec(db, cmdLine[1:])
+	db.addVersion(writeKeys...)
+	return result
+}
+
+// keysOf returns the keys written and read by the command lines
+func keysOf(cmdLines []CmdLine) ([]string, []string) {
+	writeKeys := make([]string, 0)
+	readKeys := make([]string, 0)
+	for _, cmdLine := range cmdLines {
+		cmd, ok := cmdTable[strings.ToLower(string(cmdLine[0]))]
+		if !ok || !ValidateArity(cmd.arity, cmdLine) {
+			continue
+		}
+		write, read := cmd.prepare(cmdLine[1:])
+		writeKeys = append(writeKeys, write...)
+		readKeys = append(readKeys, read...)
+	}
+	return writeKeys, readKeys
+}
+
+// withAof returns a view of the db which shares all data with db but
+// sends its aof lines to addAof, it is used to collect the aof lines of a transaction
+func (db *DB) withAof(addAof func(lines ...CmdLine)) *DB {
+	view := *db
+	view.addAof = addAof
+	return &view
 }
 
 func ValidateArity(arity int, args [][]byte) bool {
@@ -58,37 +138,75 @@ func ValidateArity(arity int, args [][]byte) bool {
 
 // getenity returrns dataentity by key
 func (db *DB) GetEntity(key string) (*database.DataEntity, bool) {
+	if db.IsExpired(key) {
+		return nil, false
+	}
 	raw, ok := db.data.Get(key)
 	if !ok {
 		return nil, false
 	}
 	enity, _ := raw.(*database.DataEntity)
+	enity.Touch()
 	return enity, true
 }
 
+// peekEntity returns the entity like GetEntity, but does not count as an access of the key
+func (db *DB) peekEntity(key string) (*database.DataEntity, bool) {
+	if db.IsExpired(key) {
+		return nil, false
+	}
+	raw, ok := db.data.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return raw.(*database.DataEntity), true
+}
+
+// stored is called for every value put in the db
+func (db *DB) stored(key string, entity *database.DataEntity) {
+	db.signalList(key, entity)
+	db.trackHashFieldTTL(key, entity)
+}
+
 // put entity by key
 func (db *DB) PutEntity(key string, entity *database.DataEntity) int {
-	return db.data.Put(key, entity)
+	entity.Touch()
+	result := db.data.Put(key, entity)
+	db.stored(key, entity)
+	return result
 }
 
 func (db *DB) PutIfExists(key string, entity *database.DataEntity) int {
-	return db.data.PutIfExists(key, entity)
+	db.IsExpired(key)
+	entity.Touch()
+	result := db.data.PutIfExists(key, entity)
+	if result > 0 {
+		db.stored(key, entity)
+	}
+	return result
 }
 
 func (db *DB) PutIfAbsent(key string, entity *database.DataEntity) int {
-	return db.data.PutIfAbsent(key, entity)
+	db.IsExpired(key)
+	entity.Touch()
+	result := db.data.PutIfAbsent(key, entity)
+	if result > 0 {
+		db.stored(key, entity)
+	}
+	return result
 }
 
 func (db *DB) Remove(key string) int {
+	db.ttlMap.Remove(key)
 	return db.data.Remove(key)
 }
 
 func (db *DB) Removes(keys ...string) int {
 	deleted := 0
 	for _, key := range keys {
-		_, ok := db.data.Get(key)
+		_, ok := db.GetEntity(key)
 		if ok {
-			db.data.Remove(key)
+			db.Remove(key)
 			deleted++
 		}
 	}
@@ -96,7 +214,133 @@ func (db *DB) Removes(keys ...string) int {
 }
 
 func (dr *DB) Flush() {
+	dr.touchWatchedKeys(dr.data)
 	dr.data.Clear()
+	dr.ttlMap.Clear()
+	dr.hashTTLKeys.Clear()
+}
+
+// watchedKey is the version of a key watched by some connections,
+// only watched keys have a version so that versionMap does not grow with every key ever written
+type watchedKey struct {
+	refs    atomic.Int32  // number of connections watching the key
+	version atomic.Uint32 // increased by every write of the key
+}
+
+// watch starts tracking the key for one more connection and returns its current version,
+// the key must be locked by the caller
+func (db *DB) watch(key string) uint32 {
+	raw, ok := db.versionMap.Get(key)
+	if !ok {
+		// another connection may be watching the key at the same time under a read lock
+		db.versionMap.PutIfAbsent(key, &watchedKey{})
+		raw, _ = db.versionMap.Get(key)
+	}
+	watched := raw.(*watchedKey)
+	watched.refs.Add(1)
+	return watched.version.Load()
+}
+
+// unwatch stops tracking the key for one connection and drops its version when nobody watches it,
+// the key must be locked exclusively by the caller
+func (db *DB) unwatch(key string) {
+	raw, ok := db.versionMap.Get(key)
+	if ok && raw.(*watchedKey).refs.Add(-1) <= 0 {
+		db.versionMap.Remove(key)
+	}
+}
+
+// GetVersion returns the version of a watched key, it is 0 for a key nobody watches
+func (db *DB) GetVersion(key string) uint32 {
+	raw, ok := db.versionMap.Get(key)
+	if !ok {
+		return 0
+	}
+	return raw.(*watchedKey).version.Load()
+}
+
+// addVersion increases the version of the watched keys so that transactions watching them are aborted
+func (db *DB) addVersion(keys ...string) {
+	for _, key := range keys {
+		if raw, ok := db.versionMap.Get(key); ok {
+			raw.(*watchedKey).version.Add(1)
+		}
+	}
+}
+
+// touchWatchedKeys increases the version of the watched keys which exist in any of the dicts,
+// it is called before the data of the db is flushed or swapped
+func (db *DB) touchWatchedKeys(dicts ...dict.Dict) {
+	db.versionMap.ForEach(func(key string, val interface{}) bool {
+		for _, d := range dicts {
+			if _, ok := d.Get(key); ok {
+				val.(*watchedKey).version.Add(1)
+				break
+			}
+		}
+		return true
+	})
+}
+
+// Expire sets the absolute expire time of a key
+func (db *DB) Expire(key string, expireTime time.Time) {
+	db.ttlMap.Put(key, expireTime)
+}
+
+// Persist removes the expire time of a key
+func (db *DB) Persist(key string) int {
+	return db.ttlMap.Remove(key)
+}
+
+// ExpireTime returns the expire time of a key, ok is false if the key has no ttl
+func (db *DB) ExpireTime(key string) (time.Time, bool) {
+	raw, ok := db.ttlMap.Get(key)
+	if !ok {
+		return time.Time{}, false
+	}
+	return raw.(time.Time), true
+}
+
+// expired reports whether the key has a ttl in the past, without removing it
+func (db *DB) expired(key string, now time.Time) bool {
+	expireTime, ok := db.ExpireTime(key)
+	return ok && !expireTime.After(now)
+}
+
+// IsExpired removes the key if its ttl has passed and reports whether it did so
+func (db *DB) IsExpired(key string) bool {
+	if !db.expired(key, time.Now()) {
+		return false
+	}
+	db.Remove(key)
+	db.addVersion(key)
+	return true
+}
+
+// activeExpireCycle samples volatile keys and removes the expired ones,
+// it keeps sampling while more than a quarter of the sample was expired
+func (db *DB) activeExpireCycle() {
+	const sampleSize = 20
+	const timeLimit = 25 * time.Millisecond
+	start := time.Now()
+	for time.Since(start) < timeLimit {
+		now := time.Now()
+		sampled := db.ttlMap.RandomDistinctKeys(sampleSize)
+		expiredKeys := make([]string, 0, len(sampled))
+		for _, key := range sampled {
+			if db.expired(key, now) {
+				expiredKeys = append(expiredKeys, key)
+			}
+		}
+		for _, key := range expiredKeys {
+			db.locker.Lock(key)
+			db.IsExpired(key)
+			db.locker.UnLock(key)
+		}
+		if len(sampled) == 0 || len(expiredKeys)*4 <= len(sampled) {
+			return
+		}
+	}
 }
 
 // getAsHash 函数从数据库中获取存储在指定键的哈希值，如果键不存在则返回 nil 和 false。
@@ -123,7 +367,7 @@ func (db *DB) getOrCreateHash(key string) (*hash.Hash, bool) {
 	}
 
 	// 创建一个新的哈希对象
-	hashObj = hash.NewHash()
+	hashObj = hash.NewHash(config.Properties.HashMaxListpackEntries)
 	// 存储到数据库中
 	db.PutEntity(key, &database.DataEntity{Data: hashObj})
 
@@ -153,7 +397,7 @@ func getOrInitSet(db *DB, key string) (set.Set, bool, reply.ErrorReply) {
 	// 用于标记集合是否为新创建的
 	isNew := false
 	if s == nil {
-		s = set.NewHashSet()
+		s = newSet()
 		isNew = true
 	}
 	return s, isNew, nil
@@ -164,7 +408,7 @@ func getAsZSet(db *DB, key string) (zset.ZSet, bool) {
 	// Get entity from database
 	entity, exists := db.GetEntity(key)
 	if !exists {
-		return zset.NewZSet(), false
+		return zset.NewZSet(config.Properties.ZSetMaxListpackEntries), false
 	}
 
 	// Check if entity is a ZSet
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"goredis/dump"
+	"goredis/interface/resp"
+	"goredis/lib/utils"
+	"goredis/resp/reply"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterCommand("DUMP", execDump, readFirstKey, 2)
+	RegisterCommand("RESTORE", execRestore, writeFirstKey, -4)
+}
+
+// dump: DUMP key, returns the serialized value of the key
+func execDump(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	entity, ok := db.GetEntity(key)
+	if !ok {
+		return reply.MakeNullReply()
+	}
+	payload, err := dump.Marshal(entity)
+	if err != nil {
+		return reply.MakeStandardErrorReply(err.Error())
+	}
+	return reply.MakeBulkReply(payload)
+}
+
+// restore: RESTORE key ttl payload [REPLACE] [ABSTTL] [IDLETIME seconds] [FREQ frequency]
+// ttl is in milliseconds, 0 means the key does not expire, with ABSTTL it is a unix timestamp in milliseconds
+func execRestore(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	ttl, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeStandardErrorReply("value is not an integer or out of range")
+	}
+	if ttl < 0 {
+		return reply.MakeStandardErrorReply("Invalid TTL value, must be >= 0")
+	}
+	replace, absTTL := false, false
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "REPLACE":
+			replace = true
+		case "ABSTTL":
+			absTTL = true
+		case "IDLETIME", "FREQ":
+			// access metadata starts over on restore
+			if i+1 >= len(args) {
+				return reply.MakeSyntaxErrReply()
+			}
+			if n, err := strconv.ParseInt(string(args[i+1]), 10, 64); err != nil || n < 0 {
+				return reply.MakeStandardErrorReply("value is not an integer or out of range")
+			}
+			i++
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+
+	if _, exists := db.GetEntity(key); exists && !replace {
+		return reply.MakeErrReply("BUSYKEY Target key name already exists.")
+	}
+	entity, err := dump.Unmarshal(args[2])
+	if err != nil {
+		return reply.MakeStandardErrorReply(err.Error())
+	}
+
+	var whenMs int64
+	if ttl > 0 {
+		whenMs = ttl
+		if !absTTL {
+			now := time.Now().UnixMilli()
+			if ttl > math.MaxInt64-now {
+				return reply.MakeStandardErrorReply("invalid expire time in 'restore' command")
+			}
+			whenMs = now + ttl
+		}
+		if whenMs <= time.Now().UnixMilli() {
+			// the key would expire at once, so it is only removed
+			db.Remove(key)
+			db.addAof(utils.ToCmdLine("DEL", key))
+			return reply.MakeOKReply()
+		}
+	}
+
+	db.PutEntity(key, entity)
+	// the aof gets an absolute expire time, so replaying it later does not extend the ttl
+	aofLines := []CmdLine{utils.ToCmdLine("RESTORE", key, "0", string(args[2]), "REPLACE")}
+	if whenMs > 0 {
+		db.Expire(key, time.UnixMilli(whenMs))
+		aofLines = append(aofLines, makeExpireCmd(key, whenMs))
+	} else {
+		db.Persist(key)
+	}
+	db.addAof(aofLines...)
+	return reply.MakeOKReply()
+}
@@ -0,0 +1,261 @@
+package database
+
+import (
+	"goredis/config"
+	"goredis/datastruct/hash"
+	"goredis/datastruct/list"
+	"goredis/datastruct/set"
+	"goredis/datastruct/zset"
+	"goredis/interface/database"
+	"goredis/lib/logger"
+	"goredis/lib/utils"
+	"goredis/resp/reply"
+	"math/rand"
+	"runtime/metrics"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// eviction policies, named like the values of maxmemory-policy in redis.conf
+const (
+	policyNoEviction     = "noeviction"
+	policyAllKeysLRU     = "allkeys-lru"
+	policyAllKeysLFU     = "allkeys-lfu"
+	policyAllKeysRandom  = "allkeys-random"
+	policyVolatileLRU    = "volatile-lru"
+	policyVolatileLFU    = "volatile-lfu"
+	policyVolatileRandom = "volatile-random"
+	policyVolatileTTL    = "volatile-ttl"
+)
+
+// defaultEvictionSamples is the number of keys sampled per db when maxmemory-samples is not set
+const defaultEvictionSamples = 5
+
+// entryOverhead is a rough estimate of the memory used by the dict entry and headers of a value
+const entryOverhead = 64
+
+const (
+	heapLiveMetric = "/gc/heap/live:bytes"
+	gcCyclesMetric = "/gc/cycles/total:gc-cycles"
+)
+
+// allowedOnOOM are the write commands that never grow the dataset,
+// they still run when maxmemory is reached and no key can be evicted
+var allowedOnOOM = map[string]bool{
+	"del":     true,
+	"hdel":    true,
+	"srem":    true,
+	"zrem":    true,
+	"lpop":    true,
+	"rpop":    true,
+	"spop":    true,
+	"persist": true,
+	"getdel":  true,
+	"blpop":   true,
+	"brpop":   true,
+	"blmpop":  true,
+	"lrem":    true,
+	"ltrim":   true,
+	"lmpop":   true,
+}
+
+func makeOOMReply() *reply.ErrReply {
+	return reply.MakeErrReply("OOM command not allowed when used memory > 'maxmemory'")
+}
+
+// growsDataset reports whether any of the command lines writes keys and is not allowed on OOM
+func growsDataset(cmdLines []CmdLine) bool {
+	for _, cmdLine := range cmdLines {
+		cmdName := strings.ToLower(string(cmdLine[0]))
+		cmd, ok := cmdTable[cmdName]
+		if !ok || !ValidateArity(cmd.arity, cmdLine) || allowedOnOOM[cmdName] {
+			continue
+		}
+		if writeKeys, _ := cmd.prepare(cmdLine[1:]); len(writeKeys) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// evictor keeps the memory used by the dataset under maxmemory by evicting keys
+type evictor struct {
+	maxMemory int64
+	policy    string
+	samples   int
+	dbSet     []*DB
+
+	mu sync.Mutex // mu makes sure only one connection evicts at a time
+	// evicted keys are counted as live until the next gc cycle,
+	// evictedBytes is their estimated size and is reset when a new cycle is done
+	evictedBytes int64
+	gcCycles     uint64
+}
+
+func makeEvictor(dbSet []*DB) *evictor {
+	e := &evictor{
+		maxMemory: config.Properties.MaxMemory,
+		policy:    config.Properties.MaxMemoryPolicy,
+		samples:   config.Properties.MaxMemorySamples,
+		dbSet:     dbSet,
+	}
+	switch e.policy {
+	case policyNoEviction, policyAllKeysLRU, policyAllKeysLFU, policyAllKeysRandom,
+		policyVolatileLRU, policyVolatileLFU, policyVolatileRandom, policyVolatileTTL:
+	case "":
+		e.policy = policyNoEviction
+	default:
+		logger.Warn("unknown maxmemory-policy " + e.policy + ", using noeviction")
+		e.policy = policyNoEviction
+	}
+	if e.samples <= 0 {
+		e.samples = defaultEvictionSamples
+	}
+	return e
+}
+
+// usedMemory returns the live heap measured by the last gc cycle, less the keys evicted since then.
+// Garbage is not counted, so the heap may grow past maxmemory until the next cycle like any Go program,
+// but the data kept after each cycle stays under maxmemory.
+func (e *evictor) usedMemory() int64 {
+	samples := []metrics.Sample{{Name: heapLiveMetric}, {Name: gcCyclesMetric}}
+	metrics.Read(samples)
+	if cycles := samples[1].Value.Uint64(); cycles != e.gcCycles {
+		e.gcCycles = cycles
+		atomic.StoreInt64(&e.evictedBytes, 0)
+	}
+	used := int64(samples[0].Value.Uint64()) - atomic.LoadInt64(&e.evictedBytes)
+	if used < 0 {
+		return 0
+	}
+	return used
+}
+
+// freeMemory evicts keys until the used memory is under maxmemory,
+// it returns false if the memory is over the limit and nothing more can be evicted
+func (e *evictor) freeMemory() bool {
+	if e.maxMemory <= 0 {
+		return true
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for e.usedMemory() > e.maxMemory {
+		if e.policy == policyNoEviction {
+			return false
+		}
+		db, key, ok := e.pickVictim()
+		if !ok {
+			return false
+		}
+		atomic.AddInt64(&e.evictedBytes, db.evict(key))
+	}
+	return true
+}
+
+// pickVictim samples keys of every db and returns the best key to evict according to the policy
+func (e *evictor) pickVictim() (*DB, string, bool) {
+	var victimDB *DB
+	var victim string
+	var bestScore float64
+	for _, i := range rand.Perm(len(e.dbSet)) {
+		db := e.dbSet[i]
+		key, score, ok := db.sampleVictim(e.policy, e.samples)
+		if ok && (victimDB == nil || score > bestScore) {
+			victimDB, victim, bestScore = db, key, score
+		}
+	}
+	return victimDB, victim, victimDB != nil
+}
+
+// sampleVictim samples keys of the db and returns the one with the highest eviction score,
+// the score is the idle time for LRU, the inverse of the access counter for LFU
+// and how soon the key expires for TTL
+func (db *DB) sampleVictim(policy string, samples int) (string, float64, bool) {
+	volatile := policy == policyVolatileLRU || policy == policyVolatileLFU ||
+		policy == policyVolatileRandom || policy == policyVolatileTTL
+	var keys []string
+	if volatile {
+		keys = db.ttlMap.RandomDistinctKeys(samples)
+	} else {
+		keys = db.data.RandomDistinctKeys(samples)
+	}
+	if len(keys) == 0 {
+		return "", 0, false
+	}
+	if policy == policyAllKeysRandom || policy == policyVolatileRandom {
+		return keys[0], rand.Float64(), true
+	}
+
+	best := ""
+	var bestScore float64
+	for _, key := range keys {
+		raw, ok := db.data.Get(key)
+		if !ok {
+			continue
+		}
+		entity := raw.(*database.DataEntity)
+		var score float64
+		switch policy {
+		case policyAllKeysLRU, policyVolatileLRU:
+			score = float64(entity.IdleTime())
+		case policyAllKeysLFU, policyVolatileLFU:
+			score = float64(255 - entity.Frequency())
+		case policyVolatileTTL:
+			expireTime, ok := db.ExpireTime(key)
+			if !ok {
+				continue
+			}
+			score = -float64(expireTime.UnixNano())
+		}
+		if best == "" || score > bestScore {
+			best, bestScore = key, score
+		}
+	}
+	return best, bestScore, best != ""
+}
+
+// evict removes the key and returns its estimated size, the deletion is written to the aof
+func (db *DB) evict(key string) int64 {
+	db.locker.Lock(key)
+	defer db.locker.UnLock(key)
+	raw, ok := db.data.Get(key)
+	if !ok {
+		return 0
+	}
+	db.Remove(key)
+	db.addVersion(key)
+	db.addAof(utils.ToCmdLine("DEL", key))
+	return sizeOf(key, raw.(*database.DataEntity))
+}
+
+// sizeOf estimates the memory used by a key and its value
+func sizeOf(key string, entity *database.DataEntity) int64 {
+	size := int64(len(key) + entryOverhead)
+	switch val := entity.Data.(type) {
+	case []byte:
+		size += int64(len(val))
+	case int64:
+		size += 8
+	case *list.QuickList:
+		val.ForEach(0, func(i int, element []byte) bool {
+			size += int64(len(element)) + entryOverhead
+			return true
+		})
+	case *hash.Hash:
+		for field, value := range val.GetAll() {
+			size += int64(len(field)+len(value)) + entryOverhead
+		}
+	case set.Set:
+		val.ForEach(func(member string) bool {
+			size += int64(len(member)) + entryOverhead
+			return true
+		})
+	case zset.ZSet:
+		members, _ := val.Scan(0, val.Len())
+		for _, member := range members {
+			size += int64(len(member)) + entryOverhead
+		}
+	}
+	return size
+}
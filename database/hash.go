@@ -2,24 +2,36 @@ package database
 
 import (
 	"fmt"
+	"goredis/interface/database"
 	"goredis/interface/resp"
 	"goredis/lib/utils"
 	"goredis/resp/reply"
+	"math"
+	"strconv"
+	"strings"
 )
 
 // HSet 函数实现了 Redis 中 HSET 命令的功能，
-// 将存储在键 key 的哈希表中的字段 field 设置为值 value
+// 将存储在键 key 的哈希表中的字段 field 设置为值 value，返回新增字段的数量
+// 命令格式：HSET key field value [field value ...]
 func execHSet(db *DB, args [][]byte) resp.Reply {
 	key := string(args[0])
-	field := string(args[1])
-	value := string(args[2])
+	if len(args)%2 == 0 {
+		return reply.MakeArgNumErrReply("hset")
+	}
 
 	// 获取哈希表
-	hash, _ := db.getOrCreateHash(key)
-	result := hash.Set(field, value)
+	hash, exists := db.getOrCreateHash(key)
+	if hash == nil && exists {
+		return reply.MakeWrongTypeErrReply()
+	}
+	added := 0
+	for i := 1; i < len(args); i += 2 {
+		added += hash.Set(string(args[i]), string(args[i+1]))
+	}
 
 	db.addAof(utils.ToCmdLineWithName("HSET", args...))
-	return reply.MakeIntegerReply(int64(result))
+	return reply.MakeIntegerReply(int64(added))
 }
 
 // HGet 函数实现了 Redis 中 HGET 命令的功能，
@@ -28,8 +40,14 @@ func execHGet(db *DB, args [][]byte) resp.Reply {
 	key := string(args[0])
 	field := string(args[1])
 
-	// 获取哈希表
-	hash, _ := db.getOrCreateHash(key)
+	// 获取哈希表，只读命令不能创建键
+	hash, exists := db.getAsHash(key)
+	if !exists {
+		return reply.MakeNullReply()
+	}
+	if hash == nil {
+		return reply.MakeWrongTypeErrReply()
+	}
 	value, ok := hash.Get(field)
 
 	if !ok {
@@ -44,10 +62,13 @@ func execHExists(db *DB, args [][]byte) resp.Reply {
 	key := string(args[0])
 	field := string(args[1])
 
-	// 获取哈希表
-	hash, ok := db.getOrCreateHash(key)
+	// 获取哈希表，只读命令不能创建键
+	hash, ok := db.getAsHash(key)
 	if !ok {
-		return reply.MakeNullReply()
+		return reply.MakeIntegerReply(0)
+	}
+	if hash == nil {
+		return reply.MakeWrongTypeErrReply()
 	}
 
 	// 检查字段是否存在
@@ -255,17 +276,211 @@ func execHSetNX(db *DB, args [][]byte) resp.Reply {
 	return reply.MakeIntegerReply(int64(result))
 }
 
+// HScan 函数实现了 Redis 中 HSCAN 命令的功能，增量迭代哈希表中的字段
+// HSCAN key cursor [MATCH pattern] [COUNT count] [NOVALUES]
+func execHScan(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	cur, errReply := parseScanCursor(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	opts, errReply := parseScanOptions(args[2:], false, true)
+	if errReply != nil {
+		return errReply
+	}
+
+	hash, exists := db.getAsHash(key)
+	if !exists {
+		return makeScanReply(0, nil)
+	}
+	if hash == nil {
+		return reply.MakeWrongTypeErrReply()
+	}
+
+	fields, next := hash.Scan(cur, opts.count)
+	result := make([][]byte, 0, len(fields)*2)
+	for _, field := range fields {
+		if !opts.match(field) {
+			continue
+		}
+		result = append(result, []byte(field))
+		if !opts.noValues {
+			value, _ := hash.Get(field)
+			result = append(result, []byte(value))
+		}
+	}
+	return makeScanReply(next, result)
+}
+
+// execHIncrBy 函数实现了 Redis 中 HINCRBY 命令的功能，
+// 将哈希表中字段 field 的整数值加上 increment，字段不存在时视为 0
+// 命令格式：HINCRBY key field increment
+func execHIncrBy(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	field := string(args[1])
+	delta, ok := database.ParseInteger(args[2])
+	if !ok {
+		return reply.MakeStandardErrorReply("value is not an integer or out of range")
+	}
+
+	hash, exists := db.getAsHash(key)
+	if hash == nil && exists {
+		return reply.MakeWrongTypeErrReply()
+	}
+	var current int64
+	if hash != nil {
+		if value, ok := hash.Get(field); ok {
+			if current, ok = database.ParseInteger([]byte(value)); !ok {
+				return reply.MakeStandardErrorReply("hash value is not an integer")
+			}
+		}
+	}
+	if (delta < 0 && current < math.MinInt64-delta) || (delta > 0 && current > math.MaxInt64-delta) {
+		return reply.MakeStandardErrorReply("increment or decrement would overflow")
+	}
+	current += delta
+
+	if hash == nil {
+		hash, _ = db.getOrCreateHash(key)
+	}
+	// 与 HSET 不同，HINCRBY 保留字段的过期时间
+	expireAt, hasTTL := hash.ExpireTime(field)
+	hash.Set(field, strconv.FormatInt(current, 10))
+	if hasTTL {
+		hash.SetExpire(field, expireAt)
+	}
+	db.addAof(utils.ToCmdLineWithName("HINCRBY", args...))
+	return reply.MakeIntegerReply(current)
+}
+
+// execHIncrByFloat 函数实现了 Redis 中 HINCRBYFLOAT 命令的功能，
+// 将哈希表中字段 field 的浮点数值加上 increment，字段不存在时视为 0
+// 命令格式：HINCRBYFLOAT key field increment
+func execHIncrByFloat(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	field := string(args[1])
+	delta, ok := parseFiniteFloat(args[2])
+	if !ok {
+		return reply.MakeStandardErrorReply("value is not a valid float")
+	}
+
+	hash, exists := db.getAsHash(key)
+	if hash == nil && exists {
+		return reply.MakeWrongTypeErrReply()
+	}
+	var current float64
+	if hash != nil {
+		if value, ok := hash.Get(field); ok {
+			if current, ok = parseFiniteFloat([]byte(value)); !ok {
+				return reply.MakeStandardErrorReply("hash value is not a float")
+			}
+		}
+	}
+	current += delta
+	if math.IsNaN(current) || math.IsInf(current, 0) {
+		return reply.MakeStandardErrorReply("increment would produce NaN or Infinity")
+	}
+
+	if hash == nil {
+		hash, _ = db.getOrCreateHash(key)
+	}
+	result := strconv.FormatFloat(current, 'f', -1, 64)
+	expireAt, hasTTL := hash.ExpireTime(field)
+	hash.Set(field, result)
+	// 结果以 HSET 写入 AOF，重放时不受浮点数舍入的影响
+	db.addAof(utils.ToCmdLine("HSET", key, field, result))
+	// HSET 会清除字段的过期时间，需要重新设置
+	if hasTTL {
+		hash.SetExpire(field, expireAt)
+		db.addAof(makeHashExpireCmd(key, expireAt, []string{field}))
+	}
+	return reply.MakeBulkReply([]byte(result))
+}
+
+// execHStrLen 函数实现了 Redis 中 HSTRLEN 命令的功能，
+// 返回哈希表中字段 field 的值的长度，字段不存在时返回 0
+// 命令格式：HSTRLEN key field
+func execHStrLen(db *DB, args [][]byte) resp.Reply {
+	hash, exists := db.getAsHash(string(args[0]))
+	if !exists {
+		return reply.MakeIntegerReply(0)
+	}
+	if hash == nil {
+		return reply.MakeWrongTypeErrReply()
+	}
+	value, _ := hash.Get(string(args[1]))
+	return reply.MakeIntegerReply(int64(len(value)))
+}
+
+// execHRandField 函数实现了 Redis 中 HRANDFIELD 命令的功能，随机返回哈希表中的字段。
+// count 为正数时返回最多 count 个不重复的字段，为负数时返回 -count 个可能重复的字段
+// 命令格式：HRANDFIELD key [count [WITHVALUES]]
+func execHRandField(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	if len(args) > 3 || (len(args) == 3 && strings.ToUpper(string(args[2])) != "WITHVALUES") {
+		return reply.MakeSyntaxErrReply()
+	}
+	withValues := len(args) == 3
+	count := int64(1)
+	if len(args) >= 2 {
+		n, err := strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil {
+			return reply.MakeStandardErrorReply("value is not an integer or out of range")
+		}
+		if n < -math.MaxInt64/2 {
+			return reply.MakeStandardErrorReply("value is out of range")
+		}
+		count = n
+	}
+
+	hash, exists := db.getAsHash(key)
+	if hash == nil && exists {
+		return reply.MakeWrongTypeErrReply()
+	}
+	// 字段全部过期的哈希视为不存在
+	if hash == nil || hash.Len() == 0 {
+		if len(args) == 1 {
+			return reply.MakeNullReply()
+		}
+		return reply.MakeEmptyMultiBulkReply()
+	}
+
+	if len(args) == 1 {
+		return reply.MakeBulkReply([]byte(hash.RandomFields(1)[0]))
+	}
+	var fields []string
+	if count >= 0 {
+		fields = hash.RandomDistinctFields(int(min(count, int64(hash.Len()))))
+	} else {
+		fields = hash.RandomFields(int(-count))
+	}
+	result := make([][]byte, 0, len(fields)*2)
+	for _, field := range fields {
+		result = append(result, []byte(field))
+		if withValues {
+			value, _ := hash.Get(field)
+			result = append(result, []byte(value))
+		}
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
 func init() {
-	RegisterCommand("HSET", execHSet, 4)
-	RegisterCommand("HGET", execHGet, 3)
-	RegisterCommand("HEXISTS", execHExists, 3)
-	RegisterCommand("HDEL", execHDel, -3)
-	RegisterCommand("HLEN", execHLen, 2)
-	RegisterCommand("HGETALL", execHGetAll, 2)
-	RegisterCommand("HKEYS", execHKeys, 2)
-	RegisterCommand("HVALS", execHVals, 2)
-	RegisterCommand("HMGET", execHMGet, -3)
-	RegisterCommand("HMSET", execHMSet, -4)
-	RegisterCommand("HENCODING", execHEncoding, 2)
-	RegisterCommand("HSETNX", execHSetNX, 4)
+	RegisterCommand("HSET", execHSet, writeFirstKey, -4)
+	RegisterCommand("HGET", execHGet, readFirstKey, 3)
+	RegisterCommand("HEXISTS", execHExists, readFirstKey, 3)
+	RegisterCommand("HDEL", execHDel, writeFirstKey, -3)
+	RegisterCommand("HLEN", execHLen, readFirstKey, 2)
+	RegisterCommand("HGETALL", execHGetAll, readFirstKey, 2)
+	RegisterCommand("HKEYS", execHKeys, readFirstKey, 2)
+	RegisterCommand("HVALS", execHVals, readFirstKey, 2)
+	RegisterCommand("HMGET", execHMGet, readFirstKey, -3)
+	RegisterCommand("HMSET", execHMSet, writeFirstKey, -4)
+	RegisterCommand("HENCODING", execHEncoding, readFirstKey, 2)
+	RegisterCommand("HSETNX", execHSetNX, writeFirstKey, 4)
+	RegisterCommand("HSCAN", execHScan, readFirstKey, -3)
+	RegisterCommand("HINCRBY", execHIncrBy, writeFirstKey, 4)
+	RegisterCommand("HINCRBYFLOAT", execHIncrByFloat, writeFirstKey, 4)
+	RegisterCommand("HSTRLEN", execHStrLen, readFirstKey, 3)
+	RegisterCommand("HRANDFIELD", execHRandField, readFirstKey, -2)
 }
@@ -0,0 +1,330 @@
+package database
+
+import (
+	"goredis/datastruct/hash"
+	"goredis/interface/database"
+	"goredis/interface/resp"
+	"goredis/lib/utils"
+	"goredis/resp/reply"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 哈希字段的过期时间保存在 hash.Hash 中，过期的字段对读取不可见。
+// 设置了字段过期时间的键记录在 DB.hashTTLKeys 中，命令访问这些键之前会删除其中已过期的字段，
+// 后台的定期清理也会抽样删除。删除的字段以 HDEL 写入 AOF，哈希变为空时以 DEL 写入。
+// 字段的过期时间以 HPEXPIREAT 的绝对时间写入 AOF，重放时不会延长过期时间。
+
+// hashFieldMaxExpireMs 字段过期时间的上限（unix 毫秒），与 redis 相同
+const hashFieldMaxExpireMs = 1<<48 - 1
+
+// 字段过期命令对每个字段的返回值
+const (
+	hashFieldNotExists  = -2 // 字段或键不存在
+	hashFieldNoTTL      = -1 // 字段没有过期时间
+	hashFieldNotUpdated = 0  // NX、XX、GT、LT 条件不满足
+	hashFieldUpdated    = 1  // 设置或清除了过期时间
+	hashFieldDeleted    = 2  // 过期时间已经过去，字段被删除
+)
+
+func init() {
+	RegisterCommand("HEXPIRE", execHExpire, writeFirstKey, -6)
+	RegisterCommand("HPEXPIRE", execHPExpire, writeFirstKey, -6)
+	RegisterCommand("HEXPIREAT", execHExpireAt, writeFirstKey, -6)
+	RegisterCommand("HPEXPIREAT", execHPExpireAt, writeFirstKey, -6)
+	RegisterCommand("HTTL", execHTTL, readFirstKey, -5)
+	RegisterCommand("HPTTL", execHPTTL, readFirstKey, -5)
+	RegisterCommand("HEXPIRETIME", execHExpireTime, readFirstKey, -5)
+	RegisterCommand("HPEXPIRETIME", execHPExpireTime, readFirstKey, -5)
+	RegisterCommand("HPERSIST", execHPersist, writeFirstKey, -5)
+}
+
+// parseHashFields 解析 FIELDS numfields field [field ...]
+func parseHashFields(args [][]byte) ([]string, reply.ErrorReply) {
+	if len(args) < 2 || strings.ToUpper(string(args[0])) != "FIELDS" {
+		return nil, reply.MakeStandardErrorReply("Mandatory argument FIELDS is missing or not at the right position")
+	}
+	numFields, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil || numFields <= 0 {
+		return nil, reply.MakeStandardErrorReply("Parameter `numFields` should be greater than 0")
+	}
+	if numFields != int64(len(args)-2) {
+		return nil, reply.MakeStandardErrorReply("The `numfields` parameter must match the number of arguments")
+	}
+	return toKeys(args[2:]), nil
+}
+
+// hashExpireGeneric 实现 HEXPIRE、HPEXPIRE、HEXPIREAT 和 HPEXPIREAT，
+// unit 为时间参数每个单位的毫秒数，relative 表示时间参数是相对当前时间的
+// 命令格式：HEXPIRE key seconds [NX|XX|GT|LT] FIELDS numfields field [field ...]
+func hashExpireGeneric(db *DB, args [][]byte, unit int64, relative bool) resp.Reply {
+	key := string(args[0])
+	n, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeStandardErrorReply("value is not an integer or out of range")
+	}
+	invalidTime := reply.MakeStandardErrorReply("invalid expire time, must be >= 0 and <= " +
+		strconv.FormatInt(hashFieldMaxExpireMs, 10))
+	if n < 0 || n > hashFieldMaxExpireMs/unit {
+		return invalidTime
+	}
+	now := time.Now().UnixMilli()
+	expireAt := n * unit
+	if relative {
+		expireAt += now
+	}
+	if expireAt > hashFieldMaxExpireMs {
+		return invalidTime
+	}
+
+	// FIELDS 之前可以有一个 NX、XX、GT 或 LT 条件
+	rest := args[2:]
+	flags := 0
+	if len(rest) > 0 && strings.ToUpper(string(rest[0])) != "FIELDS" {
+		var errReply reply.ErrorReply
+		if flags, errReply = parseExpireFlags(rest[:1]); errReply != nil {
+			return errReply
+		}
+		rest = rest[1:]
+	}
+	fields, errReply := parseHashFields(rest)
+	if errReply != nil {
+		return errReply
+	}
+
+	h, exists := db.getAsHash(key)
+	if h == nil && exists {
+		return reply.MakeWrongTypeErrReply()
+	}
+	results := make([]resp.Reply, len(fields))
+	updated := make([]string, 0, len(fields))
+	deleted := make([]string, 0)
+	for i, field := range fields {
+		if h == nil || !h.Exists(field) {
+			results[i] = reply.MakeIntegerReply(hashFieldNotExists)
+			continue
+		}
+		current, hasTTL := h.ExpireTime(field)
+		// 没有过期时间的字段视为永不过期
+		if (flags&expireNX != 0 && hasTTL) ||
+			(flags&expireXX != 0 && !hasTTL) ||
+			(flags&expireGT != 0 && (!hasTTL || expireAt <= current)) ||
+			(flags&expireLT != 0 && hasTTL && expireAt >= current) {
+			results[i] = reply.MakeIntegerReply(hashFieldNotUpdated)
+			continue
+		}
+		if expireAt <= now {
+			h.Delete(field)
+			deleted = append(deleted, field)
+			results[i] = reply.MakeIntegerReply(hashFieldDeleted)
+			continue
+		}
+		h.SetExpire(field, expireAt)
+		updated = append(updated, field)
+		results[i] = reply.MakeIntegerReply(hashFieldUpdated)
+	}
+
+	if len(deleted) > 0 {
+		if h.Len() == 0 {
+			db.Remove(key)
+		}
+		db.addAof(utils.ToCmdLine(append([]string{"HDEL", key}, deleted...)...))
+	}
+	if len(updated) > 0 {
+		db.hashTTLKeys.Put(key, struct{}{})
+		db.addAof(makeHashExpireCmd(key, expireAt, updated))
+	}
+	return reply.MakeMultiRawReply(results)
+}
+
+// makeHashExpireCmd 生成写入 AOF 的 HPEXPIREAT 命令
+func makeHashExpireCmd(key string, expireAt int64, fields []string) CmdLine {
+	line := []string{"HPEXPIREAT", key, strconv.FormatInt(expireAt, 10), "FIELDS", strconv.Itoa(len(fields))}
+	return utils.ToCmdLine(append(line, fields...)...)
+}
+
+// execHExpire 函数实现了 HEXPIRE 命令，以秒为单位设置字段的过期时间
+// 命令格式：HEXPIRE key seconds [NX|XX|GT|LT] FIELDS numfields field [field ...]
+func execHExpire(db *DB, args [][]byte) resp.Reply {
+	return hashExpireGeneric(db, args, 1000, true)
+}
+
+// execHPExpire 函数实现了 HPEXPIRE 命令，以毫秒为单位设置字段的过期时间
+// 命令格式：HPEXPIRE key milliseconds [NX|XX|GT|LT] FIELDS numfields field [field ...]
+func execHPExpire(db *DB, args [][]byte) resp.Reply {
+	return hashExpireGeneric(db, args, 1, true)
+}
+
+// execHExpireAt 函数实现了 HEXPIREAT 命令，以 unix 秒设置字段的过期时间
+// 命令格式：HEXPIREAT key unix-time-seconds [NX|XX|GT|LT] FIELDS numfields field [field ...]
+func execHExpireAt(db *DB, args [][]byte) resp.Reply {
+	return hashExpireGeneric(db, args, 1000, false)
+}
+
+// execHPExpireAt 函数实现了 HPEXPIREAT 命令，以 unix 毫秒设置字段的过期时间
+// 命令格式：HPEXPIREAT key unix-time-milliseconds [NX|XX|GT|LT] FIELDS numfields field [field ...]
+func execHPExpireAt(db *DB, args [][]byte) resp.Reply {
+	return hashExpireGeneric(db, args, 1, false)
+}
+
+// hashTTLGeneric 实现 HTTL、HPTTL、HEXPIRETIME 和 HPEXPIRETIME，
+// ttl 函数根据字段的过期时间（unix 毫秒）和当前时间计算返回值
+// 命令格式：HTTL key FIELDS numfields field [field ...]
+func hashTTLGeneric(db *DB, args [][]byte, ttl func(expireAt int64, now int64) int64) resp.Reply {
+	fields, errReply := parseHashFields(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	h, exists := db.getAsHash(string(args[0]))
+	if h == nil && exists {
+		return reply.MakeWrongTypeErrReply()
+	}
+	now := time.Now().UnixMilli()
+	results := make([]resp.Reply, len(fields))
+	for i, field := range fields {
+		if h == nil || !h.Exists(field) {
+			results[i] = reply.MakeIntegerReply(hashFieldNotExists)
+			continue
+		}
+		expireAt, ok := h.ExpireTime(field)
+		if !ok {
+			results[i] = reply.MakeIntegerReply(hashFieldNoTTL)
+			continue
+		}
+		results[i] = reply.MakeIntegerReply(ttl(expireAt, now))
+	}
+	return reply.MakeMultiRawReply(results)
+}
+
+// execHTTL 函数实现了 HTTL 命令，返回字段剩余的秒数
+func execHTTL(db *DB, args [][]byte) resp.Reply {
+	return hashTTLGeneric(db, args, func(expireAt int64, now int64) int64 {
+		return (expireAt - now + 999) / 1000
+	})
+}
+
+// execHPTTL 函数实现了 HPTTL 命令，返回字段剩余的毫秒数
+func execHPTTL(db *DB, args [][]byte) resp.Reply {
+	return hashTTLGeneric(db, args, func(expireAt int64, now int64) int64 {
+		return expireAt - now
+	})
+}
+
+// execHExpireTime 函数实现了 HEXPIRETIME 命令，返回字段过期的 unix 秒
+func execHExpireTime(db *DB, args [][]byte) resp.Reply {
+	return hashTTLGeneric(db, args, func(expireAt int64, now int64) int64 {
+		return expireAt / 1000
+	})
+}
+
+// execHPExpireTime 函数实现了 HPEXPIRETIME 命令，返回字段过期的 unix 毫秒
+func execHPExpireTime(db *DB, args [][]byte) resp.Reply {
+	return hashTTLGeneric(db, args, func(expireAt int64, now int64) int64 {
+		return expireAt
+	})
+}
+
+// execHPersist 函数实现了 HPERSIST 命令，清除字段的过期时间
+// 命令格式：HPERSIST key FIELDS numfields field [field ...]
+func execHPersist(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	fields, errReply := parseHashFields(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	h, exists := db.getAsHash(key)
+	if h == nil && exists {
+		return reply.MakeWrongTypeErrReply()
+	}
+	results := make([]resp.Reply, len(fields))
+	persisted := make([]string, 0, len(fields))
+	for i, field := range fields {
+		switch {
+		case h == nil || !h.Exists(field):
+			results[i] = reply.MakeIntegerReply(hashFieldNotExists)
+		case h.Persist(field):
+			persisted = append(persisted, field)
+			results[i] = reply.MakeIntegerReply(hashFieldUpdated)
+		default:
+			results[i] = reply.MakeIntegerReply(hashFieldNoTTL)
+		}
+	}
+	if len(persisted) > 0 {
+		line := []string{"HPERSIST", key, "FIELDS", strconv.Itoa(len(persisted))}
+		db.addAof(utils.ToCmdLine(append(line, persisted...)...))
+	}
+	return reply.MakeMultiRawReply(results)
+}
+
+// trackHashFieldTTL 记录设置了字段过期时间的哈希，RENAME、MOVE、RESTORE 等写入的哈希也会被记录
+func (db *DB) trackHashFieldTTL(key string, entity *database.DataEntity) {
+	if h, ok := entity.Data.(*hash.Hash); ok && h.HasExpires() {
+		db.hashTTLKeys.Put(key, struct{}{})
+	}
+}
+
+// activeExpireHashFields 抽样设置了字段过期时间的哈希，删除其中已过期的字段，
+// 过期的字段超过抽样的四分之一时继续抽样
+func (db *DB) activeExpireHashFields() {
+	const sampleSize = 20
+	const timeLimit = 25 * time.Millisecond
+	start := time.Now()
+	for time.Since(start) < timeLimit {
+		sampled := db.hashTTLKeys.RandomDistinctKeys(sampleSize)
+		expired := 0
+		for _, key := range sampled {
+			db.locker.Lock(key)
+			if db.removeExpiredHashFields(key) {
+				expired++
+			}
+			db.locker.UnLock(key)
+		}
+		if len(sampled) == 0 || expired*4 <= len(sampled) {
+			return
+		}
+	}
+}
+
+// expireHashFields 在命令访问键之前删除其中哈希的已过期字段，调用者不能持有这些键的锁
+func (db *DB) expireHashFields(keys []string) {
+	if db.hashTTLKeys.Len() == 0 {
+		return
+	}
+	for _, key := range keys {
+		if _, ok := db.hashTTLKeys.Get(key); !ok {
+			continue
+		}
+		db.locker.Lock(key)
+		db.removeExpiredHashFields(key)
+		db.locker.UnLock(key)
+	}
+}
+
+// removeExpiredHashFields 删除哈希中已过期的字段，哈希变为空时删除键，并把删除写入 AOF，
+// 返回是否删除了字段，调用者需要持有键的写锁
+func (db *DB) removeExpiredHashFields(key string) bool {
+	entity, ok := db.peekEntity(key)
+	h, isHash := (*hash.Hash)(nil), false
+	if ok {
+		h, isHash = entity.Data.(*hash.Hash)
+	}
+	var removed []string
+	if isHash {
+		removed = h.RemoveExpired()
+	}
+	if len(removed) > 0 {
+		if h.Len() == 0 {
+			db.Remove(key)
+			db.addAof(utils.ToCmdLine("DEL", key))
+		} else {
+			db.addAof(utils.ToCmdLine(append([]string{"HDEL", key}, removed...)...))
+		}
+		db.addVersion(key)
+	}
+	// 键已被删除、被其他类型覆盖或者没有字段再设置过期时间
+	if !isHash || !h.HasExpires() {
+		db.hashTTLKeys.Remove(key)
+	}
+	return len(removed) > 0
+}
@@ -0,0 +1,132 @@
+package database
+
+import (
+	"goredis/datastruct/hyperloglog"
+	"goredis/interface/database"
+	"goredis/interface/resp"
+	"goredis/lib/utils"
+	"goredis/resp/reply"
+)
+
+func init() {
+	RegisterCommand("PFADD", execPFAdd, writeFirstKey, -2)
+	RegisterCommand("PFCOUNT", execPFCount, preparePFCount, -2)
+	RegisterCommand("PFMERGE", execPFMerge, prepareSetStore, -2)
+}
+
+// preparePFCount writes a single key, whose cached cardinality may be refreshed, and reads several keys
+func preparePFCount(args [][]byte) ([]string, []string) {
+	if len(args) == 1 {
+		return toKeys(args), nil
+	}
+	return nil, toKeys(args)
+}
+
+// getAsHyperLogLog decodes the HyperLogLog string of a key, it returns nil if the key does not exist
+func (db *DB) getAsHyperLogLog(key string) (*hyperloglog.HyperLogLog, reply.ErrorReply) {
+	value, errReply := db.getAsString(key)
+	if errReply != nil || value == nil {
+		return nil, errReply
+	}
+	return parseHyperLogLog(value)
+}
+
+func parseHyperLogLog(value []byte) (*hyperloglog.HyperLogLog, reply.ErrorReply) {
+	h, err := hyperloglog.Parse(value)
+	if err != nil {
+		return nil, makeHyperLogLogErrReply(err)
+	}
+	return h, nil
+}
+
+func makeHyperLogLogErrReply(err error) reply.ErrorReply {
+	if err == hyperloglog.ErrNotHyperLogLog {
+		return reply.MakeErrReply("WRONGTYPE Key is not a valid HyperLogLog string value.")
+	}
+	return reply.MakeErrReply("INVALIDOBJ Corrupted HLL object detected")
+}
+
+// pfadd: PFADD key [element [element ...]], returns 1 if the estimated cardinality may have changed.
+// The registers are set in the stored string, the cardinality is computed again by the next PFCOUNT.
+func execPFAdd(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	value, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+	changed := value == nil
+	if value == nil {
+		value = hyperloglog.Empty()
+	}
+	for _, element := range args[1:] {
+		var added bool
+		var err error
+		if value, added, err = hyperloglog.AddBytes(value, element); err != nil {
+			return makeHyperLogLogErrReply(err)
+		}
+		if added {
+			changed = true
+		}
+	}
+	if !changed {
+		return reply.MakeIntegerReply(0)
+	}
+	// the string may have been reallocated
+	db.PutEntity(key, &database.DataEntity{Data: value})
+	db.addAof(utils.ToCmdLineWithName("PFADD", args...))
+	return reply.MakeIntegerReply(1)
+}
+
+// pfcount: PFCOUNT key [key ...], several keys are merged on the fly without changing them
+func execPFCount(db *DB, args [][]byte) resp.Reply {
+	if len(args) == 1 {
+		value, errReply := db.getAsString(string(args[0]))
+		if errReply != nil {
+			return errReply
+		}
+		if value == nil {
+			return reply.MakeIntegerReply(0)
+		}
+		if count, ok := hyperloglog.CachedCount(value); ok {
+			return reply.MakeIntegerReply(count)
+		}
+		h, errReply := parseHyperLogLog(value)
+		if errReply != nil {
+			return errReply
+		}
+		// the key is locked for writing, the cardinality is cached until the next change of the registers
+		count := h.Count()
+		hyperloglog.SetCachedCount(value, count)
+		return reply.MakeIntegerReply(count)
+	}
+
+	merged := hyperloglog.New()
+	for _, arg := range args {
+		h, errReply := db.getAsHyperLogLog(string(arg))
+		if errReply != nil {
+			return errReply
+		}
+		if h != nil {
+			merged.Merge(h)
+		}
+	}
+	return reply.MakeIntegerReply(merged.Count())
+}
+
+// pfmerge: PFMERGE destkey [sourcekey [sourcekey ...]], the destination is merged with the sources
+func execPFMerge(db *DB, args [][]byte) resp.Reply {
+	destKey := string(args[0])
+	merged := hyperloglog.New()
+	for _, arg := range args {
+		h, errReply := db.getAsHyperLogLog(string(arg))
+		if errReply != nil {
+			return errReply
+		}
+		if h != nil {
+			merged.Merge(h)
+		}
+	}
+	db.PutEntity(destKey, &database.DataEntity{Data: merged.Bytes()})
+	db.addAof(utils.ToCmdLineWithName("PFMERGE", args...))
+	return reply.MakeOKReply()
+}
@@ -1,21 +1,37 @@
 package database
 
 import (
+	"goredis/interface/database"
 	"goredis/interface/resp"
 	"goredis/lib/utils"
 	"goredis/lib/wildcard"
 	"goredis/resp/reply"
+	"math"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func init() {
-	RegisterCommand("KEYS", execKeys, 2) // KEYS 命令需要1个参数，所以arity为2
-	RegisterCommand("PING", Ping, 1)
-	RegisterCommand("DEL", execDel, -2)
-	RegisterCommand("EXISTS", execExists, -2)
-	RegisterCommand("FLUSHDB", execFlushDB, -1)
-	RegisterCommand("TYPE", execType, 2)
-	RegisterCommand("RENAME", execRename, 3)
-	RegisterCommand("RENAMENX", execRenameNX, 3)
+	RegisterCommand("KEYS", execKeys, noPrepare, 2) // KEYS 命令需要1个参数，所以arity为2
+	RegisterCommand("PING", Ping, noPrepare, 1)
+	RegisterCommand("DEL", execDel, writeAllKeys, -2)
+	RegisterCommand("EXISTS", execExists, readAllKeys, -2)
+	RegisterCommand("FLUSHDB", execFlushDB, noPrepare, -1)
+	RegisterCommand("TYPE", execType, readFirstKey, 2)
+	RegisterCommand("RENAME", execRename, prepareRename, 3)
+	RegisterCommand("RENAMENX", execRenameNX, prepareRename, 3)
+	RegisterCommand("EXPIRE", execExpire, writeFirstKey, -3)
+	RegisterCommand("PEXPIRE", execPExpire, writeFirstKey, -3)
+	RegisterCommand("EXPIREAT", execExpireAt, writeFirstKey, -3)
+	RegisterCommand("PEXPIREAT", execPExpireAt, writeFirstKey, -3)
+	RegisterCommand("TTL", execTTL, readFirstKey, 2)
+	RegisterCommand("PTTL", execPTTL, readFirstKey, 2)
+	RegisterCommand("PERSIST", execPersist, writeFirstKey, 2)
+	RegisterCommand("SCAN", execScan, noPrepare, -2)
+	RegisterCommand("COPY", execCopy, prepareCopy, -3)
+	RegisterCommand("DBSIZE", execDBSize, noPrepare, 1)
+	RegisterCommand("RANDOMKEY", execRandomKey, noPrepare, 1)
 }
 
 // Register the ping command with arity 0
@@ -63,15 +79,11 @@ func execFlushDB(db *DB, args [][]byte) resp.Reply {
 // Register the type command with arity 2 (1 argument)
 func execType(db *DB, args [][]byte) resp.Reply {
 	key := string(args[0])
-	if entity, ok := db.GetEntity(key); ok {
-		switch entity.Data.(type) {
-		case []byte:
-			return reply.MakeBulkReply([]byte("string"))
-		}
-	} else {
+	entity, ok := db.GetEntity(key)
+	if !ok {
 		return reply.MakeStatusReply("none")
 	}
-	return reply.MakeUnknownCmdErrReply()
+	return reply.MakeStatusReply(typeOf(entity))
 }
 
 // Register the rename command with arity 3 (2 arguments)
@@ -82,8 +94,15 @@ func execRename(db *DB, args [][]byte) resp.Reply {
 	if !ok {
 		return reply.MakeStandardErrorReply("ERR no such key")
 	}
+	expireTime, hasTTL := db.ExpireTime(src)
 	db.PutEntity(dst, entity)
 	db.Remove(src)
+	// the ttl moves along with the value
+	if hasTTL {
+		db.Expire(dst, expireTime)
+	} else {
+		db.Persist(dst)
+	}
 	// write to aof file
 	db.addAof(utils.ToCmdLineWithName("RENAME", args...))
 	return reply.MakeOKReply()
@@ -99,8 +118,12 @@ func execRenameNX(db *DB, args [][]byte) resp.Reply {
 	if _, ok := db.GetEntity(dst); ok {
 		return reply.MakeIntegerReply(0)
 	}
+	expireTime, hasTTL := db.ExpireTime(src)
 	db.PutEntity(dst, entity)
 	db.Remove(src)
+	if hasTTL {
+		db.Expire(dst, expireTime)
+	}
 	// write to aof file
 	db.addAof(utils.ToCmdLineWithName("RENAMENX", args...))
 	return reply.MakeIntegerReply(1)
@@ -109,11 +132,335 @@ func execRenameNX(db *DB, args [][]byte) resp.Reply {
 func execKeys(db *DB, args [][]byte) resp.Reply {
 	pattern := wildcard.CompilePattern(string(args[0]))
 	result := make([][]byte, 0) // Initialize result slice
+	now := time.Now()
 	db.data.ForEach(func(key string, val interface{}) bool {
-		if pattern.Match(key) {
+		if pattern.Match(key) && !db.expired(key, now) {
 			result = append(result, []byte(key)) // Append matching key to result slice
 		}
 		return true // Continue iterating
 	})
 	return reply.MakeMultiBulkReply(result) // Return the result as a MultiBulkReply
 }
+
+// expire flags of EXPIRE/PEXPIRE/EXPIREAT/PEXPIREAT
+const (
+	expireNX = 1 << iota // set expiry only when the key has no expiry
+	expireXX             // set expiry only when the key has an existing expiry
+	expireGT             // set expiry only when the new expiry is greater than current one
+	expireLT             // set expiry only when the new expiry is less than current one
+)
+
+func parseExpireFlags(args [][]byte) (int, reply.ErrorReply) {
+	flags := 0
+	for _, arg := range args {
+		switch strings.ToUpper(string(arg)) {
+		case "NX":
+			flags |= expireNX
+		case "XX":
+			flags |= expireXX
+		case "GT":
+			flags |= expireGT
+		case "LT":
+			flags |= expireLT
+		default:
+			return 0, reply.MakeStandardErrorReply("Unsupported option " + string(arg))
+		}
+	}
+	if flags&expireNX != 0 && flags&(expireXX|expireGT|expireLT) != 0 {
+		return 0, reply.MakeStandardErrorReply("NX and XX, GT or LT options at the same time are not compatible")
+	}
+	if flags&expireGT != 0 && flags&expireLT != 0 {
+		return 0, reply.MakeStandardErrorReply("GT and LT options at the same time are not compatible")
+	}
+	return flags, nil
+}
+
+// expireGeneric sets the absolute expire time in milliseconds of a key.
+// All expire commands are written to aof as PEXPIREAT so that a replay never extends the ttl
+func expireGeneric(db *DB, key string, whenMs int64, flagArgs [][]byte) resp.Reply {
+	flags, errReply := parseExpireFlags(flagArgs)
+	if errReply != nil {
+		return errReply
+	}
+	if _, ok := db.GetEntity(key); !ok {
+		return reply.MakeIntegerReply(0)
+	}
+	current, hasTTL := db.ExpireTime(key)
+	if flags&expireNX != 0 && hasTTL {
+		return reply.MakeIntegerReply(0)
+	}
+	if flags&expireXX != 0 && !hasTTL {
+		return reply.MakeIntegerReply(0)
+	}
+	// a key without ttl is regarded as having an infinite ttl
+	if flags&expireGT != 0 && (!hasTTL || whenMs <= current.UnixMilli()) {
+		return reply.MakeIntegerReply(0)
+	}
+	if flags&expireLT != 0 && hasTTL && whenMs >= current.UnixMilli() {
+		return reply.MakeIntegerReply(0)
+	}
+
+	if whenMs <= time.Now().UnixMilli() {
+		db.Remove(key)
+		db.addAof(utils.ToCmdLine("DEL", key))
+		return reply.MakeIntegerReply(1)
+	}
+	db.Expire(key, time.UnixMilli(whenMs))
+	db.addAof(makeExpireCmd(key, whenMs))
+	return reply.MakeIntegerReply(1)
+}
+
+// makeExpireCmd returns the aof command line of an absolute expire time
+func makeExpireCmd(key string, whenMs int64) CmdLine {
+	return utils.ToCmdLine("PEXPIREAT", key, strconv.FormatInt(whenMs, 10))
+}
+
+// parseExpireArg parses the time argument of an expire command, unit is the number of milliseconds per unit,
+// base is added after conversion
+func parseExpireArg(cmdName string, arg []byte, unit int64, base int64) (int64, reply.ErrorReply) {
+	raw, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		return 0, reply.MakeStandardErrorReply("value is not an integer or out of range")
+	}
+	if raw > math.MaxInt64/unit || raw < math.MinInt64/unit {
+		return 0, reply.MakeStandardErrorReply("invalid expire time in '" + cmdName + "' command")
+	}
+	ms := raw * unit
+	if (base > 0 && ms > math.MaxInt64-base) || (base < 0 && ms < math.MinInt64-base) {
+		return 0, reply.MakeStandardErrorReply("invalid expire time in '" + cmdName + "' command")
+	}
+	return ms + base, nil
+}
+
+// expire: expire key seconds [NX|XX|GT|LT]
+func execExpire(db *DB, args [][]byte) resp.Reply {
+	whenMs, errReply := parseExpireArg("expire", args[1], 1000, time.Now().UnixMilli())
+	if errReply != nil {
+		return errReply
+	}
+	return expireGeneric(db, string(args[0]), whenMs, args[2:])
+}
+
+// pexpire: pexpire key milliseconds [NX|XX|GT|LT]
+func execPExpire(db *DB, args [][]byte) resp.Reply {
+	whenMs, errReply := parseExpireArg("pexpire", args[1], 1, time.Now().UnixMilli())
+	if errReply != nil {
+		return errReply
+	}
+	return expireGeneric(db, string(args[0]), whenMs, args[2:])
+}
+
+// expireat: expireat key unix-time-seconds [NX|XX|GT|LT]
+func execExpireAt(db *DB, args [][]byte) resp.Reply {
+	whenMs, errReply := parseExpireArg("expireat", args[1], 1000, 0)
+	if errReply != nil {
+		return errReply
+	}
+	return expireGeneric(db, string(args[0]), whenMs, args[2:])
+}
+
+// pexpireat: pexpireat key unix-time-milliseconds [NX|XX|GT|LT]
+func execPExpireAt(db *DB, args [][]byte) resp.Reply {
+	whenMs, errReply := parseExpireArg("pexpireat", args[1], 1, 0)
+	if errReply != nil {
+		return errReply
+	}
+	return expireGeneric(db, string(args[0]), whenMs, args[2:])
+}
+
+// ttlGeneric returns the remaining ttl of a key in milliseconds or rounded seconds,
+// -2 if the key does not exist and -1 if the key has no ttl
+func ttlGeneric(db *DB, key string, inSeconds bool) resp.Reply {
+	if _, ok := db.GetEntity(key); !ok {
+		return reply.MakeIntegerReply(-2)
+	}
+	expireTime, ok := db.ExpireTime(key)
+	if !ok {
+		return reply.MakeIntegerReply(-1)
+	}
+	remaining := time.Until(expireTime).Milliseconds()
+	if remaining < 0 {
+		remaining = 0
+	}
+	if inSeconds {
+		return reply.MakeIntegerReply((remaining + 500) / 1000)
+	}
+	return reply.MakeIntegerReply(remaining)
+}
+
+// ttl: ttl key
+func execTTL(db *DB, args [][]byte) resp.Reply {
+	return ttlGeneric(db, string(args[0]), true)
+}
+
+// pttl: pttl key
+func execPTTL(db *DB, args [][]byte) resp.Reply {
+	return ttlGeneric(db, string(args[0]), false)
+}
+
+// persist: persist key
+func execPersist(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	if _, ok := db.GetEntity(key); !ok {
+		return reply.MakeIntegerReply(0)
+	}
+	result := db.Persist(key)
+	if result > 0 {
+		db.addAof(utils.ToCmdLineWithName("PERSIST", args...))
+	}
+	return reply.MakeIntegerReply(int64(result))
+}
+
+// scanDefaultCount is the number of elements SCAN visits when COUNT is not given
+const scanDefaultCount = 10
+
+type scanOptions struct {
+	pattern  *wildcard.Pattern // nil means every element matches
+	count    int
+	typeName string // only used by SCAN
+	noValues bool   // only used by HSCAN
+}
+
+// parseScanCursor parses the cursor argument of the SCAN family
+func parseScanCursor(arg []byte) (uint64, reply.ErrorReply) {
+	cur, err := strconv.ParseUint(string(arg), 10, 64)
+	if err != nil {
+		return 0, reply.MakeStandardErrorReply("invalid cursor")
+	}
+	return cur, nil
+}
+
+// parseScanOptions parses [MATCH pattern] [COUNT count] and the options allowed for the command
+func parseScanOptions(args [][]byte, allowType bool, allowNoValues bool) (*scanOptions, reply.ErrorReply) {
+	opts := &scanOptions{
+		count: scanDefaultCount,
+	}
+	for i := 0; i < len(args); i++ {
+		opt := strings.ToUpper(string(args[i]))
+		if opt == "NOVALUES" && allowNoValues {
+			opts.noValues = true
+			continue
+		}
+		if i+1 >= len(args) {
+			return nil, reply.MakeSyntaxErrReply()
+		}
+		value := string(args[i+1])
+		switch {
+		case opt == "MATCH":
+			opts.pattern = wildcard.CompilePattern(value)
+		case opt == "COUNT":
+			count, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, reply.MakeStandardErrorReply("value is not an integer or out of range")
+			}
+			if count < 1 {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			opts.count = count
+		case opt == "TYPE" && allowType:
+			opts.typeName = strings.ToLower(value)
+		default:
+			return nil, reply.MakeSyntaxErrReply()
+		}
+		i++
+	}
+	return opts, nil
+}
+
+func (opts *scanOptions) match(element string) bool {
+	return opts.pattern == nil || opts.pattern.Match(element)
+}
+
+// makeScanReply returns the reply of the SCAN family: the next cursor and the elements
+func makeScanReply(next uint64, elements [][]byte) resp.Reply {
+	return reply.MakeMultiRawReply([]resp.Reply{
+		reply.MakeBulkReply([]byte(strconv.FormatUint(next, 10))),
+		reply.MakeMultiBulkReply(elements),
+	})
+}
+
+// scan: scan cursor [MATCH pattern] [COUNT count] [TYPE type]
+// The cursor is the index of the next shard of the keyspace to visit, every call returns whole shards,
+// so a key that stays in the db during a full iteration is returned at least once.
+func execScan(db *DB, args [][]byte) resp.Reply {
+	cur, errReply := parseScanCursor(args[0])
+	if errReply != nil {
+		return errReply
+	}
+	opts, errReply := parseScanOptions(args[1:], true, false)
+	if errReply != nil {
+		return errReply
+	}
+
+	shardCount := db.data.ShardCount()
+	keys := make([][]byte, 0)
+	visited := 0
+	now := time.Now()
+	index := cur
+	for ; index < uint64(shardCount) && visited < opts.count; index++ {
+		db.data.ForEachInShard(int(index), func(key string, val interface{}) bool {
+			visited++
+			if db.expired(key, now) || !opts.match(key) {
+				return true
+			}
+			if opts.typeName != "" && typeOf(val.(*database.DataEntity)) != opts.typeName {
+				return true
+			}
+			keys = append(keys, []byte(key))
+			return true
+		})
+	}
+	if index >= uint64(shardCount) {
+		index = 0
+	}
+	return makeScanReply(index, keys)
+}
+
+// prepareCopy writes the destination and reads the source
+func prepareCopy(args [][]byte) ([]string, []string) {
+	return []string{string(args[1])}, []string{string(args[0])}
+}
+
+// copy: COPY source destination [DB destination-db] [REPLACE],
+// the DB option only reaches here when it is this db, copies to other dbs are executed by StandaloneDatabase
+func execCopy(db *DB, args [][]byte) resp.Reply {
+	src, dst := string(args[0]), string(args[1])
+	replace, dbIndex, errReply := parseCopyArgs(args[2:])
+	if errReply != nil {
+		return errReply
+	}
+	if dbIndex >= 0 && dbIndex != db.index {
+		return reply.MakeStandardErrorReply("COPY to another db is not allowed here")
+	}
+	if src == dst {
+		return reply.MakeStandardErrorReply("source and destination objects are the same")
+	}
+	result := copyEntity(db, src, db, dst, replace)
+	if result == 1 {
+		db.addAof(utils.ToCmdLineWithName("COPY", args...))
+	}
+	return reply.MakeIntegerReply(result)
+}
+
+// dbsize: DBSIZE, keys expired but not removed yet are counted
+func execDBSize(db *DB, args [][]byte) resp.Reply {
+	return reply.MakeIntegerReply(int64(db.data.Len()))
+}
+
+// randomKeyTries is the number of expired keys RANDOMKEY skips before giving up
+const randomKeyTries = 100
+
+// randomkey: RANDOMKEY
+func execRandomKey(db *DB, args [][]byte) resp.Reply {
+	now := time.Now()
+	for i := 0; i < randomKeyTries; i++ {
+		keys := db.data.RandomKey(1)
+		if len(keys) == 0 {
+			break
+		}
+		if !db.expired(keys[0], now) {
+			return reply.MakeBulkReply([]byte(keys[0]))
+		}
+	}
+	return reply.MakeNullReply()
+}
@@ -1,26 +1,34 @@
 package database
 
 import (
-	"container/list" // 使用go标准库中的list包来实现双向链表
-	"fmt"
+	"bytes"
+	"goredis/config"
+	"goredis/datastruct/list"
 	"goredis/interface/database"
 	"goredis/interface/resp"
 	"goredis/lib/utils"
 	"goredis/resp/reply"
+	"math"
 	"strconv"
+	"strings"
 )
 
+// newList 创建一个新列表，节点大小由 list-max-listpack-size 配置
+func newList() *list.QuickList {
+	return list.New(config.Properties.ListMaxListpackSize)
+}
+
 // getAsList 函数用于获取指定键对应的列表，如果键不存在则创建一个新列表。
 // 返回列表指针和一个布尔值，布尔值表示键是否原本就存在。
-func getList(db *DB, key string) (*list.List, bool) {
+func getList(db *DB, key string) (*list.QuickList, bool) {
 	// 从数据库中获取指定键的实体
 	entity, ok := db.GetEntity(key)
 	if !ok {
-		return list.New(), false
+		return newList(), false
 	}
 
 	// 判断实体的类型是否为list
-	lst, ok := entity.Data.(*list.List)
+	lst, ok := entity.Data.(*list.QuickList)
 	if !ok {
 		return nil, true
 	}
@@ -87,78 +95,53 @@ func execRPush(db *DB, args [][]byte) resp.Reply {
 	return reply.MakeIntegerReply(int64(lst.Len()))
 }
 
-// execLPop 函数实现了LPOP命令，用于移除并返回列表的第一个元素。
-// 命令格式：LPOP key
-func execLPop(db *DB, args [][]byte) resp.Reply {
-	key := string(args[0])
-	lst, ok := getList(db, key)
-	
-	if !ok {
-		return reply.MakeNullReply()
+// popGeneric 实现 LPOP 和 RPOP，带 count 参数时返回数组
+func popGeneric(db *DB, args [][]byte, fromLeft bool, cmdName string) resp.Reply {
+	if len(args) > 2 {
+		return reply.MakeArgNumErrReply(cmdName)
 	}
-	if lst == nil {
-		return reply.MakeWrongTypeErrReply()
-	}
-	if lst.Len() == 0 {
-		fmt.Println("LPOP: lst is empty")
-		return reply.MakeNullReply()
-	}
-
-	// 从列表中移除第一个元素
-	element := lst.Front()
-	lst.Remove(element)
-	value := element.Value.([]byte)
-	
-	if lst.Len() == 0 {
-		// 如果列表为空，则从数据库中删除该键
-		db.Remove(key)
-	} else {
-		// 否则更新列表
-		db.PutEntity(key, &database.DataEntity{
-			Data: lst,
-		})
+	count, hasCount := 1, len(args) == 2
+	if hasCount {
+		n, err := strconv.Atoi(string(args[1]))
+		if err != nil || n < 0 {
+			return reply.MakeStandardErrorReply("value is out of range, must be positive")
+		}
+		count = n
 	}
 
-	// 将该命令添加到AOF日志中
-	db.addAof(utils.ToCmdLineWithName("LPOP", args...))
-	// 返回移除的元素
-	return reply.MakeBulkReply(value)
-}
-
-// execRPop 函数实现了RPOP命令，用于移除并返回列表的最后一个元素。
-// 命令格式：RPOP key
-func execRPop(db *DB, args [][]byte) resp.Reply {
 	key := string(args[0])
-
 	lst, ok := getList(db, key)
 	if !ok {
+		if hasCount {
+			return reply.MakeNullMultiBulkReply()
+		}
 		return reply.MakeNullReply()
 	}
 	if lst == nil {
 		return reply.MakeWrongTypeErrReply()
 	}
-	if lst.Len() == 0 {
-		return reply.MakeNullReply()
+	if hasCount && count == 0 {
+		return reply.MakeEmptyMultiBulkReply()
 	}
 
-	// 从列表中移除最后一个元素
-	element := lst.Back()
-	lst.Remove(element)
-	value := element.Value.([]byte)
-	if lst.Len() == 0 {
-		// 如果列表为空，则从数据库中删除该键
-		db.Remove(key)
-	} else {
-		// 否则更新列表
-		db.PutEntity(key, &database.DataEntity{
-			Data: lst,
-		})
+	// 移除元素，列表为空时删除该键
+	values := popElements(db, key, lst, fromLeft, count)
+	if hasCount {
+		return reply.MakeMultiBulkReply(values)
 	}
+	return reply.MakeBulkReply(values[0])
+}
 
-	// 将该命令添加到AOF日志中
-	db.addAof(utils.ToCmdLineWithName("RPOP", args...))
-	// 返回移除的元素
-	return reply.MakeBulkReply(value)
+// execLPop 函数实现了LPOP命令，用于移除并返回列表的前 count 个元素。
+// 命令格式：LPOP key [count]
+func execLPop(db *DB, args [][]byte) resp.Reply {
+	return popGeneric(db, args, true, "lpop")
+}
+
+// execRPop 函数实现了RPOP命令，用于移除并返回列表的最后 count 个元素。
+// 命令格式：RPOP key [count]
+func execRPop(db *DB, args [][]byte) resp.Reply {
+	return popGeneric(db, args, false, "rpop")
 }
 
 // execLRange 函数实现了LRANGE命令，用于返回列表中指定范围的元素。
@@ -201,19 +184,8 @@ func execLRange(db *DB, args [][]byte) resp.Reply {
 		return reply.MakeEmptyMultiBulkReply()
 	}
 
-	// 创建一个新的列表来存储结果
-	elements := make([][]byte, 0, stop-start+1)
-	index := int64(0)
-	for e := lst.Front(); e != nil; e = e.Next() {
-		if index >= start && index <= stop {
-			// 将元素添加到结果列表中
-			elements = append(elements, e.Value.([]byte))
-		} else if index > stop {
-			break
-		}
-		index++
-	}
-	return reply.MakeMultiBulkReply(elements)
+	// 从 start 所在的节点开始取出范围内的元素
+	return reply.MakeMultiBulkReply(lst.Range(int(start), int(stop)))
 }
 
 //	execLLen 函数实现了LLEN命令，用于返回列表的长度。
@@ -261,23 +233,8 @@ func execLIndex(db *DB, args [][]byte) resp.Reply {
 		return reply.MakeNullReply()
 	}
 
-	// 查找指定索引位置的元素
-	var element *list.Element
-	if index < size/2 {
-		// 若索引在前半部分，从列表头部开始遍历
-		element = lst.Front()
-		for i := int64(0); i < index; i++ {
-			element = element.Next()
-		}
-	} else {
-		// 若索引在后半部分，从列表尾部开始遍历
-		element = lst.Back()
-		for i := size - 1; i > index; i-- {
-			element = element.Prev()
-		}
-	}
-
-	return reply.MakeBulkReply(element.Value.([]byte))
+	// 跳过前面的节点后直接在节点内按下标取值
+	return reply.MakeBulkReply(lst.Get(int(index)))
 }
 
 // execLSet 函数实现了LSET命令，用于将列表中指定索引位置的元素设置为指定值。
@@ -306,21 +263,8 @@ func execLSet(db *DB, args [][]byte) resp.Reply {
 		return reply.MakeStandardErrorReply("ERR index out of range")
 	}
 
-	// 获取指定索引位置的元素
-	var e *list.Element
-	if index < size/2 {
-		e = lst.Front()
-		for i := int64(0); i < index; i++ {
-			e = e.Next()
-		}
-	} else {
-		e = lst.Back()
-		for i := size - 1; i > index; i-- {
-			e = e.Prev()
-		}
-	}
-	// 设置元素的值
-	e.Value = value
+	// 设置指定索引位置的元素的值
+	lst.Set(int(index), value)
 	// 将列表存入数据库
 	db.PutEntity(key, &database.DataEntity{
 		Data: lst,
@@ -330,14 +274,554 @@ func execLSet(db *DB, args [][]byte) resp.Reply {
 	return reply.MakeStatusReply("OK")
 }
 
+// pushIfExists 实现 LPUSHX 和 RPUSHX，只有列表存在时才插入元素
+func pushIfExists(db *DB, args [][]byte, toLeft bool, cmdName string) resp.Reply {
+	key := string(args[0])
+	lst, ok := getList(db, key)
+	if !ok {
+		return reply.MakeIntegerReply(0)
+	}
+	if lst == nil {
+		return reply.MakeWrongTypeErrReply()
+	}
+	for _, v := range args[1:] {
+		if toLeft {
+			lst.PushFront(v)
+		} else {
+			lst.PushBack(v)
+		}
+	}
+	db.PutEntity(key, &database.DataEntity{Data: lst})
+	db.addAof(utils.ToCmdLineWithName(cmdName, args...))
+	return reply.MakeIntegerReply(int64(lst.Len()))
+}
+
+// execLPushX 函数实现了LPUSHX命令，仅当列表存在时将值插入到列表的头部。
+// 命令格式：LPUSHX key value [value ...]
+func execLPushX(db *DB, args [][]byte) resp.Reply {
+	return pushIfExists(db, args, true, "LPUSHX")
+}
+
+// execRPushX 函数实现了RPUSHX命令，仅当列表存在时将值插入到列表的尾部。
+// 命令格式：RPUSHX key value [value ...]
+func execRPushX(db *DB, args [][]byte) resp.Reply {
+	return pushIfExists(db, args, false, "RPUSHX")
+}
+
+// execLInsert 函数实现了LINSERT命令，将元素插入到第一个等于 pivot 的元素之前或之后。
+// 命令格式：LINSERT key BEFORE|AFTER pivot element
+// 返回插入后的列表长度，找不到 pivot 时返回 -1，键不存在时返回 0
+func execLInsert(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	var after bool
+	switch strings.ToUpper(string(args[1])) {
+	case "BEFORE":
+	case "AFTER":
+		after = true
+	default:
+		return reply.MakeSyntaxErrReply()
+	}
+	pivot, value := args[2], args[3]
+
+	lst, ok := getList(db, key)
+	if !ok {
+		return reply.MakeIntegerReply(0)
+	}
+	if lst == nil {
+		return reply.MakeWrongTypeErrReply()
+	}
+	index := -1
+	lst.ForEach(0, func(i int, val []byte) bool {
+		if bytes.Equal(val, pivot) {
+			index = i
+			return false
+		}
+		return true
+	})
+	if index < 0 {
+		return reply.MakeIntegerReply(-1)
+	}
+	if after {
+		index++
+	}
+	lst.Insert(index, value)
+	db.PutEntity(key, &database.DataEntity{Data: lst})
+	db.addAof(utils.ToCmdLineWithName("LINSERT", args...))
+	return reply.MakeIntegerReply(int64(lst.Len()))
+}
+
+// execLRem 函数实现了LREM命令，移除列表中等于 element 的元素。
+// 命令格式：LREM key count element
+// count > 0 时从头部开始移除 count 个，count < 0 时从尾部开始移除 -count 个，count = 0 时移除全部
+func execLRem(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	count, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeStandardErrorReply("value is not an integer or out of range")
+	}
+	value := args[2]
+
+	lst, ok := getList(db, key)
+	if !ok {
+		return reply.MakeIntegerReply(0)
+	}
+	if lst == nil {
+		return reply.MakeWrongTypeErrReply()
+	}
+	fromTail := count < 0
+	if fromTail {
+		count = -count
+	}
+	if count > int64(lst.Len()) {
+		count = 0
+	}
+	removed := lst.RemoveByVal(func(val []byte) bool {
+		return bytes.Equal(val, value)
+	}, int(count), fromTail)
+	if removed == 0 {
+		return reply.MakeIntegerReply(0)
+	}
+	if lst.Len() == 0 {
+		db.Remove(key)
+	} else {
+		db.PutEntity(key, &database.DataEntity{Data: lst})
+	}
+	db.addAof(utils.ToCmdLineWithName("LREM", args...))
+	return reply.MakeIntegerReply(int64(removed))
+}
+
+// execLTrim 函数实现了LTRIM命令，只保留列表中指定范围内的元素。
+// 命令格式：LTRIM key start stop，范围为空时删除整个列表
+func execLTrim(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	start, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeStandardErrorReply("value is not an integer or out of range")
+	}
+	stop, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return reply.MakeStandardErrorReply("value is not an integer or out of range")
+	}
+
+	lst, ok := getList(db, key)
+	if !ok {
+		return reply.MakeOKReply()
+	}
+	if lst == nil {
+		return reply.MakeWrongTypeErrReply()
+	}
+	size := int64(lst.Len())
+	if start < 0 {
+		start = max(size+start, 0)
+	}
+	if stop < 0 {
+		stop = size + stop
+	}
+	if start > stop || start >= size {
+		db.Remove(key)
+	} else {
+		lst.Trim(int(start), int(min(stop, size-1)))
+		db.PutEntity(key, &database.DataEntity{Data: lst})
+	}
+	db.addAof(utils.ToCmdLineWithName("LTRIM", args...))
+	return reply.MakeOKReply()
+}
+
+// execLPos 函数实现了LPOS命令，返回列表中等于 element 的元素的下标。
+// 命令格式：LPOS key element [RANK rank] [COUNT num-matches] [MAXLEN len]
+// rank 为负数时从尾部开始查找，count 为 0 时返回所有匹配，maxlen 限制比较的元素个数
+func execLPos(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	value := args[1]
+	rank, count, maxLen := int64(1), int64(0), int64(0)
+	hasCount := false
+	for i := 2; i < len(args); i += 2 {
+		option := strings.ToUpper(string(args[i]))
+		if i+1 >= len(args) || (option != "RANK" && option != "COUNT" && option != "MAXLEN") {
+			return reply.MakeSyntaxErrReply()
+		}
+		n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+		if err != nil {
+			return reply.MakeStandardErrorReply("value is not an integer or out of range")
+		}
+		switch option {
+		case "RANK":
+			if n == 0 {
+				return reply.MakeStandardErrorReply("RANK can't be zero: use 1 to start from the first match, " +
+					"2 from the second ... or use negative to start from the last match")
+			}
+			if n == math.MinInt64 {
+				return reply.MakeStandardErrorReply("value is out of range")
+			}
+			rank = n
+		case "COUNT":
+			if n < 0 {
+				return reply.MakeStandardErrorReply("COUNT can't be negative")
+			}
+			count, hasCount = n, true
+		case "MAXLEN":
+			if n < 0 {
+				return reply.MakeStandardErrorReply("MAXLEN can't be negative")
+			}
+			maxLen = n
+		}
+	}
+
+	lst, ok := getList(db, key)
+	if lst == nil && ok {
+		return reply.MakeWrongTypeErrReply()
+	}
+	if !ok {
+		if hasCount {
+			return reply.MakeEmptyMultiBulkReply()
+		}
+		return reply.MakeNullReply()
+	}
+
+	// 跳过前 |rank|-1 个匹配，收集之后的匹配，最多比较 maxlen 个元素
+	skip := rank - 1
+	if rank < 0 {
+		skip = -rank - 1
+	}
+	wanted := count
+	if !hasCount {
+		wanted = 1
+	}
+	positions := make([]int64, 0)
+	var compared int64
+	consumer := func(i int, val []byte) bool {
+		if maxLen > 0 && compared >= maxLen {
+			return false
+		}
+		compared++
+		if bytes.Equal(val, value) {
+			if skip > 0 {
+				skip--
+			} else {
+				positions = append(positions, int64(i))
+				if wanted > 0 && int64(len(positions)) >= wanted {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	if rank > 0 {
+		lst.ForEach(0, consumer)
+	} else {
+		lst.ReverseForEach(lst.Len()-1, consumer)
+	}
+
+	if hasCount {
+		replies := make([]resp.Reply, len(positions))
+		for i, pos := range positions {
+			replies[i] = reply.MakeIntegerReply(pos)
+		}
+		return reply.MakeMultiRawReply(replies)
+	}
+	if len(positions) == 0 {
+		return reply.MakeNullReply()
+	}
+	return reply.MakeIntegerReply(positions[0])
+}
+
+// parseListSide 解析 LEFT|RIGHT 参数，返回是否为 LEFT
+func parseListSide(arg []byte) (bool, reply.ErrorReply) {
+	switch strings.ToUpper(string(arg)) {
+	case "LEFT":
+		return true, nil
+	case "RIGHT":
+		return false, nil
+	}
+	return false, reply.MakeSyntaxErrReply()
+}
+
+// popElements 从列表的头部或尾部弹出最多 count 个元素，列表变空时删除键。
+// AOF 中记录的是实际发生的 LPOP/RPOP，而不是阻塞命令本身
+func popElements(db *DB, key string, lst *list.QuickList, fromLeft bool, count int) [][]byte {
+	popCmd := "RPOP"
+	if fromLeft {
+		popCmd = "LPOP"
+	}
+	values := make([][]byte, 0, min(count, lst.Len()))
+	for len(values) < count && lst.Len() > 0 {
+		if fromLeft {
+			values = append(values, lst.PopFront())
+		} else {
+			values = append(values, lst.PopBack())
+		}
+	}
+	if len(values) == 1 {
+		db.addAof(utils.ToCmdLine(popCmd, key))
+	} else {
+		db.addAof(utils.ToCmdLine(popCmd, key, strconv.Itoa(len(values))))
+	}
+	if lst.Len() == 0 {
+		db.Remove(key)
+	} else {
+		db.PutEntity(key, &database.DataEntity{Data: lst})
+	}
+	return values
+}
+
+// sideName 返回 LEFT 或 RIGHT
+func sideName(left bool) string {
+	if left {
+		return "LEFT"
+	}
+	return "RIGHT"
+}
+
+// moveElement 将源列表一端的元素移动到目标列表的一端，源列表和目标列表可以是同一个键。
+// 源列表不存在时返回 nil，两边的修改在 AOF 中记录为一条 LMOVE
+func moveElement(db *DB, src string, dst string, fromLeft bool, toLeft bool) ([]byte, reply.ErrorReply) {
+	srcList, ok := getList(db, src)
+	if !ok {
+		return nil, nil
+	}
+	if srcList == nil {
+		return nil, reply.MakeWrongTypeErrReply()
+	}
+	// 目标键的类型在弹出之前检查，出错时源列表保持不变
+	dstList, _ := getList(db, dst)
+	if dstList == nil {
+		return nil, reply.MakeWrongTypeErrReply()
+	}
+	if src == dst {
+		dstList = srcList
+	}
+
+	var value []byte
+	if fromLeft {
+		value = srcList.PopFront()
+	} else {
+		value = srcList.PopBack()
+	}
+	if toLeft {
+		dstList.PushFront(value)
+	} else {
+		dstList.PushBack(value)
+	}
+	if srcList.Len() == 0 {
+		db.Remove(src)
+	} else if src != dst {
+		db.PutEntity(src, &database.DataEntity{Data: srcList})
+	}
+	db.PutEntity(dst, &database.DataEntity{Data: dstList})
+	db.addAof(utils.ToCmdLine("LMOVE", src, dst, sideName(fromLeft), sideName(toLeft)))
+	return value, nil
+}
+
+// execLMove 函数实现了LMOVE命令，原子地将源列表一端的元素移动到目标列表的一端。
+// 命令格式：LMOVE source destination LEFT|RIGHT LEFT|RIGHT
+func execLMove(db *DB, args [][]byte) resp.Reply {
+	fromLeft, errReply := parseListSide(args[2])
+	if errReply != nil {
+		return errReply
+	}
+	toLeft, errReply := parseListSide(args[3])
+	if errReply != nil {
+		return errReply
+	}
+	value, errReply := moveElement(db, string(args[0]), string(args[1]), fromLeft, toLeft)
+	if errReply != nil {
+		return errReply
+	}
+	if value == nil {
+		return reply.MakeNullReply()
+	}
+	return reply.MakeBulkReply(value)
+}
+
+// execRPopLPush 函数实现了RPOPLPUSH命令，等价于 LMOVE source destination RIGHT LEFT。
+// 命令格式：RPOPLPUSH source destination
+func execRPopLPush(db *DB, args [][]byte) resp.Reply {
+	value, errReply := moveElement(db, string(args[0]), string(args[1]), false, true)
+	if errReply != nil {
+		return errReply
+	}
+	if value == nil {
+		return reply.MakeNullReply()
+	}
+	return reply.MakeBulkReply(value)
+}
+
+// prepareMoveList LMOVE、RPOPLPUSH 和 BLMOVE 写入源键和目标键
+func prepareMoveList(args [][]byte) ([]string, []string) {
+	return toKeys(args[:2]), nil
+}
+
+// blockingPop 实现 BLPOP 和 BRPOP 的一次尝试：从第一个非空列表中弹出一个元素。
+// 所有列表都为空时返回空数组，连接的阻塞由 StandaloneDatabase 处理
+func blockingPop(db *DB, args [][]byte, fromLeft bool) resp.Reply {
+	if _, errReply := parseBlockTimeout(args[len(args)-1]); errReply != nil {
+		return errReply
+	}
+	for _, arg := range args[:len(args)-1] {
+		key := string(arg)
+		lst, ok := getList(db, key)
+		if !ok {
+			continue
+		}
+		if lst == nil {
+			return reply.MakeWrongTypeErrReply()
+		}
+		values := popElements(db, key, lst, fromLeft, 1)
+		return reply.MakeMultiBulkReply([][]byte{arg, values[0]})
+	}
+	return reply.MakeNullMultiBulkReply()
+}
+
+// execBLPop 函数实现了BLPOP命令，弹出第一个非空列表的头部元素，所有列表都为空时阻塞连接。
+// 命令格式：BLPOP key [key ...] timeout
+func execBLPop(db *DB, args [][]byte) resp.Reply {
+	return blockingPop(db, args, true)
+}
+
+// execBRPop 函数实现了BRPOP命令，弹出第一个非空列表的尾部元素，所有列表都为空时阻塞连接。
+// 命令格式：BRPOP key [key ...] timeout
+func execBRPop(db *DB, args [][]byte) resp.Reply {
+	return blockingPop(db, args, false)
+}
+
+// prepareBlockingPop BLPOP 和 BRPOP 写入除最后的超时时间之外的所有参数
+func prepareBlockingPop(args [][]byte) ([]string, []string) {
+	return toKeys(args[:len(args)-1]), nil
+}
+
+// execBLMove 函数实现了BLMOVE命令，将源列表一端的元素移动到目标列表的一端，源列表为空时阻塞连接。
+// 命令格式：BLMOVE source destination LEFT|RIGHT LEFT|RIGHT timeout
+func execBLMove(db *DB, args [][]byte) resp.Reply {
+	src, dst := string(args[0]), string(args[1])
+	fromLeft, errReply := parseListSide(args[2])
+	if errReply != nil {
+		return errReply
+	}
+	toLeft, errReply := parseListSide(args[3])
+	if errReply != nil {
+		return errReply
+	}
+	if _, errReply := parseBlockTimeout(args[4]); errReply != nil {
+		return errReply
+	}
+
+	value, errReply := moveElement(db, src, dst, fromLeft, toLeft)
+	if errReply != nil {
+		return errReply
+	}
+	if value == nil {
+		return reply.MakeNullMultiBulkReply()
+	}
+	return reply.MakeBulkReply(value)
+}
+
+// parseMPopArgs 解析 numkeys key [key ...] LEFT|RIGHT [COUNT count]，BLMPOP 和 LMPOP 共用
+func parseMPopArgs(args [][]byte) (keys []string, fromLeft bool, count int, errReply reply.ErrorReply) {
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil || numKeys <= 0 {
+		return nil, false, 0, reply.MakeStandardErrorReply("numkeys should be greater than 0")
+	}
+	if numKeys > len(args)-2 {
+		return nil, false, 0, reply.MakeStandardErrorReply("Number of keys can't be greater than number of args")
+	}
+	keys = toKeys(args[1 : numKeys+1])
+	rest := args[numKeys+1:]
+	if fromLeft, errReply = parseListSide(rest[0]); errReply != nil {
+		return nil, false, 0, errReply
+	}
+	count = 1
+	if len(rest) > 1 {
+		if len(rest) != 3 || strings.ToUpper(string(rest[1])) != "COUNT" {
+			return nil, false, 0, reply.MakeSyntaxErrReply()
+		}
+		count, err = strconv.Atoi(string(rest[2]))
+		if err != nil || count <= 0 {
+			return nil, false, 0, reply.MakeStandardErrorReply("count should be greater than 0")
+		}
+	}
+	return keys, fromLeft, count, nil
+}
+
+// mpop 从第一个非空列表中弹出最多 count 个元素，返回键和弹出的元素，所有列表都为空时返回空数组
+func mpop(db *DB, keys []string, fromLeft bool, count int) resp.Reply {
+	for _, key := range keys {
+		lst, ok := getList(db, key)
+		if !ok {
+			continue
+		}
+		if lst == nil {
+			return reply.MakeWrongTypeErrReply()
+		}
+		values := popElements(db, key, lst, fromLeft, count)
+		return reply.MakeMultiRawReply([]resp.Reply{
+			reply.MakeBulkReply([]byte(key)),
+			reply.MakeMultiBulkReply(values),
+		})
+	}
+	return reply.MakeNullMultiBulkReply()
+}
+
+// execLMPop 函数实现了LMPOP命令，从第一个非空列表中弹出最多 count 个元素。
+// 命令格式：LMPOP numkeys key [key ...] LEFT|RIGHT [COUNT count]
+func execLMPop(db *DB, args [][]byte) resp.Reply {
+	keys, fromLeft, count, errReply := parseMPopArgs(args)
+	if errReply != nil {
+		return errReply
+	}
+	return mpop(db, keys, fromLeft, count)
+}
+
+// prepareLMPop LMPOP 写入 numkeys 之后的键，参数错误时不加锁，由命令本身返回错误
+func prepareLMPop(args [][]byte) ([]string, []string) {
+	keys, _, _, errReply := parseMPopArgs(args)
+	if errReply != nil {
+		return nil, nil
+	}
+	return keys, nil
+}
+
+// execBLMPop 函数实现了BLMPOP命令，从第一个非空列表中弹出最多 count 个元素，所有列表都为空时阻塞连接。
+// 命令格式：BLMPOP timeout numkeys key [key ...] LEFT|RIGHT [COUNT count]
+func execBLMPop(db *DB, args [][]byte) resp.Reply {
+	if _, errReply := parseBlockTimeout(args[0]); errReply != nil {
+		return errReply
+	}
+	keys, fromLeft, count, errReply := parseMPopArgs(args[1:])
+	if errReply != nil {
+		return errReply
+	}
+	return mpop(db, keys, fromLeft, count)
+}
+
+// prepareBLMPop BLMPOP 的键在超时时间之后
+func prepareBLMPop(args [][]byte) ([]string, []string) {
+	return prepareLMPop(args[1:])
+}
+
 func init() {
 	// 注册命令
-	RegisterCommand("LPUSH", execLPush, -3)  // 命令格式：key value [value ...]，至少3个参数
-	RegisterCommand("RPUSH", execRPush, -3)  // 命令格式：key value [value ...]，至少3个参数
-	RegisterCommand("LPOP", execLPop, 2)     // 命令格式：key，2个参数
-	RegisterCommand("RPOP", execRPop, 2)     // 命令格式：key，2个参数
-	RegisterCommand("LRANGE", execLRange, 4) // 命令格式：key start stop，4个参数
-	RegisterCommand("LLEN", execLLen, 2)     // 命令格式：LLEN key，2个参数
-	RegisterCommand("LINDEX", execLIndex, 3) // 命令格式：LINDEX key index，3个参数
-	RegisterCommand("LSET", execLSet, 4)     // 命令格式：LSET key index value，4个参数
+	RegisterCommand("LPUSH", execLPush, writeFirstKey, -3) // 命令格式：key value [value ...]，至少3个参数
+	RegisterCommand("RPUSH", execRPush, writeFirstKey, -3) // 命令格式：key value [value ...]，至少3个参数
+	RegisterCommand("LPOP", execLPop, writeFirstKey, -2)   // 命令格式：key [count]，至少2个参数
+	RegisterCommand("RPOP", execRPop, writeFirstKey, -2)   // 命令格式：key [count]，至少2个参数
+	RegisterCommand("LRANGE", execLRange, readFirstKey, 4) // 命令格式：key start stop，4个参数
+	RegisterCommand("LLEN", execLLen, readFirstKey, 2)     // 命令格式：LLEN key，2个参数
+	RegisterCommand("LINDEX", execLIndex, readFirstKey, 3) // 命令格式：LINDEX key index，3个参数
+	RegisterCommand("LSET", execLSet, writeFirstKey, 4)    // 命令格式：LSET key index value，4个参数
+
+	RegisterCommand("LPUSHX", execLPushX, writeFirstKey, -3)  // 命令格式：LPUSHX key value [value ...]，至少3个参数
+	RegisterCommand("RPUSHX", execRPushX, writeFirstKey, -3)  // 命令格式：RPUSHX key value [value ...]，至少3个参数
+	RegisterCommand("LINSERT", execLInsert, writeFirstKey, 5) // 命令格式：LINSERT key BEFORE|AFTER pivot element，5个参数
+	RegisterCommand("LREM", execLRem, writeFirstKey, 4)       // 命令格式：LREM key count element，4个参数
+	RegisterCommand("LTRIM", execLTrim, writeFirstKey, 4)     // 命令格式：LTRIM key start stop，4个参数
+	RegisterCommand("LPOS", execLPos, readFirstKey, -3)       // 命令格式：LPOS key element [RANK rank] [COUNT num-matches] [MAXLEN len]，至少3个参数
+
+	RegisterCommand("LMOVE", execLMove, prepareMoveList, 5)         // 命令格式：LMOVE source destination LEFT|RIGHT LEFT|RIGHT，5个参数
+	RegisterCommand("RPOPLPUSH", execRPopLPush, prepareMoveList, 3) // 命令格式：RPOPLPUSH source destination，3个参数
+	RegisterCommand("LMPOP", execLMPop, prepareLMPop, -4)           // 命令格式：LMPOP numkeys key [key ...] LEFT|RIGHT [COUNT count]，至少4个参数
+
+	RegisterCommand("BLPOP", execBLPop, prepareBlockingPop, -3) // 命令格式：BLPOP key [key ...] timeout，至少3个参数
+	RegisterCommand("BRPOP", execBRPop, prepareBlockingPop, -3) // 命令格式：BRPOP key [key ...] timeout，至少3个参数
+	RegisterCommand("BLMOVE", execBLMove, prepareMoveList, 6)   // 命令格式：BLMOVE source destination LEFT|RIGHT LEFT|RIGHT timeout，6个参数
+	RegisterCommand("BLMPOP", execBLMPop, prepareBLMPop, -5)    // 命令格式：BLMPOP timeout numkeys key [key ...] LEFT|RIGHT [COUNT count]，至少5个参数
 }
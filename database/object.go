@@ -0,0 +1,116 @@
+package database
+
+import (
+	"goredis/config"
+	"goredis/datastruct/hash"
+	"goredis/datastruct/list"
+	"goredis/datastruct/set"
+	"goredis/datastruct/zset"
+	"goredis/interface/database"
+	"goredis/interface/resp"
+	"goredis/resp/reply"
+	"strings"
+)
+
+// embstrMaxLen is the longest string reported with the embstr encoding
+const embstrMaxLen = 44
+
+func init() {
+	RegisterCommand("OBJECT", execObject, prepareObject, -2)
+}
+
+// prepareObject reads the key given after the subcommand
+func prepareObject(args [][]byte) ([]string, []string) {
+	if len(args) < 2 {
+		return nil, nil
+	}
+	return nil, []string{string(args[1])}
+}
+
+// object: OBJECT ENCODING|IDLETIME|FREQ|REFCOUNT key, OBJECT HELP
+func execObject(db *DB, args [][]byte) resp.Reply {
+	subCommand := strings.ToUpper(string(args[0]))
+	if subCommand == "HELP" && len(args) == 1 {
+		return reply.MakeMultiBulkReply([][]byte{
+			[]byte("OBJECT <subcommand> [<arg> [value] [opt] ...]. Subcommands are:"),
+			[]byte("ENCODING <key>"),
+			[]byte("    Return the kind of internal representation used in order to store the value"),
+			[]byte("    associated with a <key>."),
+			[]byte("FREQ <key>"),
+			[]byte("    Return the access frequency index of the <key>. The returned integer is"),
+			[]byte("    proportional to the logarithm of the recent access frequency of the key."),
+			[]byte("IDLETIME <key>"),
+			[]byte("    Return the idle time of the <key>, that is the approximated number of"),
+			[]byte("    seconds elapsed since the last access to the key."),
+			[]byte("REFCOUNT <key>"),
+			[]byte("    Return the number of references of the value associated with the specified"),
+			[]byte("    <key>."),
+		})
+	}
+	if len(args) != 2 {
+		return reply.MakeStandardErrorReply("unknown subcommand or wrong number of arguments for '" +
+			string(args[0]) + "'. Try OBJECT HELP.")
+	}
+
+	key := string(args[1])
+	// inspecting a key is not an access, so it must not update the idle time and frequency
+	entity, ok := db.peekEntity(key)
+	if !ok {
+		return reply.MakeNullReply()
+	}
+	lfu := strings.HasSuffix(config.Properties.MaxMemoryPolicy, "-lfu")
+	switch subCommand {
+	case "ENCODING":
+		return reply.MakeBulkReply([]byte(encodingOf(entity)))
+	case "IDLETIME":
+		if lfu {
+			return reply.MakeStandardErrorReply("An LFU maxmemory policy is selected, idle time not tracked. " +
+				"Please note that when switching between policies at runtime LRU and LFU data will take some time to adjust.")
+		}
+		return reply.MakeIntegerReply(int64(entity.IdleTime().Seconds()))
+	case "FREQ":
+		if !lfu {
+			return reply.MakeStandardErrorReply("An LFU maxmemory policy is not selected, access frequency not tracked. " +
+				"Please note that when switching between policies at runtime LRU and LFU data will take some time to adjust.")
+		}
+		return reply.MakeIntegerReply(int64(entity.Frequency()))
+	case "REFCOUNT":
+		// values are never shared between keys
+		return reply.MakeIntegerReply(1)
+	}
+	return reply.MakeStandardErrorReply("unknown subcommand or wrong number of arguments for '" +
+		string(args[0]) + "'. Try OBJECT HELP.")
+}
+
+// typeOf returns the type name of the value, as reported by TYPE
+func typeOf(entity *database.DataEntity) string {
+	switch entity.Data.(type) {
+	case []byte, int64:
+		return "string"
+	case *list.QuickList:
+		return "list"
+	case *hash.Hash:
+		return "hash"
+	case set.Set:
+		return "set"
+	case zset.ZSet:
+		return "zset"
+	}
+	return "unknown"
+}
+
+// encodingOf returns the internal encoding of the value, as reported by OBJECT ENCODING
+func encodingOf(entity *database.DataEntity) string {
+	switch val := entity.Data.(type) {
+	case int64:
+		return "int"
+	case []byte:
+		if len(val) <= embstrMaxLen {
+			return "embstr"
+		}
+		return "raw"
+	case database.Encodable:
+		return val.ObjectEncoding()
+	}
+	return "unknown"
+}
@@ -1,14 +1,48 @@
 package database
 
 import (
+	"goredis/config"
 	"goredis/datastruct/set"
 	"goredis/interface/database"
 	"goredis/interface/resp"
 	"goredis/lib/utils"
 	"goredis/resp/reply"
+	"math"
 	"strconv"
+	"strings"
 )
 
+// SSCAN 命令用于增量迭代集合中的成员
+// SSCAN key cursor [MATCH pattern] [COUNT count]
+func execSSCAN(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	cur, errReply := parseScanCursor(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	opts, errReply := parseScanOptions(args[2:], false, false)
+	if errReply != nil {
+		return errReply
+	}
+
+	setObj, errReply := getAsSet(db, key)
+	if errReply != nil {
+		return errReply
+	}
+	if setObj == nil {
+		return makeScanReply(0, nil) // 集合不存在，迭代直接结束
+	}
+
+	members, next := setObj.Scan(cur, opts.count)
+	result := make([][]byte, 0, len(members))
+	for _, member := range members {
+		if opts.match(member) {
+			result = append(result, []byte(member))
+		}
+	}
+	return makeScanReply(next, result)
+}
+
 // SADD 命令用于将一个或多个成员元素加入到集合中，已经存在于集合的成员元素将被忽略。
 // SADD key member1 [member2 ...]
 func execSADD(db *DB, args [][]byte) resp.Reply {
@@ -133,25 +167,109 @@ func execSREM(db *DB, args [][]byte) resp.Reply {
 				Data: setObj,
 			})
 		}
-		db.addAof(utils.ToCmdLineWithName("SERM", args...))
+		db.addAof(utils.ToCmdLineWithName("SREM", args...))
 	}
 	// 返回成功移除的成员数量
 	return reply.MakeIntegerReply(int64(count))
 }
 
-// SPOP 命令用于随机移除并返回集合中的一个成员
-// SPOP key
+// SMISMEMBER 命令用于判断多个成员是否是集合的成员
+// SMISMEMBER key member [member ...]
+func execSMIsMember(db *DB, args [][]byte) resp.Reply {
+	setObj, errReply := getAsSet(db, string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([]resp.Reply, len(args)-1)
+	if setObj == nil {
+		// 集合不存在，所有成员都不在集合中
+		for i := range result {
+			result[i] = reply.MakeIntegerReply(0)
+		}
+		return reply.MakeMultiRawReply(result)
+	}
+	for i, ok := range setObj.ContainsMany(toKeys(args[1:])) {
+		if ok {
+			result[i] = reply.MakeIntegerReply(1)
+		} else {
+			result[i] = reply.MakeIntegerReply(0)
+		}
+	}
+	return reply.MakeMultiRawReply(result)
+}
+
+// SMOVE 命令用于将成员从源集合移动到目标集合，成员已被移动时返回1，源集合中没有该成员时返回0
+// SMOVE source destination member
+func execSMove(db *DB, args [][]byte) resp.Reply {
+	src, dst := string(args[0]), string(args[1])
+	member := string(args[2])
+	srcSet, errReply := getAsSet(db, src)
+	if errReply != nil {
+		return errReply
+	}
+	// 源集合不存在时直接返回0，不检查目标键的类型
+	if srcSet == nil {
+		return reply.MakeIntegerReply(0)
+	}
+	// 源集合存在时，目标键的类型错误即使成员不存在也返回错误
+	dstSet, _, errReply := getOrInitSet(db, dst)
+	if errReply != nil {
+		return errReply
+	}
+	if !srcSet.Contains(member) {
+		return reply.MakeIntegerReply(0)
+	}
+	// 源集合和目标集合相同时不需要移动
+	if src == dst {
+		return reply.MakeIntegerReply(1)
+	}
+
+	srcSet.Remove(member)
+	if srcSet.Len() == 0 {
+		db.Remove(src) // 源集合为空时删除键
+	} else {
+		db.PutEntity(src, &database.DataEntity{
+			Data: srcSet,
+		})
+	}
+	dstSet.Add(member)
+	db.PutEntity(dst, &database.DataEntity{
+		Data: dstSet,
+	})
+	db.addAof(utils.ToCmdLineWithName("SMOVE", args...))
+	return reply.MakeIntegerReply(1)
+}
+
+// parseSetCount 解析 SPOP 和 SRANDMEMBER 的 count 参数
+func parseSetCount(arg []byte, allowNegative bool) (int64, reply.ErrorReply) {
+	count, err := strconv.ParseInt(string(arg), 10, 64)
+	if !allowNegative && (err != nil || count < 0) {
+		return 0, reply.MakeStandardErrorReply("value is out of range, must be positive")
+	}
+	if err != nil {
+		return 0, reply.MakeStandardErrorReply("value is not an integer or out of range")
+	}
+	if count < -math.MaxInt64/2 {
+		return 0, reply.MakeStandardErrorReply("value is out of range")
+	}
+	return count, nil
+}
+
+// SPOP 命令用于随机移除并返回集合中的成员，指定 count 时返回数组
+// SPOP key [count]
 func execSPOP(db *DB, args [][]byte) resp.Reply {
 	// 获取集合的key
 	key := string(args[0])
+	if len(args) > 2 {
+		return reply.MakeSyntaxErrReply()
+	}
 
 	// 默认要移除的成员数量为 1
-	count := 1
-	if len(args) >= 2 {
-		var err error
-		count, err = strToInt(string(args[1]))
-		if err != nil || count < 0 {
-			return reply.MakeStandardErrorReply("转换失败或者数量为负数")
+	count := int64(1)
+	if len(args) == 2 {
+		var errReply reply.ErrorReply
+		if count, errReply = parseSetCount(args[1], false); errReply != nil {
+			return errReply
 		}
 	}
 
@@ -160,46 +278,34 @@ func execSPOP(db *DB, args [][]byte) resp.Reply {
 	if errReply != nil {
 		return errReply
 	}
-	if setObj == nil || setObj.Len() == 0 {
-		return reply.MakeEmptyBulkReply()
+	if setObj == nil {
+		if len(args) == 1 {
+			return reply.MakeNullReply()
+		}
+		return reply.MakeEmptyMultiBulkReply()
 	}
-
 	// 如果count为0，返回空数组
 	if count == 0 {
-		return reply.MakeMultiBulkReply([][]byte{})
-	}
-
-	// 限制count的最大值
-	// 如果count大于集合的长度，则将count设置为集合的长度
-	if count > setObj.Len() {
-		count = setObj.Len()
+		return reply.MakeEmptyMultiBulkReply()
 	}
 
-	// 随机获取count个成员
-	members := setObj.RandomDistinctMembers(count)
+	// 随机获取count个成员，count大于集合的长度时返回所有成员
+	members := setObj.RandomDistinctMembers(int(min(count, int64(setObj.Len()))))
 	// 从集合中移除这些成员
 	for _, member := range members {
 		setObj.Remove(member)
 	}
 
 	// 如果集合为空，则从数据库中删除该key
-	// 否则更新数据库中的集合对象
 	if setObj.Len() == 0 {
 		db.Remove(key)
-	} else {
-		db.PutEntity(key, &database.DataEntity{
-			Data: setObj,
-		})
 	}
 
-	// 将SPOP命令添加到AOF日志中
-	cmdArgs := make([][]byte, 2)
-	cmdArgs[0] = []byte(key)
-	cmdArgs[1] = []byte(intToStr(count))
-	db.addAof(utils.ToCmdLineWithName("SPOP", cmdArgs...))
+	// 以 SREM 写入AOF日志，重放时删除的是同样的成员
+	db.addAof(utils.ToCmdLine(append([]string{"SREM", key}, members...)...))
 
-	// 如果count为1，则返回单个成员的回复
-	if count == 1 {
+	// 没有指定count时返回单个成员
+	if len(args) == 1 {
 		return reply.MakeBulkReply([]byte(members[0]))
 	}
 
@@ -209,66 +315,50 @@ func execSPOP(db *DB, args [][]byte) resp.Reply {
 		result[i] = []byte(member)
 	}
 	return reply.MakeMultiBulkReply(result)
-
 }
 
-// 将字符串转换为整数
-func strToInt(str string) (int, error) {
-	value, err := strconv.Atoi(str)
-	if err != nil {
-		return 0, err
-	}
-	return value, nil
-}
-
-// 将整数转换为字符串
-func intToStr(n int) string {
-	return strconv.Itoa(n)
-}
-
-// SRANDMEMBER 命令用于随机返回集合中的一个或多个成员
+// SRANDMEMBER 命令用于随机返回集合中的一个或多个成员，count 为负数时成员可以重复
+// SRANDMEMBER key [count]
 func execSRANDMEMBER(db *DB, args [][]byte) resp.Reply {
 	key := string(args[0])
+	if len(args) > 2 {
+		return reply.MakeSyntaxErrReply()
+	}
+
+	// 默认返回一个成员
+	count := int64(1)
+	if len(args) == 2 {
+		var errReply reply.ErrorReply
+		if count, errReply = parseSetCount(args[1], true); errReply != nil {
+			return errReply
+		}
+	}
 
 	// 从数据库中获取集合对象
 	setObj, errReply := getAsSet(db, key)
 	if errReply != nil {
 		return errReply
 	}
-	if setObj == nil || setObj.Len() == 0 {
-		return reply.MakeEmptyBulkReply()
+	if setObj == nil {
+		if len(args) == 1 {
+			return reply.MakeNullReply()
+		}
+		return reply.MakeEmptyMultiBulkReply()
 	}
 
-	// 默认返回一个成员
-	count := 1
-	withReplacement := false
-	if len(args) >= 2 {
-		var err error
-		count, err = strToInt(string(args[1]))
-		if err != nil {
-			return reply.MakeStandardErrorReply("ERR value is not an integer")
-		}
-		// 如果count为负数，则表示要返回的成员可以重复
-		if count < 0 {
-			withReplacement = true
-			count = -count
-		}
+	// 没有指定count时返回单个成员
+	if len(args) == 1 {
+		return reply.MakeBulkReply([]byte(setObj.RandomMembers(1)[0]))
 	}
 
-	// 如果count为0，返回空数组
+	// 如果count为负数，则表示要返回的成员可以重复
 	var members []string
-	if withReplacement {
-		members = setObj.RandomMembers(count)
+	if count < 0 {
+		members = setObj.RandomMembers(int(-count))
 	} else {
-		members = setObj.RandomDistinctMembers(count)
-	}
-
-	// 如果count为1，则返回单个成员的回复
-	if len(args) == 1 || (count == 1 && len(members) > 0) {
-		return reply.MakeBulkReply([]byte(members[0]))
+		members = setObj.RandomDistinctMembers(int(min(count, int64(setObj.Len()))))
 	}
 
-	// 否则返回多个成员的回复
 	result := make([][]byte, len(members))
 	for i, member := range members {
 		result[i] = []byte(member)
@@ -277,269 +367,254 @@ func execSRANDMEMBER(db *DB, args [][]byte) resp.Reply {
 }
 
 func init() {
-	RegisterCommand("SADD", execSADD, -3)
-	RegisterCommand("SCARD", execSCARD, 2)
-	RegisterCommand("SISMEMBER", execSISMEMBER, 3)
-	RegisterCommand("SMEMBERS", execSMEMBERS, 2)
-	RegisterCommand("SREM", execSREM, -3)
-	RegisterCommand("SPOP", execSPOP, -2)
-	RegisterCommand("SRANDMEMBER", execSRANDMEMBER, -2)
-
-	RegisterCommand("SUNION", execSUnion, -2)
-	RegisterCommand("SUNIONSTORE", execSUnionStore, -3)
-	RegisterCommand("SINTER", execSInter, -2)
-	RegisterCommand("SINTERSTORE", execSInterStore, -3)
-	RegisterCommand("SDIFF", execSDiff, -2)
-	RegisterCommand("SDIFFSTORE", execSDiffStore, -3)
+	RegisterCommand("SADD", execSADD, writeFirstKey, -3)
+	RegisterCommand("SCARD", execSCARD, readFirstKey, 2)
+	RegisterCommand("SISMEMBER", execSISMEMBER, readFirstKey, 3)
+	RegisterCommand("SMISMEMBER", execSMIsMember, readFirstKey, -3)
+	RegisterCommand("SMEMBERS", execSMEMBERS, readFirstKey, 2)
+	RegisterCommand("SREM", execSREM, writeFirstKey, -3)
+	RegisterCommand("SPOP", execSPOP, writeFirstKey, -2)
+	RegisterCommand("SRANDMEMBER", execSRANDMEMBER, readFirstKey, -2)
+	RegisterCommand("SSCAN", execSSCAN, readFirstKey, -3)
+	RegisterCommand("SMOVE", execSMove, prepareRename, 4)
+
+	RegisterCommand("SUNION", execSUnion, readAllKeys, -2)
+	RegisterCommand("SUNIONSTORE", execSUnionStore, prepareSetStore, -3)
+	RegisterCommand("SINTER", execSInter, readAllKeys, -2)
+	RegisterCommand("SINTERSTORE", execSInterStore, prepareSetStore, -3)
+	RegisterCommand("SINTERCARD", execSInterCard, prepareSInterCard, -3)
+	RegisterCommand("SDIFF", execSDiff, readAllKeys, -2)
+	RegisterCommand("SDIFFSTORE", execSDiffStore, prepareSetStore, -3)
 }
 
-func execSUnion(db *DB, args [][]byte) resp.Reply {
-	// Create empty result set
-	result := set.NewHashSet()
+// newSet creates an empty set with the encoding thresholds of the server
+func newSet() *set.HashSet {
+	return set.NewHashSet(setLimits())
+}
 
-	// Process each set
-	for _, arg := range args {
-		key := string(arg)
+// setLimits returns the set encoding thresholds of the server
+func setLimits() set.Limits {
+	return set.Limits{
+		MaxIntsetEntries:   config.Properties.SetMaxIntsetEntries,
+		MaxListpackEntries: config.Properties.SetMaxListpackEntries,
+		MaxListpackValue:   config.Properties.SetMaxListpackValue,
+	}
+}
+
+// storeSetResult stores the result of a *STORE command at dest in the most compact encoding that fits,
+// an empty result deletes dest
+func storeSetResult(db *DB, dest string, members []string) {
+	if len(members) == 0 {
+		db.Remove(dest)
+		return
+	}
+	db.PutEntity(dest, &database.DataEntity{
+		Data: set.NewHashSetFrom(setLimits(), members),
+	})
+}
+
+// membersReply converts the members of a set operation to a reply
+func membersReply(members []string) resp.Reply {
+	result := make([][]byte, len(members))
+	for i, member := range members {
+		result[i] = []byte(member)
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// unionSets returns the distinct members of the sets stored at keys, a missing key is an empty set
+func unionSets(db *DB, keys []string) ([]string, reply.ErrorReply) {
+	seen := make(map[string]struct{})
+	members := make([]string, 0)
+	for _, key := range keys {
 		setObj, errReply := getAsSet(db, key)
 		if errReply != nil {
-			return errReply
+			return nil, errReply
 		}
 		if setObj == nil {
 			continue
 		}
 
-		// Add all members to result
+		// Add the members not seen yet
 		setObj.ForEach(func(member string) bool {
-			result.Add(member)
+			if _, ok := seen[member]; !ok {
+				seen[member] = struct{}{}
+				members = append(members, member)
+			}
 			return true
 		})
 	}
+	return members, nil
+}
 
-	// Convert set to reply
-	members := result.Members()
-	resultBytes := make([][]byte, len(members))
-	for i, member := range members {
-		resultBytes[i] = []byte(member)
+// execSUnion implements SUNION key [key...]
+// Return the union of multiple sets
+func execSUnion(db *DB, args [][]byte) resp.Reply {
+	members, errReply := unionSets(db, toKeys(args))
+	if errReply != nil {
+		return errReply
 	}
-
-	return reply.MakeMultiBulkReply(resultBytes)
+	return membersReply(members)
 }
 
 // execSUnionStore implements SUNIONSTORE destination key [key...]
 // Store the union of multiple sets in a new set
 func execSUnionStore(db *DB, args [][]byte) resp.Reply {
-	destKey := string(args[0])
-	keys := args[1:]
-
-	// Execute union
-	unionReply := execSUnion(db, keys)
-	if _, ok := unionReply.(reply.ErrorReply); ok {
-		return unionReply
-	}
-
-	// Create new set with union result
-	unionResult := unionReply.(*reply.MultiBulkReply)
-	newSet := set.NewHashSet()
-	for _, member := range unionResult.Args {
-		newSet.Add(string(member))
+	members, errReply := unionSets(db, toKeys(args[1:]))
+	if errReply != nil {
+		return errReply
 	}
-
-	// Store set in database
-	db.PutEntity(destKey, &database.DataEntity{
-		Data: newSet,
-	})
+	storeSetResult(db, string(args[0]), members)
 
 	// Add to AOF
 	db.addAof(utils.ToCmdLineWithName("SUNIONSTORE", args...))
 
-	return reply.MakeIntegerReply(int64(newSet.Len()))
+	return reply.MakeIntegerReply(int64(len(members)))
 }
 
-// execSInter implements SINTER key [key...]
-// Return the intersection of multiple sets
-func execSInter(db *DB, args [][]byte) resp.Reply {
-	if len(args) == 0 {
-		return reply.MakeEmptyMultiBulkReply()
-	}
-
-	// Get first set as base
-	key := string(args[0])
-	firstSet, errReply := getAsSet(db, key)
-	if errReply != nil {
-		return errReply
-	}
-	if firstSet == nil {
-		return reply.MakeEmptyMultiBulkReply()
-	}
-
-	// Create result set with members of first set
-	result := set.NewHashSet()
-	firstSet.ForEach(func(member string) bool {
-		result.Add(member)
-		return true
-	})
-
-	// Intersect with each other set
-	for i := 1; i < len(args); i++ {
-		key := string(args[i])
-		currentSet, errReply := getAsSet(db, key)
+// intersectSets returns the intersection of the sets stored at keys, at most limit members if limit > 0.
+// A missing key is an empty set, so the intersection is empty
+func intersectSets(db *DB, keys []string, limit int) ([]string, reply.ErrorReply) {
+	sets := make([]set.Set, 0, len(keys))
+	empty := false
+	for _, key := range keys {
+		s, errReply := getAsSet(db, key)
 		if errReply != nil {
-			return errReply
-		}
-
-		// Empty set or key doesn't exist means empty intersection
-		if currentSet == nil {
-			return reply.MakeEmptyMultiBulkReply()
-		}
-
-		// Keep only members that exist in current set
-		toRemove := make([]string, 0)
-		result.ForEach(func(member string) bool {
-			if !currentSet.Contains(member) {
-				toRemove = append(toRemove, member)
-			}
-			return true
-		})
-
-		// Remove non-intersecting members
-		for _, member := range toRemove {
-			result.Remove(member)
+			return nil, errReply
 		}
-
-		// Early termination if result is already empty
-		if result.Len() == 0 {
-			return reply.MakeEmptyMultiBulkReply()
+		if s == nil {
+			// keep checking the types of the other keys
+			empty = true
+			continue
 		}
+		sets = append(sets, s)
 	}
-
-	// Convert result to reply
-	members := result.Members()
-	resultBytes := make([][]byte, len(members))
-	for i, member := range members {
-		resultBytes[i] = []byte(member)
+	if empty {
+		return []string{}, nil
 	}
+	return set.Intersect(limit, sets...), nil
+}
 
-	return reply.MakeMultiBulkReply(resultBytes)
+// execSInter implements SINTER key [key...]
+// Return the intersection of multiple sets
+func execSInter(db *DB, args [][]byte) resp.Reply {
+	members, errReply := intersectSets(db, toKeys(args), 0)
+	if errReply != nil {
+		return errReply
+	}
+	return membersReply(members)
 }
 
 // execSInterStore implements SINTERSTORE destination key [key...]
 // Store the intersection of multiple sets in a new set
 func execSInterStore(db *DB, args [][]byte) resp.Reply {
-	destKey := string(args[0])
-	keys := args[1:]
-
-	// Execute intersection
-	interReply := execSInter(db, keys)
-	if _, ok := interReply.(reply.ErrorReply); ok {
-		return interReply
-	}
-
-	// Create new set with intersection result
-	interResult, ok := interReply.(*reply.MultiBulkReply)
-	if !ok {
-		return reply.MakeEmptyMultiBulkReply()
-	}
-
-	newSet := set.NewHashSet()
-	for _, member := range interResult.Args {
-		newSet.Add(string(member))
+	members, errReply := intersectSets(db, toKeys(args[1:]), 0)
+	if errReply != nil {
+		return errReply
 	}
-
-	// Store set in database
-	db.PutEntity(destKey, &database.DataEntity{
-		Data: newSet,
-	})
+	storeSetResult(db, string(args[0]), members)
 
 	// Add to AOF
 	db.addAof(utils.ToCmdLineWithName("SINTERSTORE", args...))
 
-	return reply.MakeIntegerReply(int64(newSet.Len()))
+	return reply.MakeIntegerReply(int64(len(members)))
 }
 
-// execSDiff implements SDIFF key [key...]
-// Return the difference between sets
-func execSDiff(db *DB, args [][]byte) resp.Reply {
-	// Get first set as base
-	key := string(args[0])
-	firstSet, errReply := getAsSet(db, key)
+// execSInterCard implements SINTERCARD numkeys key [key ...] [LIMIT limit]
+// Return the size of the intersection, counting stops at limit if it is not 0
+func execSInterCard(db *DB, args [][]byte) resp.Reply {
+	keys, limit, errReply := parseSInterCardArgs(args)
 	if errReply != nil {
 		return errReply
 	}
-	if firstSet == nil {
-		return reply.MakeEmptyMultiBulkReply()
+	members, errReply := intersectSets(db, keys, limit)
+	if errReply != nil {
+		return errReply
 	}
+	return reply.MakeIntegerReply(int64(len(members)))
+}
 
-	// Create result set with members of first set
-	result := set.NewHashSet()
-	firstSet.ForEach(func(member string) bool {
-		result.Add(member)
-		return true
-	})
-
-	// Remove members that appear in subsequent sets
-	for i := 1; i < len(args); i++ {
-		key := string(args[i])
-		currentSet, errReply := getAsSet(db, key)
-		if errReply != nil {
-			return errReply
+func parseSInterCardArgs(args [][]byte) ([]string, int, reply.ErrorReply) {
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil || numKeys <= 0 {
+		return nil, 0, reply.MakeStandardErrorReply("numkeys should be greater than 0")
+	}
+	if numKeys > len(args)-1 {
+		return nil, 0, reply.MakeStandardErrorReply("Number of keys can't be greater than number of args")
+	}
+	keys := toKeys(args[1 : numKeys+1])
+	limit := 0
+	for rest := args[numKeys+1:]; len(rest) > 0; rest = rest[2:] {
+		if len(rest) < 2 || strings.ToUpper(string(rest[0])) != "LIMIT" {
+			return nil, 0, reply.MakeSyntaxErrReply()
 		}
-		if currentSet == nil {
-			continue
+		limit, err = strconv.Atoi(string(rest[1]))
+		if err != nil || limit < 0 {
+			return nil, 0, reply.MakeStandardErrorReply("LIMIT can't be negative")
 		}
+	}
+	return keys, limit, nil
+}
 
-		// Remove members that exist in current set
-		currentSet.ForEach(func(member string) bool {
-			result.Remove(member)
-			return true
-		})
+// prepareSInterCard reads the keys of SINTERCARD
+func prepareSInterCard(args [][]byte) ([]string, []string) {
+	keys, _, errReply := parseSInterCardArgs(args)
+	if errReply != nil {
+		return nil, nil
+	}
+	return nil, keys
+}
 
-		// Early termination if result is already empty
-		if result.Len() == 0 {
-			return reply.MakeEmptyMultiBulkReply()
+// diffSets returns the members of the first set that are not in any of the other sets,
+// a missing key is an empty set
+func diffSets(db *DB, keys []string) ([]string, reply.ErrorReply) {
+	sets := make([]set.Set, len(keys))
+	for i, key := range keys {
+		s, errReply := getAsSet(db, key)
+		if errReply != nil {
+			return nil, errReply
 		}
+		sets[i] = s
 	}
-
-	// Convert result to reply
-	members := result.Members()
-	resultBytes := make([][]byte, len(members))
-	for i, member := range members {
-		resultBytes[i] = []byte(member)
+	members := make([]string, 0)
+	if sets[0] == nil {
+		return members, nil
 	}
 
-	return reply.MakeMultiBulkReply(resultBytes)
+	// Keep the members of the first set that no other set contains
+	sets[0].ForEach(func(member string) bool {
+		for _, other := range sets[1:] {
+			if other != nil && other.Contains(member) {
+				return true
+			}
+		}
+		members = append(members, member)
+		return true
+	})
+	return members, nil
+}
+
+// execSDiff implements SDIFF key [key...]
+// Return the difference between sets
+func execSDiff(db *DB, args [][]byte) resp.Reply {
+	members, errReply := diffSets(db, toKeys(args))
+	if errReply != nil {
+		return errReply
+	}
+	return membersReply(members)
 }
 
 // execSDiffStore implements SDIFFSTORE destination key [key...]
 // Store the difference between sets in a new set
 func execSDiffStore(db *DB, args [][]byte) resp.Reply {
-	destKey := string(args[0])
-	keys := args[1:]
-
-	// Execute difference
-	diffReply := execSDiff(db, keys)
-	if _, ok := diffReply.(reply.ErrorReply); ok {
-		return diffReply
-	}
-
-	// Create new set with difference result
-	diffResult, ok := diffReply.(*reply.MultiBulkReply)
-	if !ok {
-		return reply.MakeIntegerReply(0)
-	}
-
-	newSet := set.NewHashSet()
-	for _, member := range diffResult.Args {
-		newSet.Add(string(member))
+	members, errReply := diffSets(db, toKeys(args[1:]))
+	if errReply != nil {
+		return errReply
 	}
-
-	// Store set in database
-	db.PutEntity(destKey, &database.DataEntity{
-		Data: newSet,
-	})
+	storeSetResult(db, string(args[0]), members)
 
 	// Add to AOF
 	db.addAof(utils.ToCmdLineWithName("SDIFFSTORE", args...))
 
-	return reply.MakeIntegerReply(int64(newSet.Len()))
+	return reply.MakeIntegerReply(int64(len(members)))
 }
-
@@ -9,16 +9,31 @@ import (
 	"goredis/config"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
+// expireSweepInterval is the interval of the background active expire cycle
+const expireSweepInterval = 100 * time.Millisecond
+
 type StandaloneDatabase struct {
 	dbSet      []*DB
 	aofHandler *aof.AofHandler // AofHandler is used to handle AOF (Append Only File) operations.
 	//addAof     func(CmdLine)   // addAof is a function to add commands to AOF.
+	closed chan struct{} // closed is closed to stop background goroutines
+	// mu is held by every command, and exclusively by SWAPDB and FLUSHALL which change all dbs
+	mu sync.RWMutex
+	// blocking keeps the connections blocked by BLPOP and the like
+	blocking *blockingRegistry
+	// txAof collects the aof lines of a transaction running on several dbs, it is only set while mu is held exclusively
+	txAof func(dbIndex int, lines ...CmdLine)
 }
 
 func NewStandaloneDatabase() *StandaloneDatabase {
-	database := &StandaloneDatabase{}
+	database := &StandaloneDatabase{
+		closed:   make(chan struct{}),
+		blocking: makeBlockingRegistry(),
+	}
 	if config.Properties.Databases == 0 {
 		config.Properties.Databases = 16
 	}
@@ -29,6 +44,14 @@ func NewStandaloneDatabase() *StandaloneDatabase {
 		db.index = i
 		database.dbSet[i] = db
 	}
+	evictor := makeEvictor(database.dbSet)
+	for _, db := range database.dbSet {
+		db.freeMemory = evictor.freeMemory
+		index := db.index
+		db.signalReady = func(key string) {
+			database.blocking.signal(index, key)
+		}
+	}
 //	fmt.Println("appendonly:", config.Properties.AppendOnly)
 //	fmt.Println("appendfilename:", config.Properties.AppendFilename)
 	if config.Properties.AppendOnly {
@@ -41,15 +64,47 @@ func NewStandaloneDatabase() *StandaloneDatabase {
 
 		for _, db := range database.dbSet {
 			sdb := db
-			sdb.addAof = func(line CmdLine) {
-				database.aofHandler.AddCommand(sdb.index, line)
+			sdb.addAof = func(lines ...CmdLine) {
+				database.addAof(sdb.index, lines...)
 			}
 		}
 	}
+	database.startExpireSweeper()
 
 	return database
 }
 
+// addAof sends the aof lines of a db to the aof handler, or to the transaction running on several dbs
+func (d *StandaloneDatabase) addAof(dbIndex int, lines ...CmdLine) {
+	if d.txAof != nil {
+		d.txAof(dbIndex, lines...)
+		return
+	}
+	d.aofHandler.AddCommand(dbIndex, lines...)
+}
+
+// startExpireSweeper periodically removes expired keys and hash fields of every db,
+// so that keys that are never accessed again do not stay in memory
+func (d *StandaloneDatabase) startExpireSweeper() {
+	ticker := time.NewTicker(expireSweepInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				d.mu.RLock()
+				for _, db := range d.dbSet {
+					db.activeExpireCycle()
+					db.activeExpireHashFields()
+				}
+				d.mu.RUnlock()
+			case <-d.closed:
+				return
+			}
+		}
+	}()
+}
+
 func execSelect(c resp.Connection, database *StandaloneDatabase, args [][]byte) resp.Reply {
 	dbIndex, err := strconv.Atoi(string(args[0]))
 	if err != nil {
@@ -69,22 +124,91 @@ func (d *StandaloneDatabase) Exec(client resp.Connection, args [][]byte) resp.Re
 			logger.Error("Database Exec panic:" + err.(error).Error())
 		}
 	}()
+	result := d.exec(client, args)
+	// connections blocked on the keys the command pushed to are served before it replies
+	d.serveBlocked()
+	return result
+}
+
+func (d *StandaloneDatabase) exec(client resp.Connection, args [][]byte) resp.Reply {
 	cmdName := strings.ToLower(string(args[0]))
+	crossDB := isCrossDB(cmdName, args, client.GetDBIndex())
+	if !client.InMultiState() {
+		// they take the exclusive lock by themselves
+		switch cmdName {
+		case "swapdb":
+			return execSwapDB(d, args)
+		case "flushall":
+			return execFlushAll(d, args)
+		}
+	} else if cmdName == "exec" && len(args) == 1 && execLocksAll(client) {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return d.execMulti(d.dbSet[client.GetDBIndex()], client)
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	// Get the current database index from the client connection
+	db := d.dbSet[client.GetDBIndex()]
+	switch cmdName {
+	case "multi":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return startMulti(client)
+	case "discard":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return d.discardMulti(client)
+	case "exec":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return d.execMulti(db, client)
+	case "watch":
+		if len(args) < 2 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return execWatch(db, client, args[1:])
+	case "unwatch":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		d.unwatchAll(client)
+		return reply.MakeOKReply()
+	}
+	if client.InMultiState() {
+		return enqueueCmd(client, args)
+	}
 	if cmdName == "select" {
 		if len(args) != 2 {
 			return reply.MakeArgNumErrReply("select")
 		}
 		return execSelect(client, d, args[1:])
 	}
-	// Get the current database index from the client connection
-	db := d.dbSet[client.GetDBIndex()]
+	if crossDB {
+		switch cmdName {
+		case "move":
+			return execMove(d, db, args)
+		case "copy":
+			return execCopyAcross(d, db, args)
+		}
+	}
+	if blockingCmds[cmdName] {
+		return d.execBlocking(db, client, args)
+	}
 	return db.Exec(client, args)
 }
 
+// AfterClientClose unblocks the connection if it is waiting in a blocking command and forgets its watched keys
 func (d *StandaloneDatabase) AfterClientClose(c resp.Connection) {
-
+	d.blocking.cancel(c)
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	d.unwatchAll(c)
 }
 
 func (d *StandaloneDatabase) Close() {
-
+	close(d.closed)
 }
@@ -1,51 +1,201 @@
 package database
 
 import (
+	"bytes"
 	"goredis/interface/database"
 	"goredis/interface/resp"
 	"goredis/lib/utils"
 	"goredis/resp/reply"
+	"math"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func init() {
-	RegisterCommand("GET", execGet, 2)
-	RegisterCommand("SET", execSet, 3)
-	RegisterCommand("SETNX", execSetNX, 3)
-	RegisterCommand("GETSET", execGetSet, 3)
-	RegisterCommand("STRLEN", execStrlen, 2)
+	RegisterCommand("GET", execGet, readFirstKey, 2)
+	RegisterCommand("SET", execSet, writeFirstKey, -3)
+	RegisterCommand("SETNX", execSetNX, writeFirstKey, 3)
+	RegisterCommand("GETSET", execGetSet, writeFirstKey, 3)
+	RegisterCommand("STRLEN", execStrlen, readFirstKey, 2)
+	RegisterCommand("INCR", execIncr, writeFirstKey, 2)
+	RegisterCommand("DECR", execDecr, writeFirstKey, 2)
+	RegisterCommand("INCRBY", execIncrBy, writeFirstKey, 3)
+	RegisterCommand("DECRBY", execDecrBy, writeFirstKey, 3)
+	RegisterCommand("INCRBYFLOAT", execIncrByFloat, writeFirstKey, 3)
+	RegisterCommand("MGET", execMGet, readAllKeys, -2)
+	RegisterCommand("MSET", execMSet, prepareMSet, -3)
+	RegisterCommand("MSETNX", execMSetNX, prepareMSet, -3)
+	RegisterCommand("APPEND", execAppend, writeFirstKey, 3)
+	RegisterCommand("GETRANGE", execGetRange, readFirstKey, 4)
+	RegisterCommand("SETRANGE", execSetRange, writeFirstKey, 4)
+	RegisterCommand("GETDEL", execGetDel, writeFirstKey, 2)
+	RegisterCommand("GETEX", execGetEx, writeFirstKey, -2)
+	RegisterCommand("LCS", execLCS, prepareLCS, -3)
+}
+
+// maxStringSize is the largest string SETRANGE may create, as proto-max-bulk-len of redis
+const maxStringSize = 512 * 1024 * 1024
+
+// prepareMSet writes the keys of the key value pairs
+func prepareMSet(args [][]byte) ([]string, []string) {
+	keys := make([]string, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		keys = append(keys, string(args[i]))
+	}
+	return keys, nil
+}
+
+// prepareLCS reads the two keys given before the options
+func prepareLCS(args [][]byte) ([]string, []string) {
+	return nil, []string{string(args[0]), string(args[1])}
+}
+
+// getAsString returns the value of a string key, it returns nil if the key does not exist.
+// The value is the stored slice which SETBIT and the like modify in place, a reply is written
+// after the key is unlocked, so a reply returning the value must copy it.
+func (db *DB) getAsString(key string) ([]byte, reply.ErrorReply) {
+	entity, ok := db.GetEntity(key)
+	if !ok {
+		return nil, nil
+	}
+	value, ok := entity.StringValue()
+	if !ok {
+		return nil, reply.MakeWrongTypeErrReply()
+	}
+	return value, nil
 }
 
 // get:get key
 func execGet(db *DB, args [][]byte) resp.Reply {
 	key := string(args[0])
-	if entity, ok := db.GetEntity(key); ok {
-		return reply.MakeBulkReply(entity.Data.([]byte))
+	value, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
 	}
-	return reply.MakeNullReply()
+	if value == nil {
+		return reply.MakeNullReply()
+	}
+	return reply.MakeBulkReply(bytes.Clone(value))
+}
+
+// conditions of SET
+const (
+	upsertPolicy = iota // default
+	insertPolicy        // NX, set only if the key does not exist
+	updatePolicy        // XX, set only if the key exists
+)
+
+// parseExpireOption converts the argument of EX, PX, EXAT or PXAT to an absolute unix time in milliseconds
+func parseExpireOption(opt string, arg []byte, cmdName string) (int64, reply.ErrorReply) {
+	n, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		return 0, reply.MakeStandardErrorReply("value is not an integer or out of range")
+	}
+	invalid := reply.MakeStandardErrorReply("invalid expire time in '" + cmdName + "' command")
+	if n <= 0 || ((opt == "EX" || opt == "EXAT") && n > math.MaxInt64/1000) {
+		return 0, invalid
+	}
+	if opt == "EX" || opt == "EXAT" {
+		n *= 1000
+	}
+	if opt == "EX" || opt == "PX" {
+		now := time.Now().UnixMilli()
+		if n > math.MaxInt64-now {
+			return 0, invalid
+		}
+		n += now
+	}
+	return n, nil
 }
 
-// set: set key value
+// set: SET key value [NX|XX] [GET] [EX seconds|PX milliseconds|EXAT unix-time-seconds|PXAT unix-time-milliseconds|KEEPTTL]
 func execSet(db *DB, args [][]byte) resp.Reply {
 	key := string(args[0])
 	value := args[1]
-	entity := &database.DataEntity{
-		Data: value,
+	policy := upsertPolicy
+	returnOld, keepTTL := false, false
+	var whenMs int64
+	for i := 2; i < len(args); i++ {
+		opt := strings.ToUpper(string(args[i]))
+		switch opt {
+		case "NX", "XX":
+			if policy != upsertPolicy {
+				return reply.MakeSyntaxErrReply()
+			}
+			policy = insertPolicy
+			if opt == "XX" {
+				policy = updatePolicy
+			}
+		case "GET":
+			returnOld = true
+		case "KEEPTTL":
+			if whenMs != 0 {
+				return reply.MakeSyntaxErrReply()
+			}
+			keepTTL = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if whenMs != 0 || keepTTL || i+1 >= len(args) {
+				return reply.MakeSyntaxErrReply()
+			}
+			var errReply reply.ErrorReply
+			if whenMs, errReply = parseExpireOption(opt, args[i+1], "set"); errReply != nil {
+				return errReply
+			}
+			i++
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
 	}
-	db.PutEntity(key, entity)
 
-	// store to aof file
-	db.addAof(utils.ToCmdLineWithName("SET", args...))
-	return reply.MakeOKReply()
+	// a key of another type is overwritten, unless its old value must be returned
+	old, errReply := db.getAsString(key)
+	if returnOld && errReply != nil {
+		return errReply
+	}
+	exists := old != nil || errReply != nil
+	result := resp.Reply(reply.MakeOKReply())
+	if returnOld {
+		result = reply.MakeNullReply()
+		if old != nil {
+			result = reply.MakeBulkReply(old)
+		}
+	}
+	if (policy == insertPolicy && exists) || (policy == updatePolicy && !exists) {
+		if returnOld {
+			return result
+		}
+		return reply.MakeNullReply()
+	}
+
+	db.PutEntity(key, database.MakeStringEntity(value))
+	if keepTTL {
+		if expireTime, hasTTL := db.ExpireTime(key); hasTTL {
+			whenMs = expireTime.UnixMilli()
+		}
+	}
+	// store to aof file in the form SET key value [PEXPIREAT], the ttl is stored as an absolute time
+	db.addAof(utils.ToCmdLine("SET", key, string(value)))
+	if whenMs > 0 {
+		if whenMs <= time.Now().UnixMilli() {
+			// an expire time in the past deletes the key at once
+			db.Remove(key)
+			db.addAof(utils.ToCmdLine("DEL", key))
+		} else {
+			db.Expire(key, time.UnixMilli(whenMs))
+			db.addAof(makeExpireCmd(key, whenMs))
+		}
+	} else {
+		db.Persist(key)
+	}
+	return result
 }
 
 // setnx: set if not exists
 func execSetNX(db *DB, args [][]byte) resp.Reply {
 	key := string(args[0])
 	value := args[1]
-	entity := &database.DataEntity{
-		Data: value,
-	}
-	result := db.PutIfAbsent(key, entity)
+	result := db.PutIfAbsent(key, database.MakeStringEntity(value))
 	// write to aof file
 	db.addAof(utils.ToCmdLineWithName("SETNX", args...))
 
@@ -56,14 +206,16 @@ func execSetNX(db *DB, args [][]byte) resp.Reply {
 func execGetSet(db *DB, args [][]byte) resp.Reply {
 	key := string(args[0])
 	value := args[1]
-	entity, ok := db.GetEntity(key)
-	db.PutEntity(key, &database.DataEntity{
-		Data: value,
-	})
+	old, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+	db.PutEntity(key, database.MakeStringEntity(value))
+	db.Persist(key)
 	// write to aof file
 	db.addAof(utils.ToCmdLineWithName("GETSET", args...))
-	if ok {
-		return reply.MakeBulkReply(entity.Data.([]byte))
+	if old != nil {
+		return reply.MakeBulkReply(old)
 	}
 	return reply.MakeNullReply()
 }
@@ -71,8 +223,441 @@ func execGetSet(db *DB, args [][]byte) resp.Reply {
 // strlen: get the length of the string
 func execStrlen(db *DB, args [][]byte) resp.Reply {
 	key := string(args[0])
+	value, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+	return reply.MakeIntegerReply(int64(len(value)))
+}
+
+// incrBy adds delta to the integer stored at key, a missing key counts as 0
+func incrBy(db *DB, key string, delta int64) resp.Reply {
+	var current int64
 	if entity, ok := db.GetEntity(key); ok {
-		return reply.MakeIntegerReply(int64(len(entity.Data.([]byte))))
+		switch val := entity.Data.(type) {
+		case int64:
+			current = val
+		case []byte:
+			n, ok := database.ParseInteger(val)
+			if !ok {
+				return reply.MakeStandardErrorReply("value is not an integer or out of range")
+			}
+			current = n
+		default:
+			return reply.MakeWrongTypeErrReply()
+		}
 	}
-	return reply.MakeNullReply()
+	if (delta < 0 && current < math.MinInt64-delta) || (delta > 0 && current > math.MaxInt64-delta) {
+		return reply.MakeStandardErrorReply("increment or decrement would overflow")
+	}
+	current += delta
+	// the key keeps its ttl
+	db.PutEntity(key, &database.DataEntity{Data: current})
+	return reply.MakeIntegerReply(current)
+}
+
+// incr: INCR key
+func execIncr(db *DB, args [][]byte) resp.Reply {
+	result := incrBy(db, string(args[0]), 1)
+	if _, ok := result.(*reply.IntegerReply); ok {
+		db.addAof(utils.ToCmdLineWithName("INCR", args...))
+	}
+	return result
+}
+
+// decr: DECR key
+func execDecr(db *DB, args [][]byte) resp.Reply {
+	result := incrBy(db, string(args[0]), -1)
+	if _, ok := result.(*reply.IntegerReply); ok {
+		db.addAof(utils.ToCmdLineWithName("DECR", args...))
+	}
+	return result
+}
+
+// incrby: INCRBY key increment
+func execIncrBy(db *DB, args [][]byte) resp.Reply {
+	delta, ok := database.ParseInteger(args[1])
+	if !ok {
+		return reply.MakeStandardErrorReply("value is not an integer or out of range")
+	}
+	result := incrBy(db, string(args[0]), delta)
+	if _, ok := result.(*reply.IntegerReply); ok {
+		db.addAof(utils.ToCmdLineWithName("INCRBY", args...))
+	}
+	return result
+}
+
+// decrby: DECRBY key decrement
+func execDecrBy(db *DB, args [][]byte) resp.Reply {
+	delta, ok := database.ParseInteger(args[1])
+	if !ok {
+		return reply.MakeStandardErrorReply("value is not an integer or out of range")
+	}
+	if delta == math.MinInt64 {
+		return reply.MakeStandardErrorReply("decrement would overflow")
+	}
+	result := incrBy(db, string(args[0]), -delta)
+	if _, ok := result.(*reply.IntegerReply); ok {
+		db.addAof(utils.ToCmdLineWithName("DECRBY", args...))
+	}
+	return result
+}
+
+// parseFiniteFloat parses a finite float, as accepted by INCRBYFLOAT
+func parseFiniteFloat(value []byte) (float64, bool) {
+	f, err := strconv.ParseFloat(string(value), 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, false
+	}
+	return f, true
+}
+
+// incrbyfloat: INCRBYFLOAT key increment
+func execIncrByFloat(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	delta, ok := parseFiniteFloat(args[1])
+	if !ok {
+		return reply.MakeStandardErrorReply("value is not a valid float")
+	}
+	var current float64
+	value, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+	if value != nil {
+		if current, ok = parseFiniteFloat(value); !ok {
+			return reply.MakeStandardErrorReply("value is not a valid float")
+		}
+	}
+	current += delta
+	if math.IsNaN(current) || math.IsInf(current, 0) {
+		return reply.MakeStandardErrorReply("increment would produce NaN or Infinity")
+	}
+	result := []byte(strconv.FormatFloat(current, 'f', -1, 64))
+	db.PutEntity(key, database.MakeStringEntity(result))
+
+	// the result is written as a SET, so replaying the aof does not depend on float rounding,
+	// SET clears the ttl so the expire time is written again
+	db.addAof(utils.ToCmdLine("SET", key, string(result)))
+	if expireTime, hasTTL := db.ExpireTime(key); hasTTL {
+		db.addAof(makeExpireCmd(key, expireTime.UnixMilli()))
+	}
+	return reply.MakeBulkReply(result)
+}
+
+// mget: MGET key [key ...], keys that do not exist or hold another type are nil
+func execMGet(db *DB, args [][]byte) resp.Reply {
+	values := make([][]byte, len(args))
+	for i, arg := range args {
+		value, _ := db.getAsString(string(arg))
+		values[i] = bytes.Clone(value)
+	}
+	return reply.MakeMultiBulkReply(values)
+}
+
+// mset: MSET key value [key value ...]
+func execMSet(db *DB, args [][]byte) resp.Reply {
+	if len(args)%2 != 0 {
+		return reply.MakeArgNumErrReply("mset")
+	}
+	for i := 0; i < len(args); i += 2 {
+		key := string(args[i])
+		db.PutEntity(key, database.MakeStringEntity(args[i+1]))
+		db.Persist(key)
+	}
+	db.addAof(utils.ToCmdLineWithName("MSET", args...))
+	return reply.MakeOKReply()
+}
+
+// msetnx: MSETNX key value [key value ...], no key is set if any of them exists
+func execMSetNX(db *DB, args [][]byte) resp.Reply {
+	if len(args)%2 != 0 {
+		return reply.MakeArgNumErrReply("msetnx")
+	}
+	for i := 0; i < len(args); i += 2 {
+		if _, exists := db.GetEntity(string(args[i])); exists {
+			return reply.MakeIntegerReply(0)
+		}
+	}
+	for i := 0; i < len(args); i += 2 {
+		key := string(args[i])
+		db.PutEntity(key, database.MakeStringEntity(args[i+1]))
+		db.Persist(key)
+	}
+	// every key was missing, so replaying it as MSET gives the same result
+	db.addAof(utils.ToCmdLineWithName("MSET", args...))
+	return reply.MakeIntegerReply(1)
+}
+
+// append: APPEND key value, returns the length of the string after the append
+func execAppend(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	old, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+	value := append(old, args[1]...)
+	db.PutEntity(key, &database.DataEntity{Data: value})
+	db.addAof(utils.ToCmdLineWithName("APPEND", args...))
+	return reply.MakeIntegerReply(int64(len(value)))
+}
+
+// getrange: GETRANGE key start end, negative indexes count from the end of the string
+func execGetRange(db *DB, args [][]byte) resp.Reply {
+	start, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeStandardErrorReply("value is not an integer or out of range")
+	}
+	end, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return reply.MakeStandardErrorReply("value is not an integer or out of range")
+	}
+	value, errReply := db.getAsString(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+
+	size := int64(len(value))
+	if start < 0 && end < 0 && start > end {
+		return reply.MakeEmptyBulkReply()
+	}
+	if start < 0 {
+		start += size
+	}
+	if end < 0 {
+		end += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= size {
+		end = size - 1
+	}
+	if size == 0 || start > end {
+		return reply.MakeEmptyBulkReply()
+	}
+	return reply.MakeBulkReply(bytes.Clone(value[start : end+1]))
+}
+
+// setrange: SETRANGE key offset value, the string is padded with zero bytes if it is shorter than offset
+func execSetRange(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	offset, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeStandardErrorReply("value is not an integer or out of range")
+	}
+	if offset < 0 {
+		return reply.MakeStandardErrorReply("offset is out of range")
+	}
+	patch := args[2]
+	old, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+	if len(patch) == 0 {
+		// nothing to write, a missing key is not created
+		return reply.MakeIntegerReply(int64(len(old)))
+	}
+	if offset+int64(len(patch)) > maxStringSize {
+		return reply.MakeStandardErrorReply("string exceeds maximum allowed size (proto-max-bulk-len)")
+	}
+
+	value := growString(old, offset+int64(len(patch)))
+	copy(value[offset:], patch)
+	db.PutEntity(key, &database.DataEntity{Data: value})
+	db.addAof(utils.ToCmdLineWithName("SETRANGE", args...))
+	return reply.MakeIntegerReply(int64(len(value)))
+}
+
+// getdel: GETDEL key, returns the value and deletes the key
+func execGetDel(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	value, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+	if value == nil {
+		return reply.MakeNullReply()
+	}
+	db.Remove(key)
+	db.addAof(utils.ToCmdLine("DEL", key))
+	return reply.MakeBulkReply(value)
+}
+
+// getex: GETEX key [EX seconds|PX milliseconds|EXAT unix-time-seconds|PXAT unix-time-milliseconds|PERSIST]
+func execGetEx(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	var whenMs int64
+	persist := false
+	for i := 1; i < len(args); i++ {
+		opt := strings.ToUpper(string(args[i]))
+		if whenMs != 0 || persist {
+			return reply.MakeSyntaxErrReply()
+		}
+		if opt == "PERSIST" {
+			persist = true
+			continue
+		}
+		if (opt != "EX" && opt != "PX" && opt != "EXAT" && opt != "PXAT") || i+1 >= len(args) {
+			return reply.MakeSyntaxErrReply()
+		}
+		var errReply reply.ErrorReply
+		if whenMs, errReply = parseExpireOption(opt, args[i+1], "getex"); errReply != nil {
+			return errReply
+		}
+		i++
+	}
+
+	value, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+	if value == nil {
+		return reply.MakeNullReply()
+	}
+	if whenMs > 0 {
+		if whenMs <= time.Now().UnixMilli() {
+			// an expire time in the past deletes the key at once
+			db.Remove(key)
+			db.addAof(utils.ToCmdLine("DEL", key))
+		} else {
+			db.Expire(key, time.UnixMilli(whenMs))
+			db.addAof(makeExpireCmd(key, whenMs))
+		}
+	} else if persist && db.Persist(key) > 0 {
+		db.addAof(utils.ToCmdLine("PERSIST", key))
+	}
+	return reply.MakeBulkReply(bytes.Clone(value))
+}
+
+// lcs: LCS key1 key2 [LEN] [IDX] [MINMATCHLEN len] [WITHMATCHLEN]
+func execLCS(db *DB, args [][]byte) resp.Reply {
+	getLen, getIdx, withMatchLen := false, false, false
+	var minMatchLen int64
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "LEN":
+			getLen = true
+		case "IDX":
+			getIdx = true
+		case "WITHMATCHLEN":
+			withMatchLen = true
+		case "MINMATCHLEN":
+			if i+1 >= len(args) {
+				return reply.MakeSyntaxErrReply()
+			}
+			n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return reply.MakeStandardErrorReply("value is not an integer or out of range")
+			}
+			if n > 0 {
+				minMatchLen = n
+			}
+			i++
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+	if getLen && getIdx {
+		return reply.MakeStandardErrorReply("If you want both the length and indexes, please just use IDX.")
+	}
+	a, errReply := db.getAsString(string(args[0]))
+	if errReply != nil {
+		return reply.MakeStandardErrorReply("The specified keys must contain string values")
+	}
+	b, errReply := db.getAsString(string(args[1]))
+	if errReply != nil {
+		return reply.MakeStandardErrorReply("The specified keys must contain string values")
+	}
+	if int64(len(a)+1)*int64(len(b)+1) > maxStringSize {
+		return reply.MakeStandardErrorReply("Insufficient memory, transient memory for LCS exceeds proto-max-bulk-len")
+	}
+
+	// dp[i*(len(b)+1)+j] is the length of the LCS of a[:i] and b[:j]
+	width := len(b) + 1
+	dp := make([]uint32, (len(a)+1)*width)
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			if a[i-1] == b[j-1] {
+				dp[i*width+j] = dp[(i-1)*width+j-1] + 1
+			} else if dp[(i-1)*width+j] > dp[i*width+j-1] {
+				dp[i*width+j] = dp[(i-1)*width+j]
+			} else {
+				dp[i*width+j] = dp[i*width+j-1]
+			}
+		}
+	}
+	lcsLen := dp[len(a)*width+len(b)]
+	if getLen {
+		return reply.MakeIntegerReply(int64(lcsLen))
+	}
+
+	// walk back from the end of both strings, collecting the LCS and the ranges of contiguous matches
+	result := make([]byte, lcsLen)
+	matches := make([]resp.Reply, 0)
+	idx := lcsLen
+	aStart, aEnd, bStart, bEnd := len(a), 0, 0, 0 // aStart == len(a) means no range is open
+	for i, j := len(a), len(b); i > 0 && j > 0; {
+		emitRange := false
+		if a[i-1] == b[j-1] {
+			result[idx-1] = a[i-1]
+			if aStart == len(a) {
+				aStart, aEnd, bStart, bEnd = i-1, i-1, j-1, j-1
+			} else if aStart == i && bStart == j {
+				// the range is contiguous, so it is extended backward
+				aStart--
+				bStart--
+			} else {
+				emitRange = true
+			}
+			// a range reaching the start of one of the strings is complete
+			if aStart == 0 || bStart == 0 {
+				emitRange = true
+			}
+			idx--
+			i--
+			j--
+		} else {
+			if dp[(i-1)*width+j] > dp[i*width+j-1] {
+				i--
+			} else {
+				j--
+			}
+			if aStart != len(a) {
+				emitRange = true
+			}
+		}
+
+		if emitRange {
+			matchLen := int64(aEnd - aStart + 1)
+			if getIdx && (minMatchLen == 0 || matchLen >= minMatchLen) {
+				match := []resp.Reply{
+					reply.MakeMultiRawReply([]resp.Reply{
+						reply.MakeIntegerReply(int64(aStart)), reply.MakeIntegerReply(int64(aEnd)),
+					}),
+					reply.MakeMultiRawReply([]resp.Reply{
+						reply.MakeIntegerReply(int64(bStart)), reply.MakeIntegerReply(int64(bEnd)),
+					}),
+				}
+				if withMatchLen {
+					match = append(match, reply.MakeIntegerReply(matchLen))
+				}
+				matches = append(matches, reply.MakeMultiRawReply(match))
+			}
+			aStart = len(a)
+		}
+	}
+
+	if !getIdx {
+		return reply.MakeBulkReply(result)
+	}
+	return reply.MakeMultiRawReply([]resp.Reply{
+		reply.MakeBulkReply([]byte("matches")),
+		reply.MakeMultiRawReply(matches),
+		reply.MakeBulkReply([]byte("len")),
+		reply.MakeIntegerReply(int64(lcsLen)),
+	})
 }
@@ -0,0 +1,239 @@
+package database
+
+import (
+	"goredis/interface/resp"
+	"goredis/lib/utils"
+	"goredis/resp/reply"
+	"strings"
+)
+
+// startMulti marks the connection as inside a transaction
+func startMulti(c resp.Connection) resp.Reply {
+	if c.InMultiState() {
+		return reply.MakeStandardErrorReply("MULTI calls can not be nested")
+	}
+	c.SetMultiState(true)
+	return reply.MakeOKReply()
+}
+
+// discardMulti drops the queued commands and the watched keys and leaves the transaction
+func (d *StandaloneDatabase) discardMulti(c resp.Connection) resp.Reply {
+	if !c.InMultiState() {
+		return reply.MakeStandardErrorReply("DISCARD without MULTI")
+	}
+	d.unwatchAll(c)
+	c.SetMultiState(false)
+	return reply.MakeOKReply()
+}
+
+// dbCmdArity holds the arity of the commands executed by StandaloneDatabase instead of cmdTable,
+// a transaction queueing one of them is executed with the database held exclusively
+var dbCmdArity = map[string]int{
+	"select":   2,
+	"move":     3,
+	"swapdb":   3,
+	"flushall": -1,
+}
+
+// enqueueCmd checks the command against cmdTable and queues it,
+// a command that fails the check makes the following EXEC abort
+func enqueueCmd(c resp.Connection, cmdLine CmdLine) resp.Reply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	arity, ok := dbCmdArity[cmdName]
+	if cmd, found := cmdTable[cmdName]; !ok && found {
+		arity, ok = cmd.arity, true
+	}
+	if !ok {
+		errReply := reply.MakeStandardErrorReply("unknown command '" + cmdName + "'")
+		c.AddTxError(errReply)
+		return errReply
+	}
+	if !ValidateArity(arity, cmdLine) {
+		errReply := reply.MakeArgNumErrReply(cmdName)
+		c.AddTxError(errReply)
+		return errReply
+	}
+	c.EnqueueCmd(cmdLine)
+	return reply.MakeQueuedReply()
+}
+
+// execWatch records the current version of the keys in the selected db
+func execWatch(db *DB, c resp.Connection, args [][]byte) resp.Reply {
+	if c.InMultiState() {
+		return reply.MakeStandardErrorReply("WATCH inside MULTI is not allowed")
+	}
+	keys := toKeys(args)
+	db.locker.RWLocks(nil, keys)
+	defer db.locker.RWUnLocks(nil, keys)
+	watching := c.GetWatching()
+	for _, key := range keys {
+		watched := resp.WatchedKey{DBIndex: db.index, Key: key}
+		if _, ok := watching[watched]; ok {
+			// watching a key again keeps the version of the first WATCH
+			continue
+		}
+		watching[watched] = db.watch(key)
+	}
+	return reply.MakeOKReply()
+}
+
+// unwatchAll forgets all watched keys of the connection, it is called by UNWATCH, EXEC, DISCARD
+// and when the connection is closed, so that the versions of keys nobody watches are dropped
+func (d *StandaloneDatabase) unwatchAll(c resp.Connection) {
+	watching := c.GetWatching()
+	for watched := range watching {
+		db := d.dbSet[watched.DBIndex]
+		db.locker.Lock(watched.Key)
+		db.unwatch(watched.Key)
+		db.locker.UnLock(watched.Key)
+		delete(watching, watched)
+	}
+}
+
+// execLocksAll reports whether EXEC must hold the whole database exclusively,
+// which is needed when the transaction watches keys of other dbs than the selected one
+// or queues commands working on other dbs
+func execLocksAll(c resp.Connection) bool {
+	for watched := range c.GetWatching() {
+		if watched.DBIndex != c.GetDBIndex() {
+			return true
+		}
+	}
+	return hasDBCmds(c.GetQueuedCmdLine())
+}
+
+// hasDBCmds reports whether any of the command lines selects a db or works on other dbs,
+// COPY ... DB counts even for the current db as a queued SELECT may change it
+func hasDBCmds(cmdLines []CmdLine) bool {
+	for _, cmdLine := range cmdLines {
+		cmdName := strings.ToLower(string(cmdLine[0]))
+		if _, ok := dbCmdArity[cmdName]; ok || isCrossDB(cmdName, cmdLine, -1) {
+			return true
+		}
+	}
+	return false
+}
+
+// execMulti runs the queued commands of the connection and leaves the transaction
+func (d *StandaloneDatabase) execMulti(db *DB, c resp.Connection) resp.Reply {
+	if !c.InMultiState() {
+		return reply.MakeStandardErrorReply("EXEC without MULTI")
+	}
+	defer c.SetMultiState(false)
+	defer d.unwatchAll(c)
+	if len(c.GetTxErrors()) > 0 {
+		return reply.MakeErrReply("EXECABORT Transaction discarded because of previous errors.")
+	}
+	if hasDBCmds(c.GetQueuedCmdLine()) {
+		return d.execMultiAcross(c)
+	}
+	// keys watched in other dbs are checked here, the database is held exclusively in that case
+	watching := make(map[string]uint32)
+	for watched, version := range c.GetWatching() {
+		if watched.DBIndex == db.index {
+			watching[watched.Key] = version
+		} else if d.dbSet[watched.DBIndex].GetVersion(watched.Key) != version {
+			return reply.MakeNullMultiBulkReply()
+		}
+	}
+	return db.ExecMulti(c, watching, c.GetQueuedCmdLine())
+}
+
+// ExecMulti runs the commands atomically, the keys of all commands are locked during the whole batch.
+// It returns a null reply if any of the watched keys of this db was changed since WATCH.
+// The aof lines of all commands are written as a single MULTI ... EXEC block.
+func (db *DB) ExecMulti(c resp.Connection, watching map[string]uint32, cmdLines []CmdLine) resp.Reply {
+	writeKeys, readKeys := keysOf(cmdLines)
+	if growsDataset(cmdLines) && !db.freeMemory() {
+		return makeOOMReply()
+	}
+	db.expireHashFields(writeKeys)
+	db.expireHashFields(readKeys)
+	for key := range watching {
+		readKeys = append(readKeys, key)
+	}
+	db.locker.RWLocks(writeKeys, readKeys)
+	defer db.locker.RWUnLocks(writeKeys, readKeys)
+
+	for key, version := range watching {
+		if db.GetVersion(key) != version {
+			return reply.MakeNullMultiBulkReply()
+		}
+	}
+
+	aofLines := []CmdLine{utils.ToCmdLine("MULTI")}
+	tx := db.withAof(func(lines ...CmdLine) {
+		aofLines = append(aofLines, lines...)
+	})
+	results := make([]resp.Reply, 0, len(cmdLines))
+	for _, cmdLine := range cmdLines {
+		results = append(results, tx.execCommand(cmdLine))
+	}
+	if len(aofLines) > 1 {
+		aofLines = append(aofLines, utils.ToCmdLine("EXEC"))
+		db.addAof(aofLines...)
+	}
+	return reply.MakeMultiRawReply(results)
+}
+
+// execMultiAcross runs a transaction which selects a db or works on other dbs, the database is held exclusively
+// so the keys are not locked. The aof lines of all dbs are written as a single MULTI ... EXEC block.
+func (d *StandaloneDatabase) execMultiAcross(c resp.Connection) resp.Reply {
+	for watched, version := range c.GetWatching() {
+		if d.dbSet[watched.DBIndex].GetVersion(watched.Key) != version {
+			return reply.MakeNullMultiBulkReply()
+		}
+	}
+	cmdLines := c.GetQueuedCmdLine()
+	if growsDataset(cmdLines) && !d.dbSet[c.GetDBIndex()].freeMemory() {
+		return makeOOMReply()
+	}
+
+	type aofBatch struct {
+		dbIndex int
+		lines   []CmdLine
+	}
+	var batches []aofBatch
+	if d.aofHandler != nil {
+		d.txAof = func(dbIndex int, lines ...CmdLine) {
+			batches = append(batches, aofBatch{dbIndex: dbIndex, lines: lines})
+		}
+		defer func() {
+			d.txAof = nil
+		}()
+	}
+	results := make([]resp.Reply, 0, len(cmdLines))
+	for _, cmdLine := range cmdLines {
+		// the db is looked up again for every command as SELECT may change it
+		db := d.dbSet[c.GetDBIndex()]
+		cmdName := strings.ToLower(string(cmdLine[0]))
+		var result resp.Reply
+		switch {
+		case cmdName == "select":
+			result = execSelect(c, d, cmdLine[1:])
+		case cmdName == "swapdb":
+			result = swapDB(d, cmdLine)
+		case cmdName == "flushall":
+			result = flushAll(d, cmdLine)
+		case cmdName == "move":
+			result = execMove(d, db, cmdLine)
+		case isCrossDB(cmdName, cmdLine, db.index):
+			result = execCopyAcross(d, db, cmdLine)
+		default:
+			writeKeys, readKeys := keysOf([]CmdLine{cmdLine})
+			db.expireHashFields(writeKeys)
+			db.expireHashFields(readKeys)
+			result = db.execCommand(cmdLine)
+		}
+		results = append(results, result)
+	}
+	if len(batches) > 0 {
+		// the aof handler selects the db of every batch, the SELECT lines are queued again when the file is loaded
+		d.aofHandler.AddCommand(batches[0].dbIndex, utils.ToCmdLine("MULTI"))
+		for _, batch := range batches {
+			d.aofHandler.AddCommand(batch.dbIndex, batch.lines...)
+		}
+		d.aofHandler.AddCommand(batches[len(batches)-1].dbIndex, utils.ToCmdLine("EXEC"))
+	}
+	return reply.MakeMultiRawReply(results)
+}
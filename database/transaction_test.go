@@ -0,0 +1,64 @@
+package database
+
+import (
+	"goredis/resp/connection"
+	"testing"
+)
+
+// TestMultiAcrossDBs checks that SELECT and the commands working on other dbs are queued inside MULTI
+// and executed in order by EXEC
+func TestMultiAcrossDBs(t *testing.T) {
+	d := makeTestDatabase(t)
+	c := connection.NewConnection(nil)
+
+	steps := []struct {
+		cmdLine CmdLine
+		want    string
+	}{
+		{toCmdLine("set", "a", "1"), "+OK\r\n"},
+		{toCmdLine("multi"), "+OK\r\n"},
+		{toCmdLine("set", "k", "v"), "+QUEUED\r\n"},
+		{toCmdLine("move", "k", "1"), "+QUEUED\r\n"},
+		{toCmdLine("copy", "a", "b", "db", "2"), "+QUEUED\r\n"},
+		{toCmdLine("select", "1"), "+QUEUED\r\n"},
+		{toCmdLine("get", "k"), "+QUEUED\r\n"},
+		{toCmdLine("swapdb", "1", "2"), "+QUEUED\r\n"},
+		{toCmdLine("get", "b"), "+QUEUED\r\n"},
+		{toCmdLine("exec"), "*7\r\n+OK\r\n:1\r\n:1\r\n+OK\r\n$1\r\nv\r\n+OK\r\n$1\r\n1\r\n"},
+		{toCmdLine("get", "k"), "$-1\r\n"},
+		{toCmdLine("select", "2"), "+OK\r\n"},
+		{toCmdLine("get", "k"), "$1\r\nv\r\n"},
+	}
+	for _, step := range steps {
+		if got := string(d.Exec(c, step.cmdLine).ToBytes()); got != step.want {
+			t.Fatalf("%s = %q, want %q", step.cmdLine, got, step.want)
+		}
+	}
+	if c.GetDBIndex() != 2 {
+		t.Errorf("db %d is selected, want 2", c.GetDBIndex())
+	}
+}
+
+func TestMultiAcrossDBsAbort(t *testing.T) {
+	d := makeTestDatabase(t)
+	c, other := connection.NewConnection(nil), connection.NewConnection(nil)
+
+	d.Exec(c, toCmdLine("watch", "k"))
+	d.Exec(c, toCmdLine("multi"))
+	d.Exec(c, toCmdLine("flushall"))
+	d.Exec(other, toCmdLine("set", "k", "v"))
+	if got := string(d.Exec(c, toCmdLine("exec")).ToBytes()); got != "*-1\r\n" {
+		t.Errorf("EXEC after a watched key changed = %q, want a null reply", got)
+	}
+	if got := string(d.Exec(c, toCmdLine("get", "k")).ToBytes()); got != "$1\r\nv\r\n" {
+		t.Errorf("GET = %q, FLUSHALL must not run", got)
+	}
+
+	d.Exec(c, toCmdLine("multi"))
+	if got := string(d.Exec(c, toCmdLine("select")).ToBytes()); got[0] != '-' {
+		t.Errorf("SELECT without an index = %q, want an error", got)
+	}
+	if got := string(d.Exec(c, toCmdLine("exec")).ToBytes()); got[:9] != "-EXECABOR" {
+		t.Errorf("EXEC after a queueing error = %q, want EXECABORT", got)
+	}
+}
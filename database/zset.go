@@ -1,22 +1,33 @@
 package database
 
 import (
+	"goredis/config"
+	"goredis/datastruct/zset"
 	"goredis/interface/database"
 	"goredis/interface/resp"
 	"goredis/lib/utils"
 	"goredis/resp/reply"
 	"strconv"
+	"strings"
 )
 
 func init() {
-	RegisterCommand("ZADD", execZAdd, -4)     // key score member [score member ...]
-	RegisterCommand("ZSCORE", execZScore, 3)  // key member
-	RegisterCommand("ZCARD", execZCard, 2)    // key
-	RegisterCommand("ZRANGE", execZRANGE, -4) // key start stop [WITHSCORES]
-	RegisterCommand("ZREM", execZREM, -3)     // key member [member ...]
-	RegisterCommand("ZCOUNT", execZCOUNT, 4)  // key min max
-	RegisterCommand("ZRANK", execZRank, 3)    // key member
-	RegisterCommand("ZTYPE", execZType, 2)    // key
+	RegisterCommand("ZADD", execZAdd, writeFirstKey, -4)                        // key score member [score member ...]
+	RegisterCommand("ZSCORE", execZScore, readFirstKey, 3)                      // key member
+	RegisterCommand("ZCARD", execZCard, readFirstKey, 2)                        // key
+	RegisterCommand("ZRANGE", execZRANGE, readFirstKey, -4)                     // key min max [BYSCORE|BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+	RegisterCommand("ZREVRANGE", execZRevRange, readFirstKey, -4)               // key start stop [WITHSCORES]
+	RegisterCommand("ZRANGEBYSCORE", execZRangeByScore, readFirstKey, -4)       // key min max [WITHSCORES] [LIMIT offset count]
+	RegisterCommand("ZREVRANGEBYSCORE", execZRevRangeByScore, readFirstKey, -4) // key max min [WITHSCORES] [LIMIT offset count]
+	RegisterCommand("ZRANGEBYLEX", execZRangeByLex, readFirstKey, -4)           // key min max [LIMIT offset count]
+	RegisterCommand("ZREVRANGEBYLEX", execZRevRangeByLex, readFirstKey, -4)     // key max min [LIMIT offset count]
+	RegisterCommand("ZRANGESTORE", execZRangeStore, prepareZRangeStore, -5)     // dst src min max [BYSCORE|BYLEX] [REV] [LIMIT offset count]
+	RegisterCommand("ZREM", execZREM, writeFirstKey, -3)                        // key member [member ...]
+	RegisterCommand("ZCOUNT", execZCOUNT, readFirstKey, 4)                      // key min max
+	RegisterCommand("ZLEXCOUNT", execZLexCount, readFirstKey, 4)                // key min max
+	RegisterCommand("ZRANK", execZRank, readFirstKey, 3)                        // key member
+	RegisterCommand("ZTYPE", execZType, readFirstKey, 2)                        // key
+	RegisterCommand("ZSCAN", execZScan, readFirstKey, -3)                       // key cursor [MATCH pattern] [COUNT count]
 }
 
 // ZADD 添加元素到有序集合中
@@ -181,31 +192,131 @@ func execZType(db *DB, args [][]byte) resp.Reply {
 	return reply.MakeIntegerReply(int64(zsetObj.Encoding()))
 }
 
-// ZRANGE 用于获取有序集合中指定范围内的成员
-// ZRANGE key start stop [WITHSCORES]
-func execZRANGE(db *DB, args [][]byte) resp.Reply {
-	if len(args) < 3 {
-		return reply.MakeStandardErrorReply("wrong number of arguments for 'zrange' command")
+// ZRANGE 的范围类型
+const (
+	zrangeByRank = iota
+	zrangeByScore
+	zrangeByLex
+)
+
+// zrangeSpec 是 ZRANGE 及其旧命令解析后的范围
+type zrangeSpec struct {
+	by                 int  // 范围类型
+	rev                bool // 是否按从大到小的顺序
+	start, stop        int  // 按排名时的范围
+	minScore, maxScore zset.ScoreBorder
+	minLex, maxLex     zset.LexBorder
+	offset, count      int // LIMIT 选项，count 为负数时返回所有成员
+	withScores         bool
+}
+
+// parseZRange 解析 ZRANGE 的参数 min max [BYSCORE|BYLEX] [REV] [LIMIT offset count] [WITHSCORES]，
+// ZREVRANGE、ZRANGEBYSCORE 等旧命令由 by 和 rev 指定范围类型和方向，unified 为 false，不接受 BYSCORE、BYLEX 和 REV 选项
+func parseZRange(args [][]byte, by int, rev bool, unified bool) (*zrangeSpec, resp.ErrorReply) {
+	spec := &zrangeSpec{by: by, rev: rev, count: -1}
+	hasLimit := false
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "WITHSCORES":
+			spec.withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			offset, err := strconv.Atoi(string(args[i+1]))
+			if err != nil {
+				return nil, reply.MakeStandardErrorReply("value is not an integer or out of range")
+			}
+			count, err := strconv.Atoi(string(args[i+2]))
+			if err != nil {
+				return nil, reply.MakeStandardErrorReply("value is not an integer or out of range")
+			}
+			spec.offset, spec.count = offset, count
+			hasLimit = true
+			i += 2
+		case "BYSCORE":
+			if !unified {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			spec.by = zrangeByScore
+		case "BYLEX":
+			if !unified {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			spec.by = zrangeByLex
+		case "REV":
+			if !unified {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			spec.rev = true
+		default:
+			return nil, reply.MakeSyntaxErrReply()
+		}
 	}
 
-	withScores := false
-	if len(args) > 3 && string(args[3]) == "WITHSCORES" {
-		withScores = true
+	// 检查选项的组合，旧命令返回普通的语法错误
+	if hasLimit && spec.by == zrangeByRank {
+		if !unified {
+			return nil, reply.MakeSyntaxErrReply()
+		}
+		return nil, reply.MakeStandardErrorReply("syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+	if spec.withScores && spec.by == zrangeByLex {
+		if !unified {
+			return nil, reply.MakeSyntaxErrReply()
+		}
+		return nil, reply.MakeStandardErrorReply("syntax error, WITHSCORES not supported in combination with BYLEX")
 	}
 
-	key := string(args[0])
-	// 获取范围的起始和结束索引
-	start, err := strconv.Atoi(string(args[1]))
-	if err != nil {
-		return reply.MakeStandardErrorReply("ERR value is not an integer")
+	// 按分数和字典序逆序时，参数中先给出上界再给出下界
+	minArg, maxArg := string(args[0]), string(args[1])
+	if spec.rev && spec.by != zrangeByRank {
+		minArg, maxArg = maxArg, minArg
+	}
+	var err error
+	switch spec.by {
+	case zrangeByRank:
+		if spec.start, err = strconv.Atoi(minArg); err != nil {
+			return nil, reply.MakeStandardErrorReply("value is not an integer or out of range")
+		}
+		if spec.stop, err = strconv.Atoi(maxArg); err != nil {
+			return nil, reply.MakeStandardErrorReply("value is not an integer or out of range")
+		}
+	case zrangeByScore:
+		if spec.minScore, err = zset.ParseScoreBorder(minArg); err == nil {
+			spec.maxScore, err = zset.ParseScoreBorder(maxArg)
+		}
+	case zrangeByLex:
+		if spec.minLex, err = zset.ParseLexBorder(minArg); err == nil {
+			spec.maxLex, err = zset.ParseLexBorder(maxArg)
+		}
 	}
-	stop, err := strconv.Atoi(string(args[2]))
 	if err != nil {
-		return reply.MakeStandardErrorReply("ERR value is not an integer")
+		return nil, reply.MakeStandardErrorReply(err.Error())
+	}
+	return spec, nil
+}
+
+// rangeOf 返回有序集合在范围内的成员和分数
+func (spec *zrangeSpec) rangeOf(zsetObj zset.ZSet) []zset.Element {
+	switch spec.by {
+	case zrangeByScore:
+		return zsetObj.RangeByScore(spec.minScore, spec.maxScore, spec.offset, spec.count, spec.rev)
+	case zrangeByLex:
+		return zsetObj.RangeByLex(spec.minLex, spec.maxLex, spec.offset, spec.count, spec.rev)
+	}
+	return zsetObj.Range(spec.start, spec.stop, spec.rev)
+}
+
+// zrangeGeneric 实现 ZRANGE 及其旧命令，args 为 key 和范围参数
+func zrangeGeneric(db *DB, args [][]byte, by int, rev bool, unified bool) resp.Reply {
+	spec, errReply := parseZRange(args[1:], by, rev, unified)
+	if errReply != nil {
+		return errReply
 	}
 
 	// 获取有序集合对象
-	zsetObj, exists := getAsZSet(db, key)
+	zsetObj, exists := getAsZSet(db, string(args[0]))
 	if !exists {
 		return reply.MakeEmptyMultiBulkReply()
 	}
@@ -213,26 +324,92 @@ func execZRANGE(db *DB, args [][]byte) resp.Reply {
 		return reply.MakeWrongTypeErrReply()
 	}
 
-	// 获取成员
-	members := zsetObj.RangeByRank(start, stop)
-
-	if !withScores {
+	elements := spec.rangeOf(zsetObj)
+	if !spec.withScores {
 		// 如果不需要分数，直接返回成员
-		result := make([][]byte, len(members))
-		for i, member := range members {
-			result[i] = []byte(member)
+		result := make([][]byte, len(elements))
+		for i, element := range elements {
+			result[i] = []byte(element.Member)
 		}
 		return reply.MakeMultiBulkReply(result)
+	}
+	// 如果需要分数，返回成员和分数
+	result := make([][]byte, len(elements)*2)
+	for i, element := range elements {
+		result[i*2] = []byte(element.Member)
+		result[i*2+1] = []byte(strconv.FormatFloat(element.Score, 'f', -1, 64))
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// ZRANGE 用于获取有序集合中指定范围内的成员，可以按排名、分数或字典序，也可以逆序
+// ZRANGE key min max [BYSCORE|BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+func execZRANGE(db *DB, args [][]byte) resp.Reply {
+	return zrangeGeneric(db, args, zrangeByRank, false, true)
+}
+
+// ZREVRANGE 按从大到小的排名获取成员
+// ZREVRANGE key start stop [WITHSCORES]
+func execZRevRange(db *DB, args [][]byte) resp.Reply {
+	return zrangeGeneric(db, args, zrangeByRank, true, false)
+}
+
+// ZRANGEBYSCORE 获取指定分数范围内的成员，分数前加 ( 表示不包含该分数
+// ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count]
+func execZRangeByScore(db *DB, args [][]byte) resp.Reply {
+	return zrangeGeneric(db, args, zrangeByScore, false, false)
+}
+
+// ZREVRANGEBYSCORE 按分数从大到小获取指定分数范围内的成员
+// ZREVRANGEBYSCORE key max min [WITHSCORES] [LIMIT offset count]
+func execZRevRangeByScore(db *DB, args [][]byte) resp.Reply {
+	return zrangeGeneric(db, args, zrangeByScore, true, false)
+}
+
+// ZRANGEBYLEX 获取指定字典序范围内的成员
+// ZRANGEBYLEX key min max [LIMIT offset count]
+func execZRangeByLex(db *DB, args [][]byte) resp.Reply {
+	return zrangeGeneric(db, args, zrangeByLex, false, false)
+}
+
+// ZREVRANGEBYLEX 按字典序从大到小获取指定范围内的成员
+// ZREVRANGEBYLEX key max min [LIMIT offset count]
+func execZRevRangeByLex(db *DB, args [][]byte) resp.Reply {
+	return zrangeGeneric(db, args, zrangeByLex, true, false)
+}
+
+// ZRANGESTORE 将 ZRANGE 的结果保存到目标键，结果为空时删除目标键
+// ZRANGESTORE dst src min max [BYSCORE|BYLEX] [REV] [LIMIT offset count]
+func execZRangeStore(db *DB, args [][]byte) resp.Reply {
+	spec, errReply := parseZRange(args[2:], zrangeByRank, false, true)
+	if errReply != nil {
+		return errReply
+	}
+	if spec.withScores {
+		return reply.MakeSyntaxErrReply()
+	}
+
+	dest := string(args[0])
+	srcObj, exists := getAsZSet(db, string(args[1]))
+	if srcObj == nil {
+		return reply.MakeWrongTypeErrReply()
+	}
+	var elements []zset.Element
+	if exists {
+		elements = spec.rangeOf(srcObj)
+	}
+
+	if len(elements) == 0 {
+		db.Remove(dest)
 	} else {
-		// 如果需要分数，返回成员和分数
-		result := make([][]byte, len(members)*2)
-		for i, member := range members {
-			result[i*2] = []byte(member)
-			score, _ := zsetObj.Score(member)
-			result[i*2+1] = []byte(strconv.FormatFloat(score, 'f', -1, 64))
+		destObj := zset.NewZSet(config.Properties.ZSetMaxListpackEntries)
+		for _, element := range elements {
+			destObj.Add(element.Member, element.Score)
 		}
-		return reply.MakeMultiBulkReply(result)
+		db.PutEntity(dest, &database.DataEntity{Data: destObj})
 	}
+	db.addAof(utils.ToCmdLineWithName("ZRANGESTORE", args...))
+	return reply.MakeIntegerReply(int64(len(elements)))
 }
 
 // ZREM 用于删除有序集合中的成员
@@ -283,14 +460,13 @@ func execZCOUNT(db *DB, args [][]byte) resp.Reply {
 	}
 
 	key := string(args[0])
-	min, err := parseFloat(string(args[1]))
+	min, err := zset.ParseScoreBorder(string(args[1]))
 	if err != nil {
-		return err
+		return reply.MakeStandardErrorReply(err.Error())
 	}
-
-	max, err := parseFloat(string(args[2]))
+	max, err := zset.ParseScoreBorder(string(args[2]))
 	if err != nil {
-		return err
+		return reply.MakeStandardErrorReply(err.Error())
 	}
 
 	// 获取有序集合对象
@@ -305,3 +481,59 @@ func execZCOUNT(db *DB, args [][]byte) resp.Reply {
 	count := zsetObj.Count(min, max)
 	return reply.MakeIntegerReply(int64(count))
 }
+
+// ZLEXCOUNT 用于获取有序集合中指定字典序范围内的成员数量
+// ZLEXCOUNT key min max
+func execZLexCount(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	min, err := zset.ParseLexBorder(string(args[1]))
+	if err != nil {
+		return reply.MakeStandardErrorReply(err.Error())
+	}
+	max, err := zset.ParseLexBorder(string(args[2]))
+	if err != nil {
+		return reply.MakeStandardErrorReply(err.Error())
+	}
+
+	zsetObj, exists := getAsZSet(db, key)
+	if !exists {
+		return reply.MakeIntegerReply(0)
+	}
+	if zsetObj == nil {
+		return reply.MakeWrongTypeErrReply()
+	}
+	return reply.MakeIntegerReply(int64(zsetObj.LexCount(min, max)))
+}
+
+// ZSCAN 用于增量迭代有序集合中的成员和分数
+// ZSCAN key cursor [MATCH pattern] [COUNT count]
+func execZScan(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	cur, errReply := parseScanCursor(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	opts, errReply := parseScanOptions(args[2:], false, false)
+	if errReply != nil {
+		return errReply
+	}
+
+	zsetObj, exists := getAsZSet(db, key)
+	if !exists {
+		return makeScanReply(0, nil)
+	}
+	if zsetObj == nil {
+		return reply.MakeWrongTypeErrReply()
+	}
+
+	members, next := zsetObj.Scan(cur, opts.count)
+	result := make([][]byte, 0, len(members)*2)
+	for _, member := range members {
+		if !opts.match(member) {
+			continue
+		}
+		score, _ := zsetObj.Score(member)
+		result = append(result, []byte(member), []byte(strconv.FormatFloat(score, 'f', -1, 64)))
+	}
+	return makeScanReply(next, result)
+}
@@ -0,0 +1,278 @@
+package dict
+
+import (
+	"goredis/lib/sync/lock"
+	"goredis/lib/utils"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+)
+
+// ConcurrentDict splits keys across shards, each shard is a map protected by its own lock.
+// Operations on keys of different shards do not block each other.
+//
+// Besides the locks protecting the maps, every shard has a key lock, see Locks.
+type ConcurrentDict struct {
+	table []*shard
+	count int64       // number of keys, updated atomically so that Len is O(1)
+	locks *lock.Locks // key locks, the i-th lock guards the keys of the i-th shard
+}
+
+type shard struct {
+	m     map[string]interface{} // allocated on first write
+	mutex sync.RWMutex
+}
+
+// MakeConcurrent creates a dict with shardCount shards, rounded up to a power of two
+func MakeConcurrent(shardCount int) *ConcurrentDict {
+	size := 1
+	for size < shardCount {
+		size <<= 1
+	}
+	table := make([]*shard, size)
+	for i := range table {
+		table[i] = &shard{}
+	}
+	return &ConcurrentDict{
+		table: table,
+		locks: lock.Make(size),
+	}
+}
+
+// ShardCount returns the number of shards
+func (d *ConcurrentDict) ShardCount() int {
+	return len(d.table)
+}
+
+// ShardIndex returns the index of the shard the key belongs to
+func (d *ConcurrentDict) ShardIndex(key string) int {
+	return int(utils.Fnv32(key) & uint32(len(d.table)-1))
+}
+
+// Locks returns the key locks of the shards, the lock of a key has the same index as the shard of the key.
+// The dict itself never takes them: they are separate from the locks protecting the shard maps,
+// so a caller holding the lock of a key can still read and write the dict,
+// which makes a sequence of operations on the key atomic.
+func (d *ConcurrentDict) Locks() *lock.Locks {
+	return d.locks
+}
+
+func (d *ConcurrentDict) getShard(key string) *shard {
+	return d.table[d.ShardIndex(key)]
+}
+
+// get value by key
+func (d *ConcurrentDict) Get(key string) (val interface{}, exists bool) {
+	s := d.getShard(key)
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	val, exists = s.m[key]
+	return
+}
+
+// get dict length
+func (d *ConcurrentDict) Len() int {
+	return int(atomic.LoadInt64(&d.count))
+}
+
+// put value by key, return 1 if the key is new, 0 if an existing value is replaced
+func (d *ConcurrentDict) Put(key string, val interface{}) (result int) {
+	s := d.getShard(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.m == nil {
+		s.m = make(map[string]interface{})
+	}
+	if _, ok := s.m[key]; ok {
+		s.m[key] = val
+		return 0
+	}
+	s.m[key] = val
+	atomic.AddInt64(&d.count, 1)
+	return 1
+}
+
+// put value by key if absent, return 1 if success, 0 if fail
+func (d *ConcurrentDict) PutIfAbsent(key string, val interface{}) (result int) {
+	s := d.getShard(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.m[key]; ok {
+		return 0
+	}
+	if s.m == nil {
+		s.m = make(map[string]interface{})
+	}
+	s.m[key] = val
+	atomic.AddInt64(&d.count, 1)
+	return 1
+}
+
+// put value by key if exists, return 1 if success, 0 if fail
+func (d *ConcurrentDict) PutIfExists(key string, val interface{}) (result int) {
+	s := d.getShard(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.m[key]; ok {
+		s.m[key] = val
+		return 1
+	}
+	return 0
+}
+
+// remove value by key, return 1 if success, 0 if fail
+func (d *ConcurrentDict) Remove(key string) (result int) {
+	s := d.getShard(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.m[key]; ok {
+		delete(s.m, key)
+		atomic.AddInt64(&d.count, -1)
+		return 1
+	}
+	return 0
+}
+
+// ForEach iterates all key-value pairs until consumer returns false.
+// Each shard is copied under its read lock, so consumer may modify the dict.
+func (d *ConcurrentDict) ForEach(consumer Consumer) {
+	for i := range d.table {
+		if !d.ForEachInShard(i, consumer) {
+			return
+		}
+	}
+}
+
+// ForEachInShard iterates the key-value pairs of one shard,
+// it returns false if consumer stopped the iteration.
+// The pairs are a snapshot taken under the shard's read lock.
+func (d *ConcurrentDict) ForEachInShard(index int, consumer Consumer) bool {
+	type entry struct {
+		key string
+		val interface{}
+	}
+	s := d.table[index]
+	s.mutex.RLock()
+	entries := make([]entry, 0, len(s.m))
+	for key, val := range s.m {
+		entries = append(entries, entry{key: key, val: val})
+	}
+	s.mutex.RUnlock()
+	for _, e := range entries {
+		if !consumer(e.key, e.val) {
+			return false
+		}
+	}
+	return true
+}
+
+// get all keys
+func (d *ConcurrentDict) Keys() []string {
+	keys := make([]string, 0, d.Len())
+	for _, s := range d.table {
+		s.mutex.RLock()
+		for key := range s.m {
+			keys = append(keys, key)
+		}
+		s.mutex.RUnlock()
+	}
+	return keys
+}
+
+// randomKeyTries is the number of random shards tried before walking the table to find a key
+const randomKeyTries = 64
+
+// randomKey picks one key: a random non-empty shard is chosen, then a random key inside it.
+// The pick is not exactly uniform: every non-empty shard has the same probability to be chosen,
+// so a key in a shard with fewer keys than others is more likely to be picked.
+// Keys are spread over the shards by their hash, which keeps the shards of a large dict at about the same size.
+func (d *ConcurrentDict) randomKey() (string, bool) {
+	if d.Len() <= 0 {
+		return "", false
+	}
+	for retry := 0; retry < randomKeyTries; retry++ {
+		if key, ok := d.table[rand.Intn(len(d.table))].randomKey(); ok {
+			return key, true
+		}
+	}
+	// the dict is sparse, walk the table from a random shard
+	start := rand.Intn(len(d.table))
+	for i := range d.table {
+		if key, ok := d.table[(start+i)%len(d.table)].randomKey(); ok {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// randomKey picks a random key of the shard, ok is false if the shard is empty
+func (s *shard) randomKey() (string, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if len(s.m) == 0 {
+		return "", false
+	}
+	target := rand.Intn(len(s.m))
+	for key := range s.m {
+		if target == 0 {
+			return key, true
+		}
+		target--
+	}
+	return "", false
+}
+
+// get n random keys, a key may be returned more than once
+func (d *ConcurrentDict) RandomKey(n int) []string {
+	keys := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		key, ok := d.randomKey()
+		if !ok {
+			break
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// get n distinct random keys, all keys are returned if the dict has no more than n keys
+func (d *ConcurrentDict) RandomDistinctKeys(n int) []string {
+	if n <= 0 || d.Len() == 0 {
+		return []string{}
+	}
+	if n*2 >= d.Len() {
+		// picking most of the keys, shuffling is cheaper than sampling
+		keys := d.Keys()
+		rand.Shuffle(len(keys), func(i, j int) {
+			keys[i], keys[j] = keys[j], keys[i]
+		})
+		if len(keys) > n {
+			keys = keys[:n]
+		}
+		return keys
+	}
+	picked := make(map[string]struct{}, n)
+	keys := make([]string, 0, n)
+	for len(keys) < n {
+		key, ok := d.randomKey()
+		if !ok {
+			break
+		}
+		if _, ok := picked[key]; ok {
+			continue
+		}
+		picked[key] = struct{}{}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// clear all key-value pairs
+func (d *ConcurrentDict) Clear() {
+	for _, s := range d.table {
+		s.mutex.Lock()
+		atomic.AddInt64(&d.count, -int64(len(s.m)))
+		s.m = nil
+		s.mutex.Unlock()
+	}
+}
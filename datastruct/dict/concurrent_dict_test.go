@@ -0,0 +1,118 @@
+package dict
+
+import (
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentDictOperations(t *testing.T) {
+	d := MakeConcurrent(4)
+	tests := []struct {
+		name    string
+		op      func() int
+		want    int
+		wantLen int
+	}{
+		{name: "put new", op: func() int { return d.Put("a", 1) }, want: 1, wantLen: 1},
+		{name: "put existing", op: func() int { return d.Put("a", 2) }, want: 0, wantLen: 1},
+		{name: "put if absent existing", op: func() int { return d.PutIfAbsent("a", 3) }, want: 0, wantLen: 1},
+		{name: "put if absent new", op: func() int { return d.PutIfAbsent("b", 1) }, want: 1, wantLen: 2},
+		{name: "put if exists missing", op: func() int { return d.PutIfExists("c", 1) }, want: 0, wantLen: 2},
+		{name: "put if exists", op: func() int { return d.PutIfExists("b", 2) }, want: 1, wantLen: 2},
+		{name: "remove missing", op: func() int { return d.Remove("c") }, want: 0, wantLen: 2},
+		{name: "remove", op: func() int { return d.Remove("a") }, want: 1, wantLen: 1},
+		{name: "clear", op: func() int { d.Clear(); return 0 }, want: 0, wantLen: 0},
+		{name: "put after clear", op: func() int { return d.Put("a", 1) }, want: 1, wantLen: 1},
+	}
+	for _, tt := range tests {
+		if got := tt.op(); got != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, got, tt.want)
+		}
+		if d.Len() != tt.wantLen || len(d.Keys()) != tt.wantLen {
+			t.Errorf("%s: Len() = %d, len(Keys()) = %d, want %d", tt.name, d.Len(), len(d.Keys()), tt.wantLen)
+		}
+	}
+	if val, ok := d.Get("a"); !ok || val != 1 {
+		t.Errorf("Get(a) = %v, %v", val, ok)
+	}
+}
+
+func TestConcurrentDictRandomKeys(t *testing.T) {
+	tests := []struct {
+		size int
+		n    int
+	}{
+		{size: 0, n: 3},
+		{size: 1, n: 3},
+		{size: 10, n: 3},
+		{size: 10, n: 10},
+		{size: 10, n: 20},
+		{size: 1000, n: 5},
+		{size: 1000, n: 800},
+	}
+	for _, tt := range tests {
+		d := MakeConcurrent(16)
+		for i := 0; i < tt.size; i++ {
+			d.Put(strconv.Itoa(i), i)
+		}
+		keys := d.RandomKey(tt.n)
+		if tt.size > 0 && len(keys) != tt.n || tt.size == 0 && len(keys) != 0 {
+			t.Errorf("size %d: RandomKey(%d) returned %d keys", tt.size, tt.n, len(keys))
+		}
+		distinct := d.RandomDistinctKeys(tt.n)
+		if want := min(tt.n, tt.size); len(distinct) != want {
+			t.Errorf("size %d: RandomDistinctKeys(%d) returned %d keys, want %d", tt.size, tt.n, len(distinct), want)
+		}
+		slices.Sort(distinct)
+		if len(slices.Compact(distinct)) != len(distinct) {
+			t.Errorf("size %d: RandomDistinctKeys(%d) returned duplicates", tt.size, tt.n)
+		}
+		for _, key := range append(keys, distinct...) {
+			if _, ok := d.Get(key); !ok {
+				t.Errorf("size %d: random key %q is not in the dict", tt.size, key)
+			}
+		}
+	}
+}
+
+func TestConcurrentDictConcurrentAccess(t *testing.T) {
+	d := MakeConcurrent(16)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				d.Put(strconv.Itoa(g)+"-"+strconv.Itoa(i), i)
+				d.RandomKey(1)
+			}
+		}(g)
+	}
+	wg.Wait()
+	if d.Len() != 8000 {
+		t.Fatalf("Len() = %d, want 8000", d.Len())
+	}
+	// the consumer may modify the dict
+	visited := 0
+	d.ForEach(func(key string, val interface{}) bool {
+		visited++
+		d.Remove(key)
+		return true
+	})
+	if visited != 8000 || d.Len() != 0 {
+		t.Errorf("visited %d keys, Len() = %d", visited, d.Len())
+	}
+}
+
+func TestConcurrentDictLocks(t *testing.T) {
+	d := MakeConcurrent(16)
+	locks := d.Locks()
+	// holding the lock of a key does not block operations on the dict
+	locks.Lock("a")
+	d.Put("a", 1)
+	d.Get("a")
+	d.Remove("a")
+	locks.UnLock("a")
+}
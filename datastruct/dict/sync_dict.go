@@ -73,8 +73,7 @@ func (d *SyncDict) Remove(key string) (result int) {
 // foreach iterate all key-value pairs
 func (d *SyncDict) ForEach(consumer Consumer) {
 	d.m.Range(func(key, value interface{}) bool {
-		consumer(key.(string), value)
-		return true
+		return consumer(key.(string), value)
 	})
 }
 
@@ -112,7 +111,10 @@ func (d *SyncDict) RandomDistinctKeys(n int) []string {
 	return keys
 }
 
-// clear all key-value pairs
+// clear all key-value pairs, it is safe to call while other goroutines use the dict
 func (d *SyncDict) Clear() {
-	*d = *MakeSyncDict()
+	d.m.Range(func(key, value interface{}) bool {
+		d.m.Delete(key)
+		return true
+	})
 }
@@ -1,9 +1,17 @@
 package hash
 
+import (
+	"goredis/datastruct/listpack"
+	"goredis/lib/cursor"
+	"math/rand"
+	"time"
+)
+
 // 当哈希中数据的长度超过此值时，将转换为哈希表
 const (
-	hashMaxListpackEntries = 512
-	hashMaxListpackValue   = 64
+	// DefaultMaxListpackEntries 是 listpack 编码默认的最大字段数量，对应 hash-max-listpack-entries 配置
+	DefaultMaxListpackEntries = 512
+	hashMaxListpackValue      = 64
 )
 
 // 定义哈希的编码类型
@@ -14,27 +22,67 @@ const (
 
 // 定义一个哈希数据结构
 type Hash struct {
-	encoding int               // 编码类型
-	listpack [][2]string       //使用切片存储键值对，模拟listpack
-	dict     map[string]string // 使用map存储键值对，模拟哈希表
+	encoding           int                // 编码类型
+	listpack           *listpack.ListPack // 字段和值依次存放在 listpack 中
+	dict               map[string]string  // 使用map存储键值对，模拟哈希表
+	index              *cursor.Index      // 哈希表编码时按哈希值分桶保存字段，供 HSCAN 按游标遍历
+	expires            map[string]int64   // 字段的过期时间（unix 毫秒），两种编码共用，没有字段设置过期时间时为 nil
+	maxListpackEntries int                // listpack 编码的最大字段数量
 }
 
-func NewHash() *Hash {
+// NewHash函数创建一个空哈希，字段数量超过 maxListpackEntries 时转换为哈希表，
+// maxListpackEntries 为 0 时使用 DefaultMaxListpackEntries
+func NewHash(maxListpackEntries int) *Hash {
+	if maxListpackEntries <= 0 {
+		maxListpackEntries = DefaultMaxListpackEntries
+	}
 	return &Hash{
-		encoding: encodingListpack,
-		listpack: make([][2]string, 0),
-		dict:     nil,
+		encoding:           encodingListpack,
+		listpack:           listpack.New(),
+		dict:               nil,
+		maxListpackEntries: maxListpackEntries,
 	}
 }
 
+// listpackGet函数返回 listpack 中字段的位置和值，字段不存在时位置为 -1
+func (h *Hash) listpackGet(key string) (int, string) {
+	pos := h.listpack.Find(key, 1)
+	if pos < 0 {
+		return -1, ""
+	}
+	value, _ := h.listpack.Next(h.listpack.Skip(pos, 1))
+	return pos, value
+}
+
+// listpackForEach函数按顺序遍历 listpack 中的键值对，直到 consumer 返回 false
+func (h *Hash) listpackForEach(consumer func(key, value string) bool) {
+	var key string
+	i := 0
+	h.listpack.ForEach(func(pos int, val string) bool {
+		i++
+		if i%2 == 1 {
+			key = val
+			return true
+		}
+		return consumer(key, val)
+	})
+}
+
+// expired函数判断字段是否已经过期，过期的字段在被删除之前对读取不可见
+func (h *Hash) expired(key string, now int64) bool {
+	expireAt, ok := h.expires[key]
+	return ok && expireAt <= now
+}
+
 // Get函数从哈希中检索与给定键关联的值
 func (h *Hash) Get(key string) (string, bool) {
+	if h.expires != nil && h.expired(key, time.Now().UnixMilli()) {
+		return "", false
+	}
 	// 如果使用listpack编码，遍历listpack查找键
 	if h.encoding == encodingListpack {
-		for _, kv := range h.listpack {
-			if kv[0] == key {
-				return kv[1], true
-			}
+		if pos, value := h.listpackGet(key); pos >= 0 {
+			return value, true
 		}
 	}
 	// 如果使用哈希表编码，直接从哈希表中查找键
@@ -48,26 +96,33 @@ func (h *Hash) Get(key string) (string, bool) {
 
 // Set函数在哈希中设置给定键的值
 // 如果字段已存在，它将更新值并返回0；如果是新条目，则返回1
+// 设置值会清除字段的过期时间，已过期的字段视为新条目
 func (h *Hash) Set(key, value string) int {
-	// 如果使用listpack编码，检查长度和键值对的大小
+	if h.expires != nil {
+		if h.expired(key, time.Now().UnixMilli()) {
+			h.remove(key)
+		}
+		h.Persist(key)
+	}
+	// 如果使用listpack编码，检查键值对的大小
 	if h.encoding == encodingListpack {
-		if len(h.listpack)>= hashMaxListpackEntries ||
-		len(key) > hashMaxListpackValue ||
-		len(value) > hashMaxListpackValue {
+		if len(key) > hashMaxListpackValue || len(value) > hashMaxListpackValue {
 			// 转换为哈希表编码
 			h.covertToHashTable()
 		}
 	}
 	// 使用listpack编码
 	if h.encoding == encodingListpack {
-		for i, kv := range h.listpack {
-			if kv[0] == key {
-				h.listpack[i][1] = value // 更新值
-				return 0
-			}
+		if pos := h.listpack.Find(key, 1); pos >= 0 {
+			h.listpack.Replace(h.listpack.Skip(pos, 1), value) // 更新值
+			return 0
 		}
-		h.listpack = append(h.listpack, [2]string{key, value}) // 添加新键值对
-		return 1
+		// 只有添加新字段时才检查字段数量，更新已有字段不会转换编码
+		if h.listpack.Len()/2 < h.maxListpackEntries {
+			h.listpack.Append(key, value) // 添加新键值对
+			return 1
+		}
+		h.covertToHashTable()
 	}
 	// 使用哈希表编码
 	if h.encoding == encodingHashTable {
@@ -76,64 +131,83 @@ func (h *Hash) Set(key, value string) int {
 			return 0
 		}
 		h.dict[key] = value // 添加新键值对
+		h.index.Add(key)
 		return 1
 	}
 	return 0
 }
 
-// Delete函数从哈希中删除给定的字段
+// Delete函数从哈希中删除给定的字段，已过期的字段视为不存在
 func (h *Hash) Delete(key string) int {
+	if h.expires != nil && h.expired(key, time.Now().UnixMilli()) {
+		h.remove(key)
+		return 0
+	}
+	return h.remove(key)
+}
+
+// remove函数从两种编码中删除字段及其过期时间
+func (h *Hash) remove(key string) int {
+	h.Persist(key)
 	count := 0
 	// 如果使用listpack编码，遍历listpack查找键
 	if h.encoding == encodingListpack {
-		for i, kv := range h.listpack {
-			if kv[0] == key {
-				// 删除条目，并将最后一个条目移到当前位置以减小大小
-                // 因为哈希不需要保持顺序，我们可以简单地将最后一个条目与当前条目交换
-                lastIndex := len(h.listpack) - 1
-                h.listpack[i] = h.listpack[lastIndex]
-                h.listpack = h.listpack[:lastIndex]
-				count++
-				break
-			}
+		if pos := h.listpack.Find(key, 1); pos >= 0 {
+			// 删除字段和值两个条目
+			h.listpack.Delete(pos, 2)
+			count++
 		}
 	}
 	// 如果使用哈希表编码，直接从哈希表中删除键
 	if h.encoding == encodingHashTable {
 		if _, ok := h.dict[key]; ok {
 			delete(h.dict, key)
+			h.index.Remove(key)
 			count++
 		}
 	}
 	return count
 }
 
-// Len函数返回哈希中键值对的数量
+// Len函数返回哈希中未过期的键值对的数量
 func (h *Hash) Len() int {
+	size := 0
 	// listpack
 	if h.encoding == encodingListpack {
-		return len(h.listpack)
+		size = h.listpack.Len() / 2
 	}
 	// hash table
 	if h.encoding == encodingHashTable {
-		return len(h.dict)
+		size = len(h.dict)
 	}
-	return 0
+	now := time.Now().UnixMilli()
+	for key := range h.expires {
+		if h.expired(key, now) {
+			size--
+		}
+	}
+	return size
 }
 
 // GetAll函数返回哈希中的所有字段和值
 func (h *Hash) GetAll() map[string]string {
 	result := make(map[string]string)
+	now := time.Now().UnixMilli()
 	// listpack
 	if h.encoding == encodingListpack {
-		for _, kv := range h.listpack {
-			result[kv[0]] = kv[1]
-		}
+		h.listpackForEach(func(key, value string) bool {
+			if !h.expired(key, now) {
+				result[key] = value
+			}
+			return true
+		})
 	}
 	// hash table
 	if h.encoding == encodingHashTable {
 		for k, v := range h.dict {
-			result[k] = v
+			if !h.expired(k, now) {
+				result[k] = v
+			}
 		}
 	}
 	return result
@@ -142,16 +216,22 @@ func (h *Hash) GetAll() map[string]string {
 // Fields函数返回哈希中的所有字段
 func (h *Hash) Fields() []string {
 	result := make([]string, 0)
+	now := time.Now().UnixMilli()
 	// listpack
 	if h.encoding == encodingListpack {
-		for _, kv := range h.listpack {
-			result = append(result, kv[0])
-		}
+		h.listpackForEach(func(key, value string) bool {
+			if !h.expired(key, now) {
+				result = append(result, key)
+			}
+			return true
+		})
 	}
 	// hash table
 	if h.encoding == encodingHashTable {
 		for k := range h.dict {
-			result = append(result, k)
+			if !h.expired(k, now) {
+				result = append(result, k)
+			}
 		}
 	}
 	return result
@@ -160,21 +240,58 @@ func (h *Hash) Fields() []string {
 // Values函数返回哈希中的所有值
 func (h *Hash) Values() []string {
 	result := make([]string, 0)
+	now := time.Now().UnixMilli()
 	// listpack
 	if h.encoding == encodingListpack {
-		for _, kv := range h.listpack {
-			result = append(result, kv[1])
-		}
+		h.listpackForEach(func(key, value string) bool {
+			if !h.expired(key, now) {
+				result = append(result, value)
+			}
+			return true
+		})
 	}
 	// hash table
 	if h.encoding == encodingHashTable {
-		for _, v := range h.dict {
-			result = append(result, v)
+		for k, v := range h.dict {
+			if !h.expired(k, now) {
+				result = append(result, v)
+			}
 		}
 	}
 	return result
 }
 
+// RandomDistinctFields函数随机返回哈希中最多 count 个不重复的字段
+func (h *Hash) RandomDistinctFields(count int) []string {
+	fields := h.Fields()
+	if count <= 0 || len(fields) == 0 {
+		return []string{}
+	}
+	if count >= len(fields) {
+		return fields // 返回所有字段
+	}
+	// 打乱所有字段后返回前 count 个
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	r.Shuffle(len(fields), func(i, j int) {
+		fields[i], fields[j] = fields[j], fields[i]
+	})
+	return fields[:count]
+}
+
+// RandomFields函数随机返回哈希中的 count 个字段，字段可以重复
+func (h *Hash) RandomFields(count int) []string {
+	fields := h.Fields()
+	if count <= 0 || len(fields) == 0 {
+		return []string{}
+	}
+	res := make([]string, count)
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for i := range res {
+		res[i] = fields[r.Intn(len(fields))]
+	}
+	return res
+}
+
 // Exists函数检查字段是否存在于哈希中
 func (h *Hash) Exists(key string) bool {
 	_, exists := h.Get(key)
@@ -187,22 +304,99 @@ func (h *Hash) covertToHashTable() {
 		return
 	}
 
-	h.dict = make(map[string]string, len(h.listpack))
-	for _, kv := range h.listpack {
-		h.dict[kv[0]] = kv[1]
-	}
+	h.dict = make(map[string]string, h.listpack.Len()/2)
+	h.index = cursor.NewIndex(h.listpack.Len() / 2)
+	h.listpackForEach(func(key, value string) bool {
+		h.dict[key] = value
+		h.index.Add(key)
+		return true
+	})
 	h.listpack = nil // 清空listpack以释放内存
 	h.encoding = encodingHashTable // 更新编码类型
 }
 
+// Scan函数按游标遍历哈希中的字段，返回本次遍历的字段和下一次的游标，游标为0表示遍历结束
+// listpack编码的哈希很小，一次返回所有字段，哈希表编码时只访问游标之后约 count 个字段
+func (h *Hash) Scan(cur uint64, count int) ([]string, uint64) {
+	if h.encoding == encodingListpack {
+		return h.Fields(), 0
+	}
+	fields, next := h.index.Scan(cur, count)
+	if h.expires != nil {
+		// 跳过已过期的字段
+		now := time.Now().UnixMilli()
+		visible := fields[:0]
+		for _, field := range fields {
+			if !h.expired(field, now) {
+				visible = append(visible, field)
+			}
+		}
+		fields = visible
+	}
+	return fields, next
+}
+
 // Encoding函数返回哈希的编码类型
 func (h *Hash) Encoding() int {
 	return h.encoding
 }
 
+// ObjectEncoding函数返回 OBJECT ENCODING 命令显示的编码名称
+func (h *Hash) ObjectEncoding() string {
+	if h.encoding == encodingListpack {
+		return "listpack"
+	}
+	return "hashtable"
+}
+
+// SetExpire函数设置字段的过期时间（unix 毫秒），字段必须存在
+func (h *Hash) SetExpire(key string, expireAt int64) {
+	if h.expires == nil {
+		h.expires = make(map[string]int64)
+	}
+	h.expires[key] = expireAt
+}
+
+// ExpireTime函数返回字段的过期时间（unix 毫秒），字段没有过期时间时 ok 为 false
+func (h *Hash) ExpireTime(key string) (int64, bool) {
+	expireAt, ok := h.expires[key]
+	return expireAt, ok
+}
+
+// Persist函数清除字段的过期时间，字段原本有过期时间时返回 true
+func (h *Hash) Persist(key string) bool {
+	if _, ok := h.expires[key]; !ok {
+		return false
+	}
+	delete(h.expires, key)
+	if len(h.expires) == 0 {
+		h.expires = nil
+	}
+	return true
+}
+
+// HasExpires函数判断是否有字段设置了过期时间
+func (h *Hash) HasExpires() bool {
+	return len(h.expires) > 0
+}
+
+// RemoveExpired函数删除所有已过期的字段，返回删除的字段
+func (h *Hash) RemoveExpired() []string {
+	var removed []string
+	now := time.Now().UnixMilli()
+	for key := range h.expires {
+		if h.expired(key, now) && h.remove(key) > 0 {
+			removed = append(removed, key)
+		}
+	}
+	return removed
+}
+
 // Clear函数清空哈希中的所有键值对
 func (h *Hash) Clear() {
-	h.listpack = make([][2]string, 0)
+	h.listpack = listpack.New()
 	h.dict = nil
+	h.index = nil
+	h.expires = nil
 	h.encoding = encodingListpack
 }
\ No newline at end of file
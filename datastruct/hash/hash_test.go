@@ -0,0 +1,35 @@
+package hash
+
+import (
+	"strconv"
+	"testing"
+)
+
+// TestSetAtListpackLimit 检查字段数量达到上限后，只有添加新字段才会转换为哈希表
+func TestSetAtListpackLimit(t *testing.T) {
+	h := NewHash(4)
+	for i := 0; i < 4; i++ {
+		h.Set("f"+strconv.Itoa(i), "v")
+	}
+	if got := h.Set("f1", "w"); got != 0 {
+		t.Errorf("Set(existing) = %d, want 0", got)
+	}
+	if got := h.ObjectEncoding(); got != "listpack" {
+		t.Errorf("encoding after updating a field = %s, want listpack", got)
+	}
+	if got, _ := h.Get("f1"); got != "w" {
+		t.Errorf("Get(f1) = %q, want %q", got, "w")
+	}
+	if got := h.Set("f4", "v"); got != 1 {
+		t.Errorf("Set(new) = %d, want 1", got)
+	}
+	if got := h.ObjectEncoding(); got != "hashtable" {
+		t.Errorf("encoding after adding a field = %s, want hashtable", got)
+	}
+	if got := h.Len(); got != 5 {
+		t.Errorf("Len() = %d, want 5", got)
+	}
+	if got, _ := h.Get("f1"); got != "w" {
+		t.Errorf("Get(f1) after conversion = %q, want %q", got, "w")
+	}
+}
@@ -0,0 +1,470 @@
+// Package hyperloglog implements the HyperLogLog cardinality estimator used by PFADD, PFCOUNT and PFMERGE.
+//
+// A HyperLogLog is stored as a string in the layout of redis:
+//
+//	"HYLL" | encoding (1 byte) | unused (3 bytes) | cached cardinality (8 bytes, little endian) | registers
+//
+// There are 16384 registers of 6 bits, the standard error is 1.04/sqrt(16384) = 0.81%.
+// The dense encoding packs all registers in 12288 bytes. The sparse encoding run-length encodes them with
+// the opcodes ZERO (00xxxxxx), XZERO (01xxxxxx yyyyyyyy) and VAL (1vvvvvxx), it is used while it is
+// shorter than SparseMaxBytes and no register is larger than 32.
+//
+// PFADD changes a string in place with AddBytes and sets the high bit of the cached cardinality,
+// which marks it as invalid until PFCOUNT computes it again.
+package hyperloglog
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"slices"
+)
+
+const (
+	precision = 14                          // bits of the hash used to select a register
+	Registers = 1 << precision              // Registers is the number of registers
+	q         = 64 - precision              // bits of the hash used to count the leading zeros
+	regBits   = 6                           // bits of a dense register
+	regMax    = 1<<regBits - 1              // the largest value of a register
+	denseSize = (Registers*regBits + 7) / 8 // size of the dense registers
+
+	headerSize = 16
+	magic      = "HYLL"
+
+	encodingDense  = 0
+	encodingSparse = 1
+
+	// sparse opcodes
+	sparseValMaxValue = 32
+	sparseValMaxLen   = 4
+	sparseZeroMaxLen  = 64
+	sparseXZeroMaxLen = 16384
+
+	alphaInf = 0.721347520444481703680 // constant of the estimator for an infinite number of registers
+)
+
+// SparseMaxBytes is the largest size of the sparse registers, a larger HyperLogLog is converted to dense
+const SparseMaxBytes = 3000
+
+var (
+	// ErrNotHyperLogLog is returned by Parse for a string that is not a HyperLogLog
+	ErrNotHyperLogLog = errors.New("not a HyperLogLog string")
+	// ErrCorrupted is returned by Parse for a HyperLogLog whose registers cannot be decoded
+	ErrCorrupted = errors.New("corrupted HyperLogLog")
+)
+
+// HyperLogLog is the decoded form of a HyperLogLog string
+type HyperLogLog struct {
+	registers [Registers]uint8
+	dense     bool // once dense a HyperLogLog is never converted back to sparse
+}
+
+// New creates an empty HyperLogLog
+func New() *HyperLogLog {
+	return &HyperLogLog{}
+}
+
+// IsDense reports whether the HyperLogLog uses the dense encoding
+func (h *HyperLogLog) IsDense() bool {
+	return h.dense
+}
+
+// Parse decodes a HyperLogLog string
+func Parse(b []byte) (*HyperLogLog, error) {
+	if len(b) < headerSize || string(b[:4]) != magic || b[4] > encodingSparse {
+		return nil, ErrNotHyperLogLog
+	}
+	h := &HyperLogLog{}
+	if b[4] == encodingDense {
+		if len(b) != headerSize+denseSize {
+			return nil, ErrNotHyperLogLog
+		}
+		h.dense = true
+		for i := range h.registers {
+			h.registers[i] = getDenseRegister(b[headerSize:], i)
+		}
+		return h, nil
+	}
+	if err := h.decodeSparse(b[headerSize:]); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// CachedCount returns the cardinality stored in the header of a HyperLogLog string
+func CachedCount(b []byte) (int64, bool) {
+	if len(b) < headerSize || string(b[:4]) != magic || b[4] > encodingSparse || b[15]&0x80 != 0 {
+		return 0, false
+	}
+	return int64(binary.LittleEndian.Uint64(b[8:16])), true
+}
+
+// SetCachedCount stores the cardinality in the header of a HyperLogLog string
+func SetCachedCount(b []byte, count int64) {
+	binary.LittleEndian.PutUint64(b[8:16], uint64(count))
+}
+
+// invalidateCount marks the cached cardinality as invalid
+func invalidateCount(b []byte) {
+	b[15] |= 0x80
+}
+
+// Empty returns the string of an empty HyperLogLog, a single XZERO opcode covers all registers
+func Empty() []byte {
+	b := make([]byte, headerSize, headerSize+2)
+	copy(b, magic)
+	b[4] = encodingSparse
+	return append(b, 0x40|(Registers-1)>>8, (Registers-1)&0xff)
+}
+
+// AddBytes adds an element to the HyperLogLog string b and reports whether a register was changed.
+// The string is modified in place and only reallocated when its sparse registers grow, or when they
+// are converted to dense. A change invalidates the cached cardinality.
+func AddBytes(b []byte, element []byte) ([]byte, bool, error) {
+	if len(b) < headerSize || string(b[:4]) != magic || b[4] > encodingSparse {
+		return b, false, ErrNotHyperLogLog
+	}
+	index, count := patternLen(element)
+	if b[4] == encodingDense {
+		if len(b) != headerSize+denseSize {
+			return b, false, ErrNotHyperLogLog
+		}
+		if getDenseRegister(b[headerSize:], index) >= count {
+			return b, false, nil
+		}
+		setDenseRegister(b[headerSize:], index, count)
+		invalidateCount(b)
+		return b, true, nil
+	}
+	return sparseSet(b, index, count)
+}
+
+// sparseSet raises the register at index to count in a sparse HyperLogLog string.
+// Only the opcode covering the register is rewritten, it is split into the runs before the register,
+// the register itself and the runs after it. All opcodes are checked like in decodeSparse.
+func sparseSet(b []byte, index int, count uint8) ([]byte, bool, error) {
+	p := b[headerSize:]
+	pos, prevPos, first := -1, -1, 0
+	var value uint8
+	var span, size int
+	registers, lastPos := 0, -1
+	for i := 0; i < len(p); {
+		opValue, opSpan, opSize := uint8(0), 0, 1
+		op := p[i]
+		switch {
+		case op&0xc0 == 0: // ZERO
+			opSpan = int(op&0x3f) + 1
+		case op&0xc0 == 0x40: // XZERO
+			if i+1 >= len(p) {
+				return b, false, ErrCorrupted
+			}
+			opSpan = (int(op&0x3f)<<8 | int(p[i+1])) + 1
+			opSize = 2
+		default: // VAL
+			opSpan = int(op&0x3) + 1
+			opValue = (op>>2)&0x1f + 1
+		}
+		if pos < 0 && registers+opSpan > index {
+			pos, prevPos, first = i, lastPos, registers
+			value, span, size = opValue, opSpan, opSize
+		}
+		registers += opSpan
+		lastPos = i
+		i += opSize
+	}
+	if registers != Registers {
+		return b, false, ErrCorrupted
+	}
+	if value >= count {
+		return b, false, nil
+	}
+	if count > sparseValMaxValue {
+		return toDense(b, index, count)
+	}
+
+	var ops [8]byte
+	seq := appendSparseRun(ops[:0], value, index-first)
+	seq = appendSparseRun(seq, count, 1)
+	seq = appendSparseRun(seq, value, first+span-index-1)
+	if len(p)-size+len(seq) > SparseMaxBytes {
+		return toDense(b, index, count)
+	}
+	b = slices.Replace(b, headerSize+pos, headerSize+pos+size, seq...)
+	if prevPos >= 0 {
+		pos = prevPos
+	}
+	b = mergeSparseVals(b, headerSize+pos, headerSize+pos+len(seq)+2)
+	invalidateCount(b)
+	return b, true, nil
+}
+
+// mergeSparseVals merges the adjacent VAL opcodes of the same value starting between start and end,
+// when their runs fit in a single opcode
+func mergeSparseVals(b []byte, start int, end int) []byte {
+	for i := start; i < end && i+1 < len(b); {
+		op, next := b[i], b[i+1]
+		switch {
+		case op&0xc0 == 0x40: // XZERO
+			i += 2
+			continue
+		case op&0x80 == 0 || next&0x80 == 0 || (op>>2)&0x1f != (next>>2)&0x1f:
+			i++
+			continue
+		}
+		runLen := int(op&0x3) + int(next&0x3) + 2
+		if runLen > sparseValMaxLen {
+			i++
+			continue
+		}
+		b[i] = op&^0x3 | byte(runLen-1)
+		b = slices.Delete(b, i+1, i+2)
+		end--
+	}
+	return b
+}
+
+// toDense converts a sparse HyperLogLog string to dense and sets the register at index to count
+func toDense(b []byte, index int, count uint8) ([]byte, bool, error) {
+	h := &HyperLogLog{}
+	if err := h.decodeSparse(b[headerSize:]); err != nil {
+		return b, false, err
+	}
+	h.registers[index] = count
+	h.dense = true
+	return h.Bytes(), true, nil
+}
+
+// Add adds an element and reports whether a register was changed
+func (h *HyperLogLog) Add(element []byte) bool {
+	index, count := patternLen(element)
+	if h.registers[index] >= count {
+		return false
+	}
+	h.registers[index] = count
+	return true
+}
+
+// Merge sets every register to the larger of the two HyperLogLogs
+func (h *HyperLogLog) Merge(other *HyperLogLog) {
+	for i, value := range other.registers {
+		if value > h.registers[i] {
+			h.registers[i] = value
+		}
+	}
+	if other.dense {
+		h.dense = true
+	}
+}
+
+// Count estimates the cardinality with the estimator of Otmar Ertl, as redis does
+func (h *HyperLogLog) Count() int64 {
+	var histogram [q + 2]int
+	for _, value := range h.registers {
+		histogram[value]++
+	}
+	m := float64(Registers)
+	z := m * tau((m-float64(histogram[q+1]))/m)
+	for j := q; j >= 1; j-- {
+		z += float64(histogram[j])
+		z *= 0.5
+	}
+	z += m * sigma(float64(histogram[0])/m)
+	return int64(math.Round(alphaInf * m * m / z))
+}
+
+// Bytes encodes the HyperLogLog as a string, the cached cardinality is marked as invalid
+func (h *HyperLogLog) Bytes() []byte {
+	var body []byte
+	if !h.dense {
+		body = h.encodeSparse()
+		if body == nil {
+			h.dense = true
+		}
+	}
+	if h.dense {
+		body = make([]byte, denseSize)
+		for i, value := range h.registers {
+			setDenseRegister(body, i, value)
+		}
+	}
+
+	b := make([]byte, headerSize, headerSize+len(body))
+	copy(b, magic)
+	b[4] = encodingSparse
+	if h.dense {
+		b[4] = encodingDense
+	}
+	invalidateCount(b)
+	return append(b, body...)
+}
+
+// patternLen returns the register of the element and the position of the first 1 bit
+// in the rest of its hash, counting from 1
+func patternLen(element []byte) (int, uint8) {
+	hash := murmurHash64A(element, 0xadc83b19)
+	index := int(hash & (Registers - 1))
+	hash >>= precision
+	hash |= 1 << q // makes sure the loop terminates
+	count := uint8(1)
+	for bit := uint64(1); hash&bit == 0; bit <<= 1 {
+		count++
+	}
+	return index, count
+}
+
+// murmurHash64A is the 64 bit MurmurHash2 by Austin Appleby, for little endian machines
+func murmurHash64A(key []byte, seed uint64) uint64 {
+	const m = 0xc6a4a7935bd1e995
+	const r = 47
+	h := seed ^ (uint64(len(key)) * m)
+	for len(key) >= 8 {
+		k := binary.LittleEndian.Uint64(key)
+		k *= m
+		k ^= k >> r
+		k *= m
+		h ^= k
+		h *= m
+		key = key[8:]
+	}
+	if len(key) > 0 {
+		for i := len(key) - 1; i >= 0; i-- {
+			h ^= uint64(key[i]) << (8 * uint(i))
+		}
+		h *= m
+	}
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
+
+func tau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y, z := 1.0, 1-x
+	for {
+		x = math.Sqrt(x)
+		zPrev := z
+		y *= 0.5
+		z -= math.Pow(1-x, 2) * y
+		if zPrev == z {
+			return z / 3
+		}
+	}
+}
+
+func sigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y, z := 1.0, x
+	for {
+		x *= x
+		zPrev := z
+		z += x * y
+		y += y
+		if zPrev == z {
+			return z
+		}
+	}
+}
+
+// dense registers are packed from the least significant bit of each byte
+func getDenseRegister(p []byte, index int) uint8 {
+	bytePos := index * regBits / 8
+	fb := uint(index * regBits & 7)
+	value := uint(p[bytePos]) >> fb
+	if bytePos+1 < len(p) {
+		value |= uint(p[bytePos+1]) << (8 - fb)
+	}
+	return uint8(value & regMax)
+}
+
+func setDenseRegister(p []byte, index int, value uint8) {
+	bytePos := index * regBits / 8
+	fb := uint(index * regBits & 7)
+	p[bytePos] &^= regMax << fb
+	p[bytePos] |= value << fb
+	if bytePos+1 < len(p) {
+		p[bytePos+1] &^= regMax >> (8 - fb)
+		p[bytePos+1] |= value >> (8 - fb)
+	}
+}
+
+// decodeSparse fills the registers from the sparse opcodes
+func (h *HyperLogLog) decodeSparse(p []byte) error {
+	index := 0
+	for i := 0; i < len(p); i++ {
+		op := p[i]
+		switch {
+		case op&0xc0 == 0: // ZERO
+			index += int(op&0x3f) + 1
+		case op&0xc0 == 0x40: // XZERO
+			if i+1 >= len(p) {
+				return ErrCorrupted
+			}
+			index += (int(op&0x3f)<<8 | int(p[i+1])) + 1
+			i++
+		default: // VAL
+			runLen := int(op&0x3) + 1
+			value := (op>>2)&0x1f + 1
+			if index+runLen > Registers {
+				return ErrCorrupted
+			}
+			for j := 0; j < runLen; j++ {
+				h.registers[index+j] = value
+			}
+			index += runLen
+		}
+		if index > Registers {
+			return ErrCorrupted
+		}
+	}
+	if index != Registers {
+		return ErrCorrupted
+	}
+	return nil
+}
+
+// encodeSparse returns the sparse opcodes of the registers,
+// or nil if the sparse encoding cannot be used
+func (h *HyperLogLog) encodeSparse() []byte {
+	p := make([]byte, 0, 16)
+	for i := 0; i < Registers; {
+		value := h.registers[i]
+		runLen := 1
+		for i+runLen < Registers && h.registers[i+runLen] == value {
+			runLen++
+		}
+		i += runLen
+		if value > sparseValMaxValue {
+			return nil
+		}
+		p = appendSparseRun(p, value, runLen)
+		if len(p) > SparseMaxBytes {
+			return nil
+		}
+	}
+	return p
+}
+
+// appendSparseRun appends the opcodes of runLen registers of the same value
+func appendSparseRun(p []byte, value uint8, runLen int) []byte {
+	for runLen > 0 {
+		switch {
+		case value != 0:
+			n := min(runLen, sparseValMaxLen)
+			p = append(p, 0x80|(value-1)<<2|byte(n-1))
+			runLen -= n
+		case runLen > sparseZeroMaxLen:
+			n := min(runLen, sparseXZeroMaxLen)
+			p = append(p, 0x40|byte((n-1)>>8), byte(n-1))
+			runLen -= n
+		default:
+			p = append(p, byte(runLen-1))
+			runLen = 0
+		}
+	}
+	return p
+}
@@ -0,0 +1,219 @@
+package hyperloglog
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+// sparseString makes a sparse HyperLogLog string with the given opcodes
+func sparseString(ops ...byte) []byte {
+	b := make([]byte, headerSize)
+	copy(b, magic)
+	b[4] = encodingSparse
+	return append(b, ops...)
+}
+
+func TestSparseRoundTrip(t *testing.T) {
+	h := New()
+	for i := 0; i < 100; i++ {
+		h.Add([]byte("element:" + strconv.Itoa(i)))
+	}
+	b := h.Bytes()
+	if b[4] != encodingSparse {
+		t.Fatalf("100 elements: encoding %d, want sparse", b[4])
+	}
+	parsed, err := Parse(b)
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	if parsed.IsDense() || parsed.registers != h.registers {
+		t.Error("registers changed after a sparse round trip")
+	}
+	if _, ok := CachedCount(b); ok {
+		t.Error("Bytes() returned a valid cached count")
+	}
+}
+
+func TestSparseToDense(t *testing.T) {
+	tests := []struct {
+		name  string
+		set   func(h *HyperLogLog)
+		dense bool
+	}{
+		{
+			// one VAL opcode per register and an XZERO for the rest
+			name: "at SparseMaxBytes",
+			set: func(h *HyperLogLog) {
+				for i := 0; i < SparseMaxBytes-2; i++ {
+					h.registers[i] = uint8(i%2 + 1)
+				}
+			},
+		},
+		{
+			name: "past SparseMaxBytes",
+			set: func(h *HyperLogLog) {
+				for i := 0; i < SparseMaxBytes-1; i++ {
+					h.registers[i] = uint8(i%2 + 1)
+				}
+			},
+			dense: true,
+		},
+		{name: "register 32", set: func(h *HyperLogLog) { h.registers[100] = 32 }},
+		{name: "register 33", set: func(h *HyperLogLog) { h.registers[100] = 33 }, dense: true},
+	}
+	for _, tt := range tests {
+		h := New()
+		tt.set(h)
+		b := h.Bytes()
+		if dense := b[4] == encodingDense; dense != tt.dense {
+			t.Errorf("%s: dense = %v, want %v", tt.name, dense, tt.dense)
+		}
+		parsed, err := Parse(b)
+		if err != nil {
+			t.Fatalf("%s: Parse() error: %v", tt.name, err)
+		}
+		if parsed.registers != h.registers {
+			t.Errorf("%s: registers changed after a round trip", tt.name)
+		}
+	}
+}
+
+func TestDenseRegisters(t *testing.T) {
+	p := make([]byte, denseSize)
+	for i := 0; i < Registers; i++ {
+		setDenseRegister(p, i, uint8(i*7%64))
+	}
+	for i := 0; i < Registers; i++ {
+		if got := getDenseRegister(p, i); got != uint8(i*7%64) {
+			t.Fatalf("register %d = %d, want %d", i, got, i*7%64)
+		}
+	}
+	// registers 1 and 2 span two bytes, setting them must not touch their neighbours
+	for i := 0; i < 4; i++ {
+		setDenseRegister(p, i, regMax)
+	}
+	setDenseRegister(p, 1, 0)
+	setDenseRegister(p, 2, 0)
+	want := []uint8{regMax, 0, 0, regMax}
+	for i, w := range want {
+		if got := getDenseRegister(p, i); got != w {
+			t.Errorf("register %d = %d, want %d", i, got, w)
+		}
+	}
+	if got := getDenseRegister(p, Registers-1); got != uint8((Registers-1)*7%64) {
+		t.Errorf("last register = %d, want %d", got, (Registers-1)*7%64)
+	}
+}
+
+func TestParseCorrupted(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+		err  error
+	}{
+		{name: "truncated XZERO", b: sparseString(0x40), err: ErrCorrupted},
+		{name: "XZERO past the registers", b: sparseString(0x7f, 0xff, 0x00), err: ErrCorrupted},
+		{name: "VAL past the registers", b: sparseString(0x7f, 0xfe, 0x81), err: ErrCorrupted},
+		{name: "too few registers", b: sparseString(0x00), err: ErrCorrupted},
+		{name: "bad magic", b: []byte("HYLX\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x7f\xff"), err: ErrNotHyperLogLog},
+		{name: "short dense", b: make([]byte, headerSize+1), err: ErrNotHyperLogLog},
+		{name: "empty", b: Empty()},
+	}
+	copy(tests[5].b, magic)
+	for _, tt := range tests {
+		if _, err := Parse(tt.b); err != tt.err {
+			t.Errorf("%s: Parse() error = %v, want %v", tt.name, err, tt.err)
+		}
+		if _, _, err := AddBytes(tt.b, []byte("x")); err != tt.err {
+			t.Errorf("%s: AddBytes() error = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+// TestAddBytes checks the registers set in place in the string against the decoded HyperLogLog
+func TestAddBytes(t *testing.T) {
+	h := New()
+	b := Empty()
+	for i := 0; i < 100000; i++ {
+		element := []byte("element:" + strconv.Itoa(i))
+		want := h.Add(element)
+		var changed bool
+		var err error
+		if b, changed, err = AddBytes(b, element); err != nil {
+			t.Fatalf("AddBytes(%s) error: %v", element, err)
+		}
+		if changed != want {
+			t.Fatalf("AddBytes(%s) changed = %v, want %v", element, changed, want)
+		}
+		if changed {
+			if _, ok := CachedCount(b); ok {
+				t.Fatalf("AddBytes(%s) kept the cached count", element)
+			}
+			SetCachedCount(b, int64(i))
+		}
+		if i%1000 == 0 || i < 3000 && b[4] == encodingSparse {
+			parsed, err := Parse(b)
+			if err != nil {
+				t.Fatalf("after %d elements: Parse() error: %v", i+1, err)
+			}
+			if parsed.registers != h.registers {
+				t.Fatalf("after %d elements: registers differ", i+1)
+			}
+		}
+	}
+	if b[4] != encodingDense {
+		t.Error("100000 elements are still sparse")
+	}
+	if count, ok := CachedCount(b); !ok || count != 99999 {
+		t.Errorf("CachedCount() = %d, %v, want the count set last", count, ok)
+	}
+}
+
+func TestErrorBound(t *testing.T) {
+	const n = 100000
+	h := New()
+	for i := 0; i < n; i++ {
+		h.Add([]byte("element:" + strconv.Itoa(i)))
+	}
+	if got := h.Count(); math.Abs(float64(got-n))/n > 3*0.0081 {
+		t.Errorf("Count() = %d, want %d within 3 standard errors", got, n)
+	}
+	if got := New().Count(); got != 0 {
+		t.Errorf("empty Count() = %d, want 0", got)
+	}
+}
+
+func TestMergeSparseAndDense(t *testing.T) {
+	sparse, dense := New(), New()
+	for i := 0; i < 100; i++ {
+		sparse.Add([]byte("sparse:" + strconv.Itoa(i)))
+	}
+	for i := 0; i < 20000; i++ {
+		dense.Add([]byte("dense:" + strconv.Itoa(i)))
+	}
+	sparseBytes, denseBytes := sparse.Bytes(), dense.Bytes()
+	if sparseBytes[4] != encodingSparse || denseBytes[4] != encodingDense {
+		t.Fatal("unexpected encodings of the merged HyperLogLogs")
+	}
+	merged, err := Parse(sparseBytes)
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	parsedDense, err := Parse(denseBytes)
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	merged.Merge(parsedDense)
+	if !merged.IsDense() {
+		t.Error("merging a dense HyperLogLog did not make the result dense")
+	}
+	for i := range merged.registers {
+		if want := max(sparse.registers[i], dense.registers[i]); merged.registers[i] != want {
+			t.Fatalf("register %d = %d, want %d", i, merged.registers[i], want)
+		}
+	}
+	if got := merged.Count(); math.Abs(float64(got-20100))/20100 > 3*0.0081 {
+		t.Errorf("Count() = %d, want about 20100", got)
+	}
+}
@@ -0,0 +1,466 @@
+// Package list implements the list value type as a quicklist: a doubly linked list of nodes,
+// each node holding a chunk of elements packed in a listpack.
+//
+// Pushing and popping at both ends touches a single node, and an element is found by skipping
+// whole nodes and then walking one listpack, instead of walking one heap node per element.
+// The size limit of the nodes bounds the bytes a node takes, not only the number of its elements.
+package list
+
+import (
+	"goredis/datastruct/listpack"
+)
+
+const (
+	// DefaultFill is the default size limit of a node, 8kb like list-max-listpack-size -2 of redis
+	DefaultFill = -2
+
+	// sizes of a node for the negative fill values -1 to -5
+	minFillBytes = 4096
+	maxFillLevel = 5
+)
+
+// QuickList is a list of byte slices
+type QuickList struct {
+	head *node
+	tail *node
+	size int // number of elements
+	// fill limits the nodes: a positive value is the number of elements,
+	// a negative value -n limits the encoded size of the listpack to 4kb << (n-1)
+	fill      int
+	nodeCount int
+}
+
+type node struct {
+	prev *node
+	next *node
+	lp   *listpack.ListPack // the elements of the node
+}
+
+func newNode() *node {
+	return &node{lp: listpack.New()}
+}
+
+// New creates an empty list whose nodes are limited by fill,
+// 0 means DefaultFill and values below -5 are treated as -5
+func New(fill int) *QuickList {
+	if fill == 0 {
+		fill = DefaultFill
+	}
+	if fill < -maxFillLevel {
+		fill = -maxFillLevel
+	}
+	return &QuickList{fill: fill}
+}
+
+// Len returns the number of elements
+func (ql *QuickList) Len() int {
+	return ql.size
+}
+
+// ObjectEncoding returns listpack while the list fits in a single node
+func (ql *QuickList) ObjectEncoding() string {
+	if ql.nodeCount <= 1 {
+		return "listpack"
+	}
+	return "quicklist"
+}
+
+// allows reports whether one more element fits in the node,
+// an empty node always accepts an element
+func (ql *QuickList) allows(n *node, val string) bool {
+	if n.lp.Len() == 0 {
+		return true
+	}
+	if ql.fill > 0 {
+		return n.lp.Len() < ql.fill
+	}
+	return n.lp.End()+listpack.EntrySize(val) <= minFillBytes<<(-ql.fill-1)
+}
+
+// overflows reports whether the node exceeds the size limit
+func (ql *QuickList) overflows(n *node) bool {
+	if ql.fill > 0 {
+		return n.lp.Len() > ql.fill
+	}
+	return n.lp.End() > minFillBytes<<(-ql.fill-1)
+}
+
+// insertNodeAfter links newNode after n, or as the head if n is nil
+func (ql *QuickList) insertNodeAfter(n *node, newNode *node) {
+	if n == nil {
+		newNode.next = ql.head
+		if ql.head != nil {
+			ql.head.prev = newNode
+		}
+		ql.head = newNode
+	} else {
+		newNode.prev = n
+		newNode.next = n.next
+		if n.next != nil {
+			n.next.prev = newNode
+		}
+		n.next = newNode
+	}
+	if newNode.next == nil {
+		ql.tail = newNode
+	}
+	ql.nodeCount++
+}
+
+func (ql *QuickList) unlinkNode(n *node) {
+	if n.prev != nil {
+		n.prev.next = n.next
+	} else {
+		ql.head = n.next
+	}
+	if n.next != nil {
+		n.next.prev = n.prev
+	} else {
+		ql.tail = n.prev
+	}
+	ql.nodeCount--
+}
+
+// mergeNext moves the elements of the node after n to the end of n and unlinks that node,
+// if both fit in one node. It reports whether the nodes were merged.
+func (ql *QuickList) mergeNext(n *node) bool {
+	next := n.next
+	if next == nil {
+		return false
+	}
+	if ql.fill > 0 && n.lp.Len()+next.lp.Len() > ql.fill ||
+		ql.fill < 0 && n.lp.End()+next.lp.End() > minFillBytes<<(-ql.fill-1) {
+		return false
+	}
+	for pos := 0; pos < next.lp.End(); {
+		var val string
+		val, pos = next.lp.Next(pos)
+		n.lp.Append(val)
+	}
+	ql.unlinkNode(next)
+	return true
+}
+
+// split moves the elements of n from offset on to a new node linked after n, and returns the new node
+func (ql *QuickList) split(n *node, offset int) *node {
+	newNode := newNode()
+	start := posOf(n, offset)
+	for pos := start; pos < n.lp.End(); {
+		var val string
+		val, pos = n.lp.Next(pos)
+		newNode.lp.Append(val)
+	}
+	n.lp.Delete(start, n.lp.Len()-offset)
+	ql.insertNodeAfter(n, newNode)
+	return newNode
+}
+
+// PushFront adds an element at the head of the list
+func (ql *QuickList) PushFront(val []byte) {
+	s := string(val)
+	if ql.head == nil || !ql.allows(ql.head, s) {
+		ql.insertNodeAfter(nil, newNode())
+	}
+	ql.head.lp.Insert(0, s)
+	ql.size++
+}
+
+// PushBack adds an element at the tail of the list
+func (ql *QuickList) PushBack(val []byte) {
+	s := string(val)
+	if ql.tail == nil || !ql.allows(ql.tail, s) {
+		ql.insertNodeAfter(ql.tail, newNode())
+	}
+	ql.tail.lp.Append(s)
+	ql.size++
+}
+
+// PopFront removes and returns the first element, it returns nil if the list is empty
+func (ql *QuickList) PopFront() []byte {
+	if ql.size == 0 {
+		return nil
+	}
+	return ql.removeAt(ql.head, 0)
+}
+
+// PopBack removes and returns the last element, it returns nil if the list is empty
+func (ql *QuickList) PopBack() []byte {
+	if ql.size == 0 {
+		return nil
+	}
+	return ql.removeAt(ql.tail, ql.tail.lp.Last())
+}
+
+// removeAt removes the element at pos of n and returns it, n is unlinked if it becomes empty
+func (ql *QuickList) removeAt(n *node, pos int) []byte {
+	val, _ := n.lp.Next(pos)
+	n.lp.Delete(pos, 1)
+	ql.removed(n, 1)
+	ql.mergeAround(n)
+	return []byte(val)
+}
+
+// removed updates the counters after count elements were removed from n, and unlinks n if it is empty,
+// the caller merges the nodes around n
+func (ql *QuickList) removed(n *node, count int) {
+	ql.size -= count
+	if n.lp.Len() == 0 {
+		ql.unlinkNode(n)
+	}
+}
+
+// mergeAround merges n with its neighbours after elements were removed from it,
+// so removals do not leave a list of small nodes behind. If n was unlinked its neighbours are merged.
+func (ql *QuickList) mergeAround(n *node) {
+	if n.lp.Len() == 0 {
+		if n.prev != nil && n.prev.next == n.next {
+			ql.mergeNext(n.prev)
+		}
+		return
+	}
+	if n.prev != nil && ql.mergeNext(n.prev) {
+		return
+	}
+	ql.mergeNext(n)
+}
+
+// find returns the node holding the element at index and the offset of the element in the node,
+// index must be in [0, Len()), the list is walked from the nearest end
+func (ql *QuickList) find(index int) (*node, int) {
+	if index < ql.size/2 {
+		n := ql.head
+		for index >= n.lp.Len() {
+			index -= n.lp.Len()
+			n = n.next
+		}
+		return n, index
+	}
+	n := ql.tail
+	back := ql.size - 1 - index
+	for back >= n.lp.Len() {
+		back -= n.lp.Len()
+		n = n.prev
+	}
+	return n, n.lp.Len() - 1 - back
+}
+
+// posOf returns the position in the listpack of the element at offset of n,
+// the listpack is walked from the nearest end, an offset of n.lp.Len() is the end of the listpack
+func posOf(n *node, offset int) int {
+	if offset <= n.lp.Len()/2 {
+		return n.lp.Skip(0, offset)
+	}
+	pos := n.lp.End()
+	for i := n.lp.Len(); i > offset; i-- {
+		pos = n.lp.Prev(pos)
+	}
+	return pos
+}
+
+// Get returns the element at index, index must be in [0, Len())
+func (ql *QuickList) Get(index int) []byte {
+	n, offset := ql.find(index)
+	val, _ := n.lp.Next(posOf(n, offset))
+	return []byte(val)
+}
+
+// Set replaces the element at index, index must be in [0, Len())
+func (ql *QuickList) Set(index int, val []byte) {
+	n, offset := ql.find(index)
+	n.lp.Replace(posOf(n, offset), string(val))
+	// a longer value may make the node too large
+	ql.splitOverflow(n, offset)
+}
+
+// splitOverflow splits n in halves until the half holding the element at offset fits in a node,
+// the other halves only hold elements which fitted in n before
+func (ql *QuickList) splitOverflow(n *node, offset int) {
+	for n.lp.Len() > 1 && ql.overflows(n) {
+		half := n.lp.Len() / 2
+		newNode := ql.split(n, half)
+		if offset >= half {
+			n, offset = newNode, offset-half
+		}
+	}
+}
+
+// Insert inserts val before the element at index, index must be in [0, Len()],
+// inserting at Len() appends val
+func (ql *QuickList) Insert(index int, val []byte) {
+	if index == 0 {
+		ql.PushFront(val)
+		return
+	}
+	if index == ql.size {
+		ql.PushBack(val)
+		return
+	}
+	s := string(val)
+	n, offset := ql.find(index)
+	if !ql.allows(n, s) && offset == 0 {
+		// val goes to the end of the node before n, or to a new node between them
+		if n.prev == nil || !ql.allows(n.prev, s) {
+			ql.insertNodeAfter(n.prev, newNode())
+		}
+		n = n.prev
+		offset = n.lp.Len()
+	}
+	n.lp.Insert(posOf(n, offset), s)
+	ql.size++
+	// a full node is split until val fits
+	ql.splitOverflow(n, offset)
+}
+
+// RemoveAt removes and returns the element at index, index must be in [0, Len())
+func (ql *QuickList) RemoveAt(index int) []byte {
+	n, offset := ql.find(index)
+	return ql.removeAt(n, posOf(n, offset))
+}
+
+// RemoveByVal removes up to count elements for which expected returns true, all of them if count is 0.
+// The list is scanned from the head, or from the tail if fromTail is true. It returns the number of removed elements.
+func (ql *QuickList) RemoveByVal(expected func([]byte) bool, count int, fromTail bool) int {
+	removed := 0
+	// last is the last visited node which is still linked, visited nodes are only merged with each other
+	// so the saved next or prev node stays linked, the last one is merged with the rest of the list at the end
+	var last *node
+	if !fromTail {
+		for n := ql.head; n != nil && (count == 0 || removed < count); {
+			next := n.next
+			matched := 0
+			for pos := 0; pos < n.lp.End() && (count == 0 || removed < count); {
+				val, nextPos := n.lp.Next(pos)
+				if expected([]byte(val)) {
+					// the following entries move to pos
+					n.lp.Delete(pos, 1)
+					matched++
+					removed++
+					continue
+				}
+				pos = nextPos
+			}
+			ql.removed(n, matched)
+			if n.lp.Len() > 0 {
+				last = n
+				if n.prev != nil && ql.mergeNext(n.prev) {
+					last = n.prev
+				}
+			}
+			n = next
+		}
+		if last != nil {
+			ql.mergeNext(last)
+		}
+		return removed
+	}
+	for n := ql.tail; n != nil && (count == 0 || removed < count); {
+		prev := n.prev
+		matched := 0
+		for pos := n.lp.Last(); pos >= 0 && (count == 0 || removed < count); {
+			// deleting an entry does not move the entries before it
+			prevPos := n.lp.Prev(pos)
+			if val, _ := n.lp.Next(pos); expected([]byte(val)) {
+				n.lp.Delete(pos, 1)
+				matched++
+				removed++
+			}
+			pos = prevPos
+		}
+		ql.removed(n, matched)
+		if n.lp.Len() > 0 {
+			ql.mergeNext(n)
+			last = n
+		}
+		n = prev
+	}
+	if last != nil && last.prev != nil {
+		ql.mergeNext(last.prev)
+	}
+	return removed
+}
+
+// Trim keeps the elements in [start, stop] and removes the others,
+// start and stop must be in [0, Len()) and start <= stop
+func (ql *QuickList) Trim(start int, stop int) {
+	for removeHead := start; removeHead > 0; {
+		n := ql.head
+		if removeHead >= n.lp.Len() {
+			// whole nodes are dropped at once
+			removeHead -= n.lp.Len()
+			ql.size -= n.lp.Len()
+			ql.unlinkNode(n)
+			continue
+		}
+		n.lp.Delete(0, removeHead)
+		ql.size -= removeHead
+		removeHead = 0
+		ql.mergeNext(n)
+	}
+	for removeTail := ql.size - (stop - start + 1); removeTail > 0; {
+		n := ql.tail
+		if removeTail >= n.lp.Len() {
+			removeTail -= n.lp.Len()
+			ql.size -= n.lp.Len()
+			ql.unlinkNode(n)
+			continue
+		}
+		n.lp.Delete(posOf(n, n.lp.Len()-removeTail), removeTail)
+		ql.size -= removeTail
+		removeTail = 0
+		if n.prev != nil {
+			ql.mergeNext(n.prev)
+		}
+	}
+}
+
+// ForEach visits the elements from index start towards the tail until consumer returns false
+func (ql *QuickList) ForEach(start int, consumer func(i int, val []byte) bool) {
+	if start < 0 || start >= ql.size {
+		return
+	}
+	n, offset := ql.find(start)
+	for i, pos := start, posOf(n, offset); n != nil; n, pos = n.next, 0 {
+		for pos < n.lp.End() {
+			var val string
+			val, pos = n.lp.Next(pos)
+			if !consumer(i, []byte(val)) {
+				return
+			}
+			i++
+		}
+	}
+}
+
+// ReverseForEach visits the elements from index start towards the head until consumer returns false
+func (ql *QuickList) ReverseForEach(start int, consumer func(i int, val []byte) bool) {
+	if start < 0 || start >= ql.size {
+		return
+	}
+	n, offset := ql.find(start)
+	for i, pos := start, posOf(n, offset); n != nil; {
+		for ; pos >= 0; pos = n.lp.Prev(pos) {
+			val, _ := n.lp.Next(pos)
+			if !consumer(i, []byte(val)) {
+				return
+			}
+			i--
+		}
+		n = n.prev
+		if n != nil {
+			pos = n.lp.Last()
+		}
+	}
+}
+
+// Range returns the elements in [start, stop], start and stop must be in [0, Len())
+func (ql *QuickList) Range(start int, stop int) [][]byte {
+	if start > stop {
+		return [][]byte{}
+	}
+	elements := make([][]byte, 0, stop-start+1)
+	ql.ForEach(start, func(i int, val []byte) bool {
+		elements = append(elements, val)
+		return i < stop
+	})
+	return elements
+}
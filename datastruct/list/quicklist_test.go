@@ -0,0 +1,197 @@
+package list
+
+import (
+	"bytes"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// checkList compares the list with the model and checks the links and counters of its nodes
+func checkList(t *testing.T, ql *QuickList, model [][]byte) {
+	t.Helper()
+	nodes, size := 0, 0
+	var prev *node
+	for n := ql.head; n != nil; n = n.next {
+		if n.prev != prev {
+			t.Fatalf("node %d: prev link is broken", nodes)
+		}
+		if n.lp.Len() == 0 {
+			t.Fatalf("node %d is empty", nodes)
+		}
+		if n.lp.Len() > 1 && ql.overflows(n) {
+			t.Fatalf("node %d exceeds the fill %d with %d elements of %d bytes", nodes, ql.fill, n.lp.Len(), n.lp.End())
+		}
+		nodes++
+		size += n.lp.Len()
+		prev = n
+	}
+	if prev != ql.tail {
+		t.Fatal("tail is not the last node")
+	}
+	if nodes != ql.nodeCount || size != ql.size {
+		t.Fatalf("nodeCount %d, size %d, the links hold %d nodes and %d elements", ql.nodeCount, ql.size, nodes, size)
+	}
+	if ql.Len() != len(model) {
+		t.Fatalf("Len() = %d, want %d", ql.Len(), len(model))
+	}
+
+	var forward, backward [][]byte
+	ql.ForEach(0, func(i int, val []byte) bool {
+		if i != len(forward) {
+			t.Fatalf("ForEach index %d, want %d", i, len(forward))
+		}
+		forward = append(forward, val)
+		return true
+	})
+	ql.ReverseForEach(len(model)-1, func(i int, val []byte) bool {
+		if i != len(model)-1-len(backward) {
+			t.Fatalf("ReverseForEach index %d, want %d", i, len(model)-1-len(backward))
+		}
+		backward = append(backward, val)
+		return true
+	})
+	slices.Reverse(backward)
+	for i, want := range model {
+		if !bytes.Equal(forward[i], want) || !bytes.Equal(backward[i], want) {
+			t.Fatalf("element %d: ForEach %q, ReverseForEach %q, want %q", i, forward[i], backward[i], want)
+		}
+	}
+	if len(model) > 0 {
+		i := len(model) / 3
+		if got := ql.Get(i); !bytes.Equal(got, model[i]) {
+			t.Fatalf("Get(%d) = %q, want %q", i, got, model[i])
+		}
+	}
+}
+
+func TestQuickListModel(t *testing.T) {
+	for _, fill := range []int{1, 3, 16, -1, -2} {
+		r := rand.New(rand.NewSource(int64(fill)))
+		ql := New(fill)
+		var model [][]byte
+		value := func() []byte {
+			switch r.Intn(4) {
+			case 0:
+				return []byte(strconv.Itoa(r.Intn(100000) - 500))
+			case 1:
+				return []byte(strings.Repeat("x", r.Intn(1500)))
+			}
+			return []byte("v" + strconv.Itoa(r.Intn(8)))
+		}
+		for step := 0; step < 5000; step++ {
+			val := value()
+			switch op := r.Intn(10); {
+			case op == 0:
+				ql.PushFront(val)
+				model = slices.Insert(model, 0, val)
+			case op <= 2:
+				ql.PushBack(val)
+				model = append(model, val)
+			case op == 3 && len(model) > 0:
+				if got := ql.PopFront(); !bytes.Equal(got, model[0]) {
+					t.Fatalf("fill %d: PopFront() = %q, want %q", fill, got, model[0])
+				}
+				model = model[1:]
+			case op == 4 && len(model) > 0:
+				if got := ql.PopBack(); !bytes.Equal(got, model[len(model)-1]) {
+					t.Fatalf("fill %d: PopBack() = %q, want %q", fill, got, model[len(model)-1])
+				}
+				model = model[:len(model)-1]
+			case op == 5:
+				i := r.Intn(len(model) + 1)
+				ql.Insert(i, val)
+				model = slices.Insert(model, i, val)
+			case op == 6 && len(model) > 0:
+				i := r.Intn(len(model))
+				ql.Set(i, val)
+				model[i] = val
+			case op == 7 && len(model) > 0:
+				i := r.Intn(len(model))
+				if got := ql.RemoveAt(i); !bytes.Equal(got, model[i]) {
+					t.Fatalf("fill %d: RemoveAt(%d) = %q, want %q", fill, i, got, model[i])
+				}
+				model = slices.Delete(model, i, i+1)
+			case op == 8:
+				target := []byte("v" + strconv.Itoa(r.Intn(8)))
+				count, fromTail := r.Intn(3), r.Intn(2) == 0
+				got := ql.RemoveByVal(func(val []byte) bool { return bytes.Equal(val, target) }, count, fromTail)
+				want := 0
+				for j := range model {
+					i := j
+					if fromTail {
+						i = len(model) - 1 - j
+					}
+					if (count == 0 || want < count) && bytes.Equal(model[i], target) {
+						model[i] = nil
+						want++
+					}
+				}
+				model = slices.DeleteFunc(model, func(val []byte) bool { return val == nil })
+				if got != want {
+					t.Fatalf("fill %d: RemoveByVal(%q, %d, %v) = %d, want %d", fill, target, count, fromTail, got, want)
+				}
+			case op == 9 && len(model) > 0 && r.Intn(5) == 0:
+				start := r.Intn(len(model))
+				stop := start + r.Intn(len(model)-start)
+				ql.Trim(start, stop)
+				model = slices.Clone(model[start : stop+1])
+			}
+			checkList(t, ql, model)
+		}
+	}
+}
+
+// makeNumbers returns a list of fill 4 holding 1..n
+func makeNumbers(n int) *QuickList {
+	ql := New(4)
+	for i := 1; i <= n; i++ {
+		ql.PushBack([]byte(strconv.Itoa(i)))
+	}
+	return ql
+}
+
+func TestQuickListMerge(t *testing.T) {
+	odd := func(val []byte) bool {
+		n, _ := strconv.Atoi(string(val))
+		return n%2 == 1
+	}
+	tests := []struct {
+		name   string
+		remove func(ql *QuickList)
+		nodes  int
+	}{
+		{name: "RemoveByVal from the head", remove: func(ql *QuickList) { ql.RemoveByVal(odd, 0, false) }, nodes: 2},
+		{name: "RemoveByVal from the tail", remove: func(ql *QuickList) { ql.RemoveByVal(odd, 0, true) }, nodes: 2},
+		{name: "RemoveByVal with a count", remove: func(ql *QuickList) { ql.RemoveByVal(odd, 4, false) }, nodes: 3},
+		{
+			name: "RemoveAt",
+			remove: func(ql *QuickList) {
+				// 5 and 6 leave 7 8 in the second node, then 9 and 10 let 11 12 join it
+				for range 2 {
+					ql.RemoveAt(4)
+				}
+				for range 2 {
+					ql.RemoveAt(6)
+				}
+			},
+			nodes: 3,
+		},
+		{name: "Trim to a small list", remove: func(ql *QuickList) { ql.Trim(2, 5) }, nodes: 1},
+	}
+	for _, tt := range tests {
+		ql := makeNumbers(16)
+		tt.remove(ql)
+		if ql.nodeCount != tt.nodes {
+			t.Errorf("%s: %d nodes, want %d", tt.name, ql.nodeCount, tt.nodes)
+		}
+	}
+
+	ql := makeNumbers(16)
+	ql.Trim(2, 5)
+	if got := ql.ObjectEncoding(); got != "listpack" {
+		t.Errorf("ObjectEncoding() of 4 elements = %s, want listpack", got)
+	}
+}
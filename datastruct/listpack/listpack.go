@@ -0,0 +1,268 @@
+// Package listpack implements a list of strings packed in one contiguous byte buffer,
+// the compact encoding of small hashes and sorted sets.
+//
+// Every entry starts with an encoding byte:
+//
+//	0xxxxxxx                   an integer from 0 to 127, stored in the encoding byte itself
+//	10xxxxxx <bytes>           a string of up to 63 bytes, the low 6 bits are its length
+//	11000000 <varint>          any other int64, as a zigzag varint
+//	11000001 <uvarint> <bytes> a longer string, preceded by its length
+//
+// A value is stored as an integer only if it is the canonical decimal form of an int64,
+// so every value reads back exactly as it was written.
+//
+// Every entry ends with its back length, the size of the encoding byte and the data,
+// so the list can also be walked from the tail. It is stored in 7 bit groups, the last byte
+// holds the lowest bits and the high bit of a byte is set when there are more bytes before it.
+//
+// Entries are addressed by their position, the offset of their first byte in the buffer.
+// Positions are only valid until the list is changed.
+package listpack
+
+import (
+	"encoding/binary"
+	"slices"
+	"strconv"
+)
+
+const (
+	enc7BitUint = 0x00
+	encSmallStr = 0x80
+	encInt      = 0xc0
+	encStr      = 0xc1
+
+	smallStrMaxLen = 1<<6 - 1
+	uint7Max       = 1<<7 - 1
+)
+
+// ListPack is a list of strings in a single byte buffer
+type ListPack struct {
+	buf []byte
+	n   int // number of entries
+}
+
+// New creates an empty list
+func New() *ListPack {
+	return &ListPack{}
+}
+
+// Len returns the number of entries
+func (lp *ListPack) Len() int {
+	return lp.n
+}
+
+// End returns the position after the last entry, where Insert appends
+func (lp *ListPack) End() int {
+	return len(lp.buf)
+}
+
+// parseInt returns the integer of val if val is its canonical decimal form
+func parseInt(val string) (int64, bool) {
+	if len(val) == 0 || len(val) > 20 {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(val, 10, 64)
+	if err != nil || strconv.FormatInt(v, 10) != val {
+		return 0, false
+	}
+	return v, true
+}
+
+// appendEntry appends the encoded entry of val and its back length to buf
+func appendEntry(buf []byte, val string) []byte {
+	start := len(buf)
+	if v, ok := parseInt(val); ok {
+		if v >= 0 && v <= uint7Max {
+			buf = append(buf, enc7BitUint|byte(v))
+		} else {
+			buf = binary.AppendVarint(append(buf, encInt), v)
+		}
+	} else if len(val) <= smallStrMaxLen {
+		buf = append(append(buf, encSmallStr|byte(len(val))), val...)
+	} else {
+		buf = binary.AppendUvarint(append(buf, encStr), uint64(len(val)))
+		buf = append(buf, val...)
+	}
+	return appendBackLen(buf, len(buf)-start)
+}
+
+// EntrySize returns the number of bytes the entry of val takes, including its back length
+func EntrySize(val string) int {
+	var raw [binary.MaxVarintLen64]byte
+	n := 1
+	if v, ok := parseInt(val); ok {
+		if v < 0 || v > uint7Max {
+			n += binary.PutVarint(raw[:], v)
+		}
+	} else if len(val) <= smallStrMaxLen {
+		n += len(val)
+	} else {
+		n += binary.PutUvarint(raw[:], uint64(len(val))) + len(val)
+	}
+	return n + backLenSize(n)
+}
+
+// backLenSize returns the number of bytes of the back length of an entry of n bytes
+func backLenSize(n int) int {
+	size := 1
+	for ; n > 0x7f; n >>= 7 {
+		size++
+	}
+	return size
+}
+
+// appendBackLen appends the back length n, the highest 7 bits first
+func appendBackLen(buf []byte, n int) []byte {
+	size := backLenSize(n)
+	for i := size - 1; i >= 0; i-- {
+		b := byte(n>>(7*i)) & 0x7f
+		if i < size-1 {
+			b |= 0x80 // there are more bytes before this one
+		}
+		buf = append(buf, b)
+	}
+	return buf
+}
+
+// readBackLen reads the back length which ends right before end,
+// it returns the length and the position of its first byte
+func (lp *ListPack) readBackLen(end int) (n int, start int) {
+	for shift := 0; ; shift += 7 {
+		end--
+		b := lp.buf[end]
+		n |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return n, end
+		}
+	}
+}
+
+// decode returns the entry at pos, either as bytes of the buffer or as an integer,
+// and the position of the next entry
+func (lp *ListPack) decode(pos int) (str []byte, v int64, isInt bool, next int) {
+	b := lp.buf[pos]
+	var end int
+	switch {
+	case b&0x80 == enc7BitUint:
+		v, isInt, end = int64(b), true, pos+1
+	case b&0xc0 == encSmallStr:
+		start := pos + 1
+		end = start + int(b&smallStrMaxLen)
+		str = lp.buf[start:end]
+	case b == encInt:
+		var size int
+		v, size = binary.Varint(lp.buf[pos+1:])
+		isInt, end = true, pos+1+size
+	default:
+		n, size := binary.Uvarint(lp.buf[pos+1:])
+		start := pos + 1 + size
+		end = start + int(n)
+		str = lp.buf[start:end]
+	}
+	return str, v, isInt, end + backLenSize(end-pos)
+}
+
+// Next returns the value of the entry at pos and the position of the next entry,
+// pos must be the position of an entry
+func (lp *ListPack) Next(pos int) (string, int) {
+	str, v, isInt, next := lp.decode(pos)
+	if isInt {
+		return strconv.FormatInt(v, 10), next
+	}
+	return string(str), next
+}
+
+// Last returns the position of the last entry, or -1 if the list is empty
+func (lp *ListPack) Last() int {
+	return lp.Prev(len(lp.buf))
+}
+
+// Prev returns the position of the entry before the entry at pos, or -1 if pos is the first entry.
+// Prev(End()) is the last entry.
+func (lp *ListPack) Prev(pos int) int {
+	if pos <= 0 {
+		return -1
+	}
+	n, start := lp.readBackLen(pos)
+	return start - n
+}
+
+// Skip returns the position n entries after pos, or End() if there are fewer entries
+func (lp *ListPack) Skip(pos int, n int) int {
+	for ; n > 0 && pos < len(lp.buf); n-- {
+		_, _, _, pos = lp.decode(pos)
+	}
+	return pos
+}
+
+// Find returns the position of the first entry equal to val, or -1 if there is none.
+// After each compared entry the next skip entries are not compared,
+// e.g. a skip of 1 only looks at the keys of a list of key value pairs.
+func (lp *ListPack) Find(val string, skip int) int {
+	target, targetIsInt := parseInt(val)
+	for pos, i := 0, 0; pos < len(lp.buf); i++ {
+		str, v, isInt, next := lp.decode(pos)
+		if i%(skip+1) == 0 && isInt == targetIsInt {
+			if (isInt && v == target) || (!isInt && string(str) == val) {
+				return pos
+			}
+		}
+		pos = next
+	}
+	return -1
+}
+
+// ForEach visits the entries from the head until consumer returns false
+func (lp *ListPack) ForEach(consumer func(pos int, val string) bool) {
+	for pos := 0; pos < len(lp.buf); {
+		val, next := lp.Next(pos)
+		if !consumer(pos, val) {
+			return
+		}
+		pos = next
+	}
+}
+
+// ForEachReverse visits the entries from the tail until consumer returns false
+func (lp *ListPack) ForEachReverse(consumer func(pos int, val string) bool) {
+	for pos := lp.Last(); pos >= 0; pos = lp.Prev(pos) {
+		val, _ := lp.Next(pos)
+		if !consumer(pos, val) {
+			return
+		}
+	}
+}
+
+// Insert inserts the values before the entry at pos, inserting at End() appends them
+func (lp *ListPack) Insert(pos int, vals ...string) {
+	var entries []byte
+	for _, val := range vals {
+		entries = appendEntry(entries, val)
+	}
+	lp.buf = slices.Insert(lp.buf, pos, entries...)
+	lp.n += len(vals)
+}
+
+// Append adds the values at the tail
+func (lp *ListPack) Append(vals ...string) {
+	for _, val := range vals {
+		lp.buf = appendEntry(lp.buf, val)
+	}
+	lp.n += len(vals)
+}
+
+// Replace replaces the value of the entry at pos
+func (lp *ListPack) Replace(pos int, val string) {
+	_, _, _, next := lp.decode(pos)
+	lp.buf = slices.Replace(lp.buf, pos, next, appendEntry(nil, val)...)
+}
+
+// Delete removes count entries starting from the entry at pos
+func (lp *ListPack) Delete(pos int, count int) {
+	end := pos
+	for i := 0; i < count && end < len(lp.buf); i++ {
+		_, _, _, end = lp.decode(end)
+		lp.n--
+	}
+	lp.buf = slices.Delete(lp.buf, pos, end)
+}
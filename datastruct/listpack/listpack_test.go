@@ -0,0 +1,163 @@
+package listpack
+
+import (
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// values returns the entries of the list from the head and from the tail
+func values(lp *ListPack) (forward []string, backward []string) {
+	forward, backward = []string{}, []string{}
+	lp.ForEach(func(pos int, val string) bool {
+		forward = append(forward, val)
+		return true
+	})
+	lp.ForEachReverse(func(pos int, val string) bool {
+		backward = append(backward, val)
+		return true
+	})
+	return forward, backward
+}
+
+func TestEncoding(t *testing.T) {
+	tests := []struct {
+		val  string
+		size int // encoded size including the back length
+	}{
+		{val: "0", size: 2},
+		{val: "127", size: 2},
+		{val: "128", size: 1 + 2 + 1},
+		{val: "-1", size: 1 + 1 + 1},
+		{val: "9223372036854775807", size: 1 + 10 + 1},
+		{val: "-9223372036854775808", size: 1 + 10 + 1},
+		// not the canonical form of an int64, stored as strings
+		{val: "9223372036854775808", size: 1 + 19 + 1},
+		{val: "007", size: 1 + 3 + 1},
+		{val: "-0", size: 1 + 2 + 1},
+		{val: "+1", size: 1 + 2 + 1},
+		{val: "1.5", size: 1 + 3 + 1},
+		{val: "", size: 1 + 1},
+		{val: strings.Repeat("a", 63), size: 1 + 63 + 1},
+		{val: strings.Repeat("a", 64), size: 1 + 1 + 64 + 1},
+		{val: strings.Repeat("a", 125), size: 1 + 1 + 125 + 1},
+		// the entry is longer than 127 bytes, the back length takes two bytes
+		{val: strings.Repeat("a", 126), size: 1 + 1 + 126 + 2},
+		{val: strings.Repeat("a", 1000), size: 1 + 2 + 1000 + 2},
+		{val: strings.Repeat("a", 20000), size: 1 + 3 + 20000 + 3},
+	}
+	for _, tt := range tests {
+		lp := New()
+		lp.Append("x", tt.val, "y")
+		// "x" and "y" take 3 bytes each
+		if got := lp.End() - 6; got != tt.size {
+			t.Errorf("%.20q: encoded size %d, want %d", tt.val, got, tt.size)
+		}
+		if got := EntrySize(tt.val); got != tt.size {
+			t.Errorf("%.20q: EntrySize() = %d, want %d", tt.val, got, tt.size)
+		}
+		forward, backward := values(lp)
+		if want := []string{"x", tt.val, "y"}; !slices.Equal(forward, want) {
+			t.Errorf("%.20q: read back %.20q", tt.val, forward)
+		}
+		if want := []string{"y", tt.val, "x"}; !slices.Equal(backward, want) {
+			t.Errorf("%.20q: read back from the tail %.20q", tt.val, backward)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	lp := New()
+	lp.Append("a", "1", "b", "a", "1", "2")
+	tests := []struct {
+		val   string
+		skip  int
+		index int // index of the entry found, -1 if none
+	}{
+		{val: "a", skip: 0, index: 0},
+		{val: "1", skip: 0, index: 1},
+		{val: "2", skip: 0, index: 5},
+		{val: "c", skip: 0, index: -1},
+		// with skip 1 only even entries are compared, like the fields of a hash
+		{val: "a", skip: 1, index: 0},
+		{val: "1", skip: 1, index: 4},
+		{val: "b", skip: 1, index: 2},
+		{val: "2", skip: 1, index: -1},
+	}
+	for _, tt := range tests {
+		pos := lp.Find(tt.val, tt.skip)
+		want := -1
+		if tt.index >= 0 {
+			want = lp.Skip(0, tt.index)
+		}
+		if pos != want {
+			t.Errorf("Find(%q, %d) = %d, want %d", tt.val, tt.skip, pos, want)
+		}
+	}
+}
+
+func TestPrev(t *testing.T) {
+	lp := New()
+	if lp.Last() != -1 || lp.Prev(lp.End()) != -1 {
+		t.Errorf("empty list: Last() = %d, Prev(End()) = %d", lp.Last(), lp.Prev(lp.End()))
+	}
+	lp.Append("a", strings.Repeat("b", 200), "3")
+	positions := []int{0, lp.Skip(0, 1), lp.Skip(0, 2)}
+	tests := []struct {
+		pos  int
+		want int
+	}{
+		{pos: lp.End(), want: positions[2]},
+		{pos: positions[2], want: positions[1]},
+		{pos: positions[1], want: positions[0]},
+		{pos: positions[0], want: -1},
+	}
+	for _, tt := range tests {
+		if got := lp.Prev(tt.pos); got != tt.want {
+			t.Errorf("Prev(%d) = %d, want %d", tt.pos, got, tt.want)
+		}
+	}
+	if lp.Last() != positions[2] {
+		t.Errorf("Last() = %d, want %d", lp.Last(), positions[2])
+	}
+}
+
+// TestOperations applies random changes to a list and to a slice and compares them
+func TestOperations(t *testing.T) {
+	lp := New()
+	var model []string
+	vals := []string{"0", "127", "128", "-1", "007", "", strings.Repeat("x", 63), strings.Repeat("y", 64),
+		strings.Repeat("z", 1000), "9223372036854775807", "-9223372036854775808", "abc", "1.5"}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 3000; i++ {
+		v := vals[r.Intn(len(vals))]
+		if r.Intn(3) == 0 {
+			v = strconv.Itoa(r.Intn(100000) - 50000)
+		}
+		switch op := r.Intn(4); {
+		case op == 0 || len(model) == 0:
+			lp.Append(v)
+			model = append(model, v)
+		case op == 1:
+			index := r.Intn(len(model) + 1)
+			lp.Insert(lp.Skip(0, index), v)
+			model = slices.Insert(model, index, v)
+		case op == 2:
+			index := r.Intn(len(model))
+			lp.Replace(lp.Skip(0, index), v)
+			model[index] = v
+		default:
+			index := r.Intn(len(model))
+			n := min(1+r.Intn(2), len(model)-index)
+			lp.Delete(lp.Skip(0, index), n)
+			model = slices.Delete(model, index, index+n)
+		}
+		forward, backward := values(lp)
+		slices.Reverse(backward)
+		if lp.Len() != len(model) || !slices.Equal(forward, model) || !slices.Equal(backward, model) {
+			t.Fatalf("step %d: list differs from %d entries of the model", i, len(model))
+		}
+	}
+}
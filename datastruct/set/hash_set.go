@@ -1,71 +1,148 @@
 package set
 
 import (
+	"goredis/datastruct/listpack"
+	"goredis/lib/cursor"
 	"math/rand"
 	"strconv"
 	"time"
 )
 
+// HashSet 根据成员选择最紧凑的编码：
+// 成员都是整数时使用整数集合，成员较少且较短时使用 listpack，否则使用哈希表。
+// 编码只在添加成员时向更宽松的方向转换，listpack 编码的集合删除最后一个非整数成员后会转换回整数集合
 type HashSet struct {
-	dict     map[string]struct{}
-	intset   *IntSet //存储整数集合
-	isIntset bool    //标识当前集合是否为整数集合（用于切换底层实现）
+	encoding int
+	intset   *IntSet             // 整数集合编码时存储成员
+	listpack *listpack.ListPack  // listpack 编码时存储成员
+	dict     map[string]struct{} // 哈希表编码时存储成员
+	index    *cursor.Index       // 哈希表编码时按哈希值分桶保存成员，供 SSCAN 按游标遍历
+	limits   Limits
 }
 
 // NewHashSet creates a new HashSet
-func NewHashSet() *HashSet {
+func NewHashSet(limits Limits) *HashSet {
 	return &HashSet{
-		dict:     make(map[string]struct{}),
+		encoding: EncodingIntSet, // 默认使用整数集合
 		intset:   NewIntSet(),
-		isIntset: true, // 默认使用整数集合
+		limits:   limits.withDefaults(),
 	}
 }
+
+// NewHashSetFrom 用不重复的成员创建集合，直接选择能容纳所有成员的最紧凑的编码
+func NewHashSetFrom(limits Limits, members []string) *HashSet {
+	set := NewHashSet(limits)
+	set.encoding = set.limits.encodingFor(members)
+	switch set.encoding {
+	case EncodingListpack:
+		set.intset = nil
+		set.listpack = listpack.New()
+		set.listpack.Append(members...)
+		return set
+	case EncodingHashTable:
+		set.intset = nil
+		set.dict = make(map[string]struct{}, len(members))
+		set.index = cursor.NewIndex(len(members))
+	}
+	for _, member := range members {
+		set.Add(member)
+	}
+	return set
+}
+
+// parseIntMember 判断成员能否存入整数集合，只有整数的规范十进制形式才能存入，例如 "007" 不能
+func parseIntMember(member string) (int64, bool) {
+	if len(member) == 0 || len(member) > 20 {
+		return 0, false
+	}
+	val, err := strconv.ParseInt(member, 10, 64)
+	if err != nil || strconv.FormatInt(val, 10) != member {
+		return 0, false
+	}
+	return val, true
+}
+
 func (set *HashSet) Add(member string) int {
-	// 如果当前集合是整数集合
-	if set.isIntset {
+	switch set.encoding {
+	case EncodingIntSet:
 		// 尝试将成员转换为64位整数
-		if val, err := strconv.ParseInt(member, 10, 64); err == nil {
-			if ok := set.intset.Add(val); ok {
-				if set.intset.Len() > SET_MAX_INTSET_ENTRIES {
-					set.convertToHashTable()
-				}
-				return 1 // 添加成功返回1
+		if val, ok := parseIntMember(member); ok {
+			if ok := set.intset.Add(val); !ok {
+				return 0 // 如果添加失败，说明已经存在
+			}
+			if set.intset.Len() > set.limits.MaxIntsetEntries {
+				set.convertToHashTable()
 			}
-			return 0 // 如果添加失败，说明已经存在
-		} else {
-			// 如果转换失败，说明不是整数，转换为哈希表
-			set.convertToHashTable()
+			return 1 // 添加成功返回1
 		}
+		// 如果转换失败，说明不是整数，成员不多时转换为 listpack，否则转换为哈希表
+		if set.intset.Len() < set.limits.MaxListpackEntries && len(member) <= set.limits.MaxListpackValue {
+			set.convertToListpack()
+			set.listpack.Append(member)
+			return 1
+		}
+		set.convertToHashTable()
+	case EncodingListpack:
+		if set.listpack.Find(member, 0) >= 0 {
+			return 0
+		}
+		if set.listpack.Len() < set.limits.MaxListpackEntries && len(member) <= set.limits.MaxListpackValue {
+			set.listpack.Append(member)
+			return 1
+		}
+		set.convertToHashTable()
 	}
 	// 如果当前集合是哈希表，直接添加到哈希表中
 	if _, ok := set.dict[member]; ok {
 		return 0 // 如果成员已经存在，返回0
 	}
 	set.dict[member] = struct{}{} // 添加成员到哈希表中
-	return 1                      // 添加成功返回1
+	set.index.Add(member)
+	return 1 // 添加成功返回1
+}
+
+// convertToListpack 将整数集合转换为 listpack
+func (set *HashSet) convertToListpack() {
+	set.listpack = listpack.New()
+	set.intset.ForEach(func(value int64) bool {
+		set.listpack.Append(strconv.FormatInt(value, 10))
+		return true
+	})
+	set.intset = nil
+	set.encoding = EncodingListpack
 }
 
-// convertToHashTable 将整数集合转换为哈希表
+// convertToHashTable 将整数集合或 listpack 转换为哈希表
 func (set *HashSet) convertToHashTable() {
 	// 检查当前集合是否已经是哈希表
-	if !set.isIntset {
+	if set.encoding == EncodingHashTable {
 		return
 	}
 	// 复制元素到哈希表中
-	set.intset.ForEach(func(value int64) bool {
-		set.dict[strconv.FormatInt(value, 10)] = struct{}{}
+	set.dict = make(map[string]struct{}, set.Len())
+	set.index = cursor.NewIndex(set.Len())
+	set.ForEach(func(member string) bool {
+		set.dict[member] = struct{}{}
+		set.index.Add(member)
 		return true
 	})
-	set.isIntset = false
-	set.intset = nil // 释放整数集合的内存
+	set.encoding = EncodingHashTable
+	// 释放整数集合和 listpack 的内存
+	set.intset = nil
+	set.listpack = nil
 }
 
 func (set *HashSet) ForEach(consumer func(member string) bool) {
-	if set.isIntset {
+	switch set.encoding {
+	case EncodingIntSet:
 		set.intset.ForEach(func(value int64) bool {
 			return consumer(strconv.FormatInt(value, 10))
 		})
-	} else {
+	case EncodingListpack:
+		set.listpack.ForEach(func(pos int, member string) bool {
+			return consumer(member)
+		})
+	default:
 		for member := range set.dict {
 			if !consumer(member) {
 				break
@@ -76,53 +153,79 @@ func (set *HashSet) ForEach(consumer func(member string) bool) {
 
 // Len 返回集合的长度
 func (set *HashSet) Len() int {
-	if set.isIntset {
+	switch set.encoding {
+	case EncodingIntSet:
 		return set.intset.Len()
+	case EncodingListpack:
+		return set.listpack.Len()
 	}
 	return len(set.dict)
 }
 
 // Contains 判断集合中是否包含某个成员
 func (set *HashSet) Contains(member string) bool {
-	if set.isIntset {
-		if val, err := strconv.ParseInt(member, 10, 64); err == nil {
+	switch set.encoding {
+	case EncodingIntSet:
+		if val, ok := parseIntMember(member); ok {
 			return set.intset.Contains(val)
 		}
 		return false
+	case EncodingListpack:
+		return set.listpack.Find(member, 0) >= 0
 	}
 	_, ok := set.dict[member]
 	return ok
 }
 
+// ContainsMany 依次判断多个成员是否在集合中
+func (set *HashSet) ContainsMany(members []string) []bool {
+	result := make([]bool, len(members))
+	for i, member := range members {
+		switch set.encoding {
+		case EncodingIntSet:
+			// 不是整数的成员不可能在整数集合中
+			if val, ok := parseIntMember(member); ok {
+				result[i] = set.intset.Contains(val)
+			}
+		case EncodingListpack:
+			result[i] = set.listpack.Find(member, 0) >= 0
+		default:
+			_, result[i] = set.dict[member]
+		}
+	}
+	return result
+}
+
 // Members 返回集合中的所有成员
 func (set *HashSet) Members() []string {
-	if set.isIntset { // 如果当前集合是整数集合
-		members := make([]string, 0, set.intset.Len())
-		set.intset.ForEach(func(value int64) bool {
-			members = append(members, strconv.FormatInt(value, 10))
-			return true
-		})
-		return members
-	}
-	// 如果当前集合是哈希表
-	members := make([]string, 0, len(set.dict))
-	for member := range set.dict {
+	members := make([]string, 0, set.Len())
+	set.ForEach(func(member string) bool {
 		members = append(members, member)
-	}
+		return true
+	})
 	return members
 }
 
 // Remove 移除集合中的一个成员，返回移除的成员数量
 func (set *HashSet) Remove(member string) int {
-	if set.isIntset {
+	switch set.encoding {
+	case EncodingIntSet:
 		// 如果当前集合是整数集合，尝试将成员转换为64位整数
-		if val, err := strconv.ParseInt(member, 10, 64); err == nil {
-			if ok := set.intset.Remove(val); ok {
-				return 1
-			}
-			return 0
+		if val, ok := parseIntMember(member); ok && set.intset.Remove(val) {
+			return 1
 		}
 		return 0 // 如果转换失败，说明不是整数
+	case EncodingListpack:
+		pos := set.listpack.Find(member, 0)
+		if pos < 0 {
+			return 0
+		}
+		set.listpack.Delete(pos, 1)
+		// 删除的是非整数成员时，剩下的成员可能都是整数了
+		if _, ok := parseIntMember(member); !ok {
+			set.tryConvertToIntSet()
+		}
+		return 1
 	}
 
 	if _, exists := set.dict[member]; !exists {
@@ -130,9 +233,35 @@ func (set *HashSet) Remove(member string) int {
 	}
 	// 如果当前集合是哈希表，直接从哈希表中删除成员
 	delete(set.dict, member)
+	set.index.Remove(member)
 	return 1
 }
 
+// tryConvertToIntSet 在 listpack 的成员都是整数且数量不超过 MaxIntsetEntries 时转换回整数集合，
+// 先检查所有成员，遇到第一个非整数成员即停止，确认都是整数后才构建整数集合
+func (set *HashSet) tryConvertToIntSet() {
+	if set.listpack.Len() > set.limits.MaxIntsetEntries {
+		return
+	}
+	allInts := true
+	set.listpack.ForEach(func(pos int, member string) bool {
+		_, allInts = parseIntMember(member)
+		return allInts
+	})
+	if !allInts {
+		return
+	}
+	ints := NewIntSet()
+	set.listpack.ForEach(func(pos int, member string) bool {
+		val, _ := parseIntMember(member)
+		ints.Add(val)
+		return true
+	})
+	set.intset = ints
+	set.listpack = nil
+	set.encoding = EncodingIntSet
+}
+
 // RandomDistinctMembers 随机返回集合中的不重复成员
 func (set *HashSet) RandomDistinctMembers(count int) []string {
 	size := set.Len()
@@ -159,13 +288,46 @@ func (set *HashSet) RandomMembers(count int) []string {
 	if count <= 0 || size == 0 {
 		return []string{}
 	}
- 
+
 	res := make([]string, count)
 	members := set.Members()
 	r := rand.New(rand.NewSource(time.Now().UnixNano()))
- 
+
 	for i := 0; i < count; i++ {
 		res[i] = members[r.Intn(size)]
 	}
 	return res
 }
+
+// Scan 按游标遍历集合，返回本次遍历的成员和下一次的游标，游标为0表示遍历结束
+// 整数集合和 listpack 编码的集合很小，一次返回所有成员，哈希表编码时只访问游标之后约 count 个成员
+func (set *HashSet) Scan(cur uint64, count int) ([]string, uint64) {
+	if set.encoding != EncodingHashTable {
+		return set.Members(), 0
+	}
+	return set.index.Scan(cur, count)
+}
+
+// Encoding 返回集合当前的编码
+func (set *HashSet) Encoding() int {
+	return set.encoding
+}
+
+// ObjectEncoding 返回 OBJECT ENCODING 命令显示的编码名称
+func (set *HashSet) ObjectEncoding() string {
+	switch set.encoding {
+	case EncodingIntSet:
+		return "intset"
+	case EncodingListpack:
+		return "listpack"
+	}
+	return "hashtable"
+}
+
+// Ints 在集合为整数集合编码时返回所有整数，ok 为 false 表示集合是其他编码
+func (set *HashSet) Ints() ([]int64, bool) {
+	if set.encoding != EncodingIntSet {
+		return nil, false
+	}
+	return set.intset.ToSlice(), true
+}
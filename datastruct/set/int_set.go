@@ -130,7 +130,7 @@ func (is *IntSet) insertAt(pos int, value int64) {
 	newLen := oldLen + int(is.encoding)
 	if newLen > cap(is.contents) {
 		// 容量不足，扩展容量
-		newContents := make([]byte, newLen*2)
+		newContents := make([]byte, newLen, newLen*2)
 		copy(newContents, is.contents)
 		is.contents = newContents
 	} else {
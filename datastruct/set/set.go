@@ -1,18 +1,126 @@
 package set
 
+import (
+	"slices"
+	"strconv"
+)
+
 type Set interface {
-	Add(member string) int                     // 添加成员到集合中，返回添加的成员数量
-	Len() int                                  // 返回集合的长度
-	ForEach(consumer func(member string) bool) // 遍历集合中的每个元素
-	Contains(member string) bool               // 判断集合中是否包含某个成员
-	Members() []string                         // 返回集合中的所有成员
-	Remove(member string) int                  // 移除集合中的一个成员，返回移除的成员数量
-	RandomDistinctMembers(count int) []string  // 随机返回集合中的不重复成员
-	RandomMembers(count int) []string          // 随机返回集合中的成员
+	Add(member string) int                         // 添加成员到集合中，返回添加的成员数量
+	Len() int                                      // 返回集合的长度
+	ForEach(consumer func(member string) bool)     // 遍历集合中的每个元素
+	Contains(member string) bool                   // 判断集合中是否包含某个成员
+	ContainsMany(members []string) []bool          // 依次判断多个成员是否在集合中
+	Members() []string                             // 返回集合中的所有成员
+	Remove(member string) int                      // 移除集合中的一个成员，返回移除的成员数量
+	RandomDistinctMembers(count int) []string      // 随机返回集合中的不重复成员
+	RandomMembers(count int) []string              // 随机返回集合中的成员
+	Scan(cur uint64, count int) ([]string, uint64) // 按游标遍历集合，返回本次的成员和下一次的游标
+	Encoding() int                                 // 返回集合当前的编码
+	ObjectEncoding() string                        // 返回 OBJECT ENCODING 命令显示的编码名称
 
 }
 
+// 集合的编码，按从紧凑到宽松的顺序排列
+const (
+	EncodingIntSet    = iota // 整数集合，所有成员都是整数
+	EncodingListpack         // listpack，成员较少且较短
+	EncodingHashTable        // 哈希表
+)
+
 const (
-	// intset 的最大元素数量,超过这个的时候就会转换为哈希表
-	SET_MAX_INTSET_ENTRIES = 512
+	// 整数集合的默认最大元素数量，超过这个的时候就会转换为哈希表
+	DefaultMaxIntsetEntries = 512
+	// listpack 的默认最大元素数量和成员的最大长度，超过任一限制的时候就会转换为哈希表
+	DefaultMaxListpackEntries = 128
+	DefaultMaxListpackValue   = 64
 )
+
+// Limits 是集合各编码的阈值，为0的字段使用默认值
+type Limits struct {
+	MaxIntsetEntries   int
+	MaxListpackEntries int
+	MaxListpackValue   int
+}
+
+// withDefaults 将为0的字段替换为默认值
+func (l Limits) withDefaults() Limits {
+	if l.MaxIntsetEntries <= 0 {
+		l.MaxIntsetEntries = DefaultMaxIntsetEntries
+	}
+	if l.MaxListpackEntries <= 0 {
+		l.MaxListpackEntries = DefaultMaxListpackEntries
+	}
+	if l.MaxListpackValue <= 0 {
+		l.MaxListpackValue = DefaultMaxListpackValue
+	}
+	return l
+}
+
+// encodingFor 返回能容纳所有成员的最紧凑的编码
+func (l Limits) encodingFor(members []string) int {
+	allInts, fitsListpack := true, len(members) <= l.MaxListpackEntries
+	for _, member := range members {
+		if allInts {
+			_, allInts = parseIntMember(member)
+		}
+		if len(member) > l.MaxListpackValue {
+			fitsListpack = false
+		}
+		if !allInts && !fitsListpack {
+			break
+		}
+	}
+	switch {
+	case allInts && len(members) <= l.MaxIntsetEntries:
+		return EncodingIntSet
+	case fitsListpack:
+		return EncodingListpack
+	}
+	return EncodingHashTable
+}
+
+// Intersect 返回多个集合的交集，limit 大于 0 时找到 limit 个成员后停止。
+// 集合按大小排序后只遍历最小的集合，检查它的成员是否在其他所有集合中
+func Intersect(limit int, sets ...Set) []string {
+	result := make([]string, 0)
+	if len(sets) == 0 {
+		return result
+	}
+	sorted := slices.Clone(sets)
+	slices.SortFunc(sorted, func(a, b Set) int {
+		return a.Len() - b.Len()
+	})
+	smallest, others := sorted[0], sorted[1:]
+	if hs, ok := smallest.(*HashSet); ok && hs.encoding == EncodingIntSet {
+		// 最小的集合是整数集合时直接比较整数，不需要反复格式化和解析成员
+		hs.intset.ForEach(func(value int64) bool {
+			for _, other := range others {
+				if !containsInt(other, value) {
+					return true
+				}
+			}
+			result = append(result, strconv.FormatInt(value, 10))
+			return limit <= 0 || len(result) < limit
+		})
+		return result
+	}
+	smallest.ForEach(func(member string) bool {
+		for _, other := range others {
+			if !other.Contains(member) {
+				return true
+			}
+		}
+		result = append(result, member)
+		return limit <= 0 || len(result) < limit
+	})
+	return result
+}
+
+// containsInt 判断整数是否在集合中，整数集合编码时直接查找整数
+func containsInt(s Set, value int64) bool {
+	if hs, ok := s.(*HashSet); ok && hs.encoding == EncodingIntSet {
+		return hs.intset.Contains(value)
+	}
+	return s.Contains(strconv.FormatInt(value, 10))
+}
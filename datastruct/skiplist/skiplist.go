@@ -10,9 +10,10 @@ const maxLevel = 16
 
 // 跳跃表的节点
 type Node struct {
-	Member  string  //存储该节点关联的成员信息
-	Score   float64 //表示该节点的分数
-	Forward []*Node // 指向下一层的节点
+	Member   string  //存储该节点关联的成员信息
+	Score    float64 //表示该节点的分数
+	Forward  []*Node // 指向下一层的节点
+	Backward *Node   // 指向最底层的前一个节点，第一个节点为 nil
 }
 
 // 跳跃表的结构体
@@ -92,9 +93,15 @@ func (sl *SkipList) Insert(member string, score float64) {
 		update[i].Forward[i] = newNode            // 前驱节点的 Forward 指向新节点
 	}
 
+	// 更新后退指针，头节点不作为前一个节点
+	if update[0] != sl.header {
+		newNode.Backward = update[0]
+	}
 	// 更新尾节点指针 (如果新节点是最后一个节点)
 	if newNode.Forward[0] == nil {
 		sl.tail = newNode
+	} else {
+		newNode.Forward[0].Backward = newNode
 	}
 
 	// 更新跳跃表的长度
@@ -132,15 +139,11 @@ func (sl *SkipList) Delete(member string, score float64) bool {
 			update[i].Forward[i] = targetNode.Forward[i]
 		}
 
-		// 如果目标节点是尾节点，更新尾节点指针
+		// 如果目标节点是尾节点，新的尾节点是它的前一个节点，否则更新下一个节点的后退指针
 		if targetNode == sl.tail {
-			// 新的尾节点是 update[0] (最底层的前驱)
-			// 如果 update[0] 是 header，说明列表空了，tail 应为 nil
-			if update[0] == sl.header {
-				sl.tail = nil
-			} else {
-				sl.tail = update[0]
-			}
+			sl.tail = targetNode.Backward
+		} else {
+			targetNode.Forward[0].Backward = targetNode.Backward
 		}
 
 		// 如果目标节点是最高层的节点，更新跳跃表的层数
@@ -178,6 +181,47 @@ func (sl *SkipList) CountInRange(min, max float64) int {
 	return count
 }
 
+// ForEach 按分数和成员升序遍历节点，先跳过开头 before 返回 true 的节点，直到 consumer 返回 false。
+// before 对前面的一段节点返回 true、对之后的节点返回 false，这样可以沿高层的指针快速跳过，为 nil 时从第一个节点开始
+func (sl *SkipList) ForEach(before func(member string, score float64) bool, consumer func(member string, score float64) bool) {
+	x := sl.header
+	if before != nil {
+		for i := sl.level - 1; i >= 0; i-- {
+			for x.Forward[i] != nil && before(x.Forward[i].Member, x.Forward[i].Score) {
+				x = x.Forward[i]
+			}
+		}
+	}
+	for x = x.Forward[0]; x != nil; x = x.Forward[0] {
+		if !consumer(x.Member, x.Score) {
+			return
+		}
+	}
+}
+
+// ForEachReverse 按分数和成员降序遍历节点，先跳过末尾 after 返回 true 的节点，直到 consumer 返回 false。
+// after 对后面的一段节点返回 true、对之前的节点返回 false，为 nil 时从最后一个节点开始
+func (sl *SkipList) ForEachReverse(after func(member string, score float64) bool, consumer func(member string, score float64) bool) {
+	x := sl.tail
+	if after != nil {
+		// 找到最后一个 after 返回 false 的节点
+		x = sl.header
+		for i := sl.level - 1; i >= 0; i-- {
+			for x.Forward[i] != nil && !after(x.Forward[i].Member, x.Forward[i].Score) {
+				x = x.Forward[i]
+			}
+		}
+		if x == sl.header {
+			return
+		}
+	}
+	for ; x != nil; x = x.Backward {
+		if !consumer(x.Member, x.Score) {
+			return
+		}
+	}
+}
+
 // RangeByScore 返回在指定分数范围内的节点
 func (sl *SkipList) RangeByScore(min, max float64, offset, count int) []string {
 	result := []string{}
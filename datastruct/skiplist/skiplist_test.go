@@ -0,0 +1,69 @@
+package skiplist
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+)
+
+// collect 返回 ForEachReverse 访问到的成员
+func collect(sl *SkipList, after func(member string, score float64) bool, limit int) []string {
+	result := []string{}
+	sl.ForEachReverse(after, func(member string, score float64) bool {
+		result = append(result, member)
+		return len(result) < limit
+	})
+	return result
+}
+
+func TestForEachReverse(t *testing.T) {
+	sl := NewSkipList()
+	for i := 0; i < 10; i++ {
+		sl.Insert("m"+strconv.Itoa(i), float64(i))
+	}
+	// 删除头、尾和中间的节点，检查 Backward 指针和 tail 是否随之更新
+	sl.Delete("m0", 0)
+	sl.Delete("m9", 9)
+	sl.Delete("m5", 5)
+
+	tests := []struct {
+		name  string
+		after func(member string, score float64) bool
+		limit int
+		want  []string
+	}{
+		{name: "all", limit: 100, want: []string{"m8", "m7", "m6", "m4", "m3", "m2", "m1"}},
+		{name: "limit", limit: 2, want: []string{"m8", "m7"}},
+		{
+			name:  "after 5",
+			after: func(member string, score float64) bool { return score > 5 },
+			limit: 100,
+			want:  []string{"m4", "m3", "m2", "m1"},
+		},
+		{
+			name:  "after 4",
+			after: func(member string, score float64) bool { return score > 4 },
+			limit: 2,
+			want:  []string{"m4", "m3"},
+		},
+		{
+			name:  "after everything",
+			after: func(member string, score float64) bool { return true },
+			limit: 100,
+			want:  []string{},
+		},
+	}
+	for _, tt := range tests {
+		if got := collect(sl, tt.after, tt.limit); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	for _, member := range []string{"m1", "m2", "m3", "m4", "m6", "m7", "m8"} {
+		score, _ := strconv.ParseFloat(member[1:], 64)
+		sl.Delete(member, score)
+	}
+	if got := collect(sl, nil, 100); len(got) != 0 {
+		t.Errorf("empty list: got %v", got)
+	}
+}
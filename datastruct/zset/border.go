@@ -0,0 +1,94 @@
+package zset
+
+import (
+	"errors"
+	"math"
+	"strconv"
+)
+
+// 解析范围边界失败时返回的错误，与 Redis 的错误信息相同
+var (
+	ErrInvalidScoreBorder = errors.New("min or max is not a float")
+	ErrInvalidLexBorder   = errors.New("min or max not valid string range item")
+)
+
+// Element 是有序集合中的一个成员和它的分数
+type Element struct {
+	Member string
+	Score  float64
+}
+
+// ScoreBorder 是分数范围的一个边界，Exclude 为 true 时不包含边界本身
+type ScoreBorder struct {
+	Value   float64
+	Exclude bool
+}
+
+// ParseScoreBorder 解析分数边界，例如 "10"、"(10"、"-inf" 和 "+inf"
+func ParseScoreBorder(s string) (ScoreBorder, error) {
+	border := ScoreBorder{}
+	if len(s) > 0 && s[0] == '(' {
+		border.Exclude = true
+		s = s[1:]
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(value) {
+		return border, ErrInvalidScoreBorder
+	}
+	border.Value = value
+	return border, nil
+}
+
+// belowMin 判断分数是否小于作为下界的边界
+func (b ScoreBorder) belowMin(score float64) bool {
+	return score < b.Value || (b.Exclude && score == b.Value)
+}
+
+// aboveMax 判断分数是否大于作为上界的边界
+func (b ScoreBorder) aboveMax(score float64) bool {
+	return score > b.Value || (b.Exclude && score == b.Value)
+}
+
+// LexBorder 是成员字典序范围的一个边界，Inf 为 -1 和 1 时分别表示 "-" 和 "+"，即负无穷和正无穷
+type LexBorder struct {
+	Value   string
+	Inf     int
+	Exclude bool
+}
+
+// ParseLexBorder 解析字典序边界，"[a" 包含 a，"(a" 不包含 a，"-" 和 "+" 表示无穷
+func ParseLexBorder(s string) (LexBorder, error) {
+	switch {
+	case s == "-":
+		return LexBorder{Inf: -1}, nil
+	case s == "+":
+		return LexBorder{Inf: 1}, nil
+	case len(s) > 0 && s[0] == '(':
+		return LexBorder{Value: s[1:], Exclude: true}, nil
+	case len(s) > 0 && s[0] == '[':
+		return LexBorder{Value: s[1:]}, nil
+	}
+	return LexBorder{}, ErrInvalidLexBorder
+}
+
+// belowMin 判断成员是否小于作为下界的边界
+func (b LexBorder) belowMin(member string) bool {
+	switch b.Inf {
+	case -1:
+		return false
+	case 1:
+		return true
+	}
+	return member < b.Value || (b.Exclude && member == b.Value)
+}
+
+// aboveMax 判断成员是否大于作为上界的边界
+func (b LexBorder) aboveMax(member string) bool {
+	switch b.Inf {
+	case -1:
+		return true
+	case 1:
+		return false
+	}
+	return member > b.Value || (b.Exclude && member == b.Value)
+}
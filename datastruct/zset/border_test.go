@@ -0,0 +1,128 @@
+package zset
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseScoreBorder(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    ScoreBorder
+		wantErr bool
+	}{
+		{input: "10", want: ScoreBorder{Value: 10}},
+		{input: "(10", want: ScoreBorder{Value: 10, Exclude: true}},
+		{input: "-1.5", want: ScoreBorder{Value: -1.5}},
+		{input: "-inf", want: ScoreBorder{Value: math.Inf(-1)}},
+		{input: "+inf", want: ScoreBorder{Value: math.Inf(1)}},
+		{input: "(+inf", want: ScoreBorder{Value: math.Inf(1), Exclude: true}},
+		{input: "", wantErr: true},
+		{input: "(", wantErr: true},
+		{input: "abc", wantErr: true},
+		{input: "nan", wantErr: true},
+		{input: "[10", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseScoreBorder(tt.input)
+		if tt.wantErr {
+			if err != ErrInvalidScoreBorder {
+				t.Errorf("ParseScoreBorder(%q) error = %v, want %v", tt.input, err, ErrInvalidScoreBorder)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseScoreBorder(%q) = %v, %v, want %v", tt.input, got, err, tt.want)
+		}
+	}
+}
+
+func TestScoreBorderCompare(t *testing.T) {
+	tests := []struct {
+		border   string
+		score    float64
+		belowMin bool
+		aboveMax bool
+	}{
+		{border: "5", score: 4, belowMin: true},
+		{border: "5", score: 5},
+		{border: "5", score: 6, aboveMax: true},
+		{border: "(5", score: 5, belowMin: true, aboveMax: true},
+		{border: "-inf", score: math.Inf(-1)},
+		{border: "-inf", score: -1e300, aboveMax: true},
+		{border: "+inf", score: 1e300, belowMin: true},
+		{border: "(+inf", score: math.Inf(1), belowMin: true, aboveMax: true},
+	}
+	for _, tt := range tests {
+		b, err := ParseScoreBorder(tt.border)
+		if err != nil {
+			t.Fatalf("ParseScoreBorder(%q): %v", tt.border, err)
+		}
+		if got := b.belowMin(tt.score); got != tt.belowMin {
+			t.Errorf("%q.belowMin(%v) = %v, want %v", tt.border, tt.score, got, tt.belowMin)
+		}
+		if got := b.aboveMax(tt.score); got != tt.aboveMax {
+			t.Errorf("%q.aboveMax(%v) = %v, want %v", tt.border, tt.score, got, tt.aboveMax)
+		}
+	}
+}
+
+func TestParseLexBorder(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    LexBorder
+		wantErr bool
+	}{
+		{input: "-", want: LexBorder{Inf: -1}},
+		{input: "+", want: LexBorder{Inf: 1}},
+		{input: "[a", want: LexBorder{Value: "a"}},
+		{input: "(a", want: LexBorder{Value: "a", Exclude: true}},
+		{input: "[", want: LexBorder{Value: ""}},
+		{input: "[-", want: LexBorder{Value: "-"}},
+		{input: "a", wantErr: true},
+		{input: "", wantErr: true},
+		{input: "--", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLexBorder(tt.input)
+		if tt.wantErr {
+			if err != ErrInvalidLexBorder {
+				t.Errorf("ParseLexBorder(%q) error = %v, want %v", tt.input, err, ErrInvalidLexBorder)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseLexBorder(%q) = %v, %v, want %v", tt.input, got, err, tt.want)
+		}
+	}
+}
+
+func TestLexBorderCompare(t *testing.T) {
+	tests := []struct {
+		border   string
+		member   string
+		belowMin bool
+		aboveMax bool
+	}{
+		{border: "[b", member: "a", belowMin: true},
+		{border: "[b", member: "b"},
+		{border: "[b", member: "c", aboveMax: true},
+		{border: "(b", member: "b", belowMin: true, aboveMax: true},
+		{border: "[b", member: "ba", aboveMax: true},
+		{border: "-", member: "", aboveMax: true},
+		{border: "-", member: "z", aboveMax: true},
+		{border: "+", member: "z", belowMin: true},
+	}
+	for _, tt := range tests {
+		b, err := ParseLexBorder(tt.border)
+		if err != nil {
+			t.Fatalf("ParseLexBorder(%q): %v", tt.border, err)
+		}
+		if got := b.belowMin(tt.member); got != tt.belowMin {
+			t.Errorf("%q.belowMin(%q) = %v, want %v", tt.border, tt.member, got, tt.belowMin)
+		}
+		if got := b.aboveMax(tt.member); got != tt.aboveMax {
+			t.Errorf("%q.aboveMax(%q) = %v, want %v", tt.border, tt.member, got, tt.aboveMax)
+		}
+	}
+}
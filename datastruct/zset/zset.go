@@ -1,9 +1,10 @@
 package zset
 
 import (
-	"fmt"
+	"goredis/datastruct/listpack"
 	"goredis/datastruct/skiplist"
-	"sort"
+	"goredis/lib/cursor"
+	"math"
 	"strconv"
 )
 
@@ -14,9 +15,17 @@ type ZSet interface {
 	Len() int                              // 获取有序集合的长度
 	RangeByRank(start, stop int) []string  // 获取指定排名范围内的成员
 	Remove(member string) bool
-	Count(min, max float64) int      // 获取指定分数范围内的成员数量
-	Encoding() int                   // 获取当前编码类型
-	GetSkiplist() *skiplist.SkipList // 获取跳跃表实例
+	Count(min, max ScoreBorder) int             // 获取指定分数范围内的成员数量
+	LexCount(min, max LexBorder) int            // 获取指定字典序范围内的成员数量
+	Range(start, stop int, desc bool) []Element // 获取指定排名范围内的成员和分数，desc 为 true 时按从大到小排名
+	// 获取指定分数范围内的成员和分数，跳过前 offset 个后最多返回 count 个，count 为负数时返回所有
+	RangeByScore(min, max ScoreBorder, offset, count int, desc bool) []Element
+	// 获取指定字典序范围内的成员和分数，只在所有成员分数相同时有意义
+	RangeByLex(min, max LexBorder, offset, count int, desc bool) []Element
+	Encoding() int                                 // 获取当前编码类型
+	GetSkiplist() *skiplist.SkipList               // 获取跳跃表实例
+	Scan(cur uint64, count int) ([]string, uint64) // 按游标遍历成员，返回本次的成员和下一次的游标
+	ObjectEncoding() string                        // 返回 OBJECT ENCODING 命令显示的编码名称
 
 }
 
@@ -25,38 +34,84 @@ const (
 	encodingSkiplist
 )
 
-// 用于限制 Listpack 的最大长度，超过长度后，使用 Skiplist 来存储
-const listpackMaxSize = 128
+// DefaultMaxListpackEntries 是 listpack 编码默认的最大成员数量，超过后使用 Skiplist 来存储，
+// 对应 zset-max-listpack-entries 配置
+const DefaultMaxListpackEntries = 128
 
+// listpack 编码时成员和分数依次存放在 listpack 中，并按分数和成员排序，与跳跃表的顺序相同
 type zset struct {
-	encoding int
-	listpack [][2]string
-	dict     map[string]float64
-	skiplist *skiplist.SkipList
+	encoding           int
+	listpack           *listpack.ListPack
+	dict               map[string]float64
+	skiplist           *skiplist.SkipList
+	index              *cursor.Index // 跳跃表编码时按哈希值分桶保存成员，供 ZSCAN 按游标遍历
+	maxListpackEntries int           // listpack 编码的最大成员数量
 }
 
-// 创建一个新的 ZSet
-func NewZSet() ZSet {
+// 创建一个新的 ZSet，成员数量超过 maxListpackEntries 时转换为跳跃表，
+// maxListpackEntries 为 0 时使用 DefaultMaxListpackEntries
+func NewZSet(maxListpackEntries int) ZSet {
+	if maxListpackEntries <= 0 {
+		maxListpackEntries = DefaultMaxListpackEntries
+	}
 	return &zset{
-		encoding: encodingListpack,
-		listpack: make([][2]string, 0),
+		encoding:           encodingListpack,
+		listpack:           listpack.New(),
+		maxListpackEntries: maxListpackEntries,
 	}
 }
 
+// listpackForEach 按顺序遍历 listpack 中的成员和分数，pos 为成员条目的位置，直到 consumer 返回 false
+func (z *zset) listpackForEach(consumer func(pos int, member string, score float64) bool) {
+	var member string
+	var memberPos int
+	i := 0
+	z.listpack.ForEach(func(pos int, val string) bool {
+		i++
+		if i%2 == 1 {
+			member, memberPos = val, pos
+			return true
+		}
+		score, _ := parseScore(val)
+		return consumer(memberPos, member, score)
+	})
+}
+
+// listpackScore 返回 listpack 中位置为 pos 的成员的分数
+func (z *zset) listpackScore(pos int) float64 {
+	value, _ := z.listpack.Next(z.listpack.Skip(pos, 1))
+	score, _ := parseScore(value)
+	return score
+}
+
+// listpackInsert 将成员插入到 listpack 中按分数和成员排序的位置
+func (z *zset) listpackInsert(member string, score float64) {
+	insertAt := z.listpack.End()
+	z.listpackForEach(func(pos int, m string, s float64) bool {
+		if s > score || (s == score && m > member) {
+			insertAt = pos
+			return false
+		}
+		return true
+	})
+	z.listpack.Insert(insertAt, member, formatScore(score))
+}
+
 func (z *zset) Add(member string, score float64) bool {
 	if z.encoding == encodingListpack {
 		// 检查成员是否已经存在于 listpack 中
-		for i, pair := range z.listpack {
-			if pair[0] == member {
-				// 如果成员已经存在，更新分数
-				z.listpack[i][1] = formatScore(score)
-				return false
+		if pos := z.listpack.Find(member, 1); pos >= 0 {
+			// 如果成员已经存在，删除后按新的分数重新插入以保持顺序
+			if z.listpackScore(pos) != score {
+				z.listpack.Delete(pos, 2)
+				z.listpackInsert(member, score)
 			}
+			return false
 		}
 		// 添加成员和分数到 listpack 中
-		z.listpack = append(z.listpack, [2]string{member, formatScore(score)})
+		z.listpackInsert(member, score)
 		// 检查 listpack 的大小是否超过限制
-		if len(z.listpack) > listpackMaxSize {
+		if z.listpack.Len()/2 > z.maxListpackEntries {
 			z.convertToSkiplist()
 		}
 		return true
@@ -72,13 +127,17 @@ func (z *zset) Add(member string, score float64) bool {
 		}
 		z.dict[member] = score
 		z.skiplist.Insert(member, score)
+		z.index.Add(member)
 		return true
 	}
 }
 
-// 将分数转换为字符串格式
+// 将分数转换为能无损还原的最短字符串，整数分数在 listpack 中按整数编码
 func formatScore(score float64) string {
-	return fmt.Sprintf("%f", score)
+	if score == math.Trunc(score) && math.Abs(score) < 1<<53 && !(score == 0 && math.Signbit(score)) {
+		return strconv.FormatInt(int64(score), 10)
+	}
+	return strconv.FormatFloat(score, 'g', -1, 64)
 }
 
 // 将 listpack 转换为 skiplist
@@ -91,15 +150,16 @@ func (z *zset) convertToSkiplist() {
 	// 创建一个新的跳跃表实例，用于存储有序集合的成员和分数
 	z.skiplist = skiplist.NewSkipList()
 	// 创建一个新的字典，用于存储成员和分数的映射关系
-	z.dict = make(map[string]float64, len(z.listpack))
+	z.dict = make(map[string]float64, z.listpack.Len()/2)
+	z.index = cursor.NewIndex(z.listpack.Len() / 2)
 
 	// 将 listpack 中的所有元素转移到跳跃表和字典中
-	for _, pair := range z.listpack {
-		member := pair[0]
-		score, _ := parseScore(pair[1])
+	z.listpackForEach(func(pos int, member string, score float64) bool {
 		z.dict[member] = score
 		z.skiplist.Insert(member, score)
-	}
+		z.index.Add(member)
+		return true
+	})
 
 	// 更新编码类型为 skiplist
 	z.encoding = encodingSkiplist
@@ -115,17 +175,12 @@ func parseScore(scoreStr string) (float64, error) {
 
 func (z *zset) Score(member string) (float64, bool) {
 	if z.encoding == encodingListpack {
-		// 遍历 listpack 查找成员
-		for _, pair := range z.listpack {
-			if pair[0] == member {
-				score, err := parseScore(pair[1])
-				if err != nil {
-					return 0, false
-				}
-				return score, true
-			}
+		// 在 listpack 中查找成员
+		pos := z.listpack.Find(member, 1)
+		if pos < 0 {
+			return 0, false // 成员不存在
 		}
-		return 0, false // 成员不存在
+		return z.listpackScore(pos), true
 	} else {
 		score, exists := z.dict[member]
 		return score, exists
@@ -135,7 +190,7 @@ func (z *zset) Score(member string) (float64, bool) {
 // 获取有序集合的长度
 func (z *zset) Len() int {
 	if z.encoding == encodingListpack { // 如果当前编码是 Listpack
-		return len(z.listpack)
+		return z.listpack.Len() / 2
 	} else { // 如果当前编码是dict
 		return len(z.dict)
 	}
@@ -144,18 +199,8 @@ func (z *zset) Len() int {
 // 获取指定排名范围内的成员
 func (z *zset) RangeByRank(start, stop int) []string {
 	if z.encoding == encodingListpack {
-		// 创建一个新的切片用于存储成员和分数
-		pairs := make([][2]string, len(z.listpack))
-		copy(pairs, z.listpack) // 复制 listpack 的内容到新的切片中
-
-		// 对切片进行排序，按照分数升序排列
-		sort.Slice(pairs, func(i, j int) bool {
-			score1, _ := parseScore(pairs[i][1])
-			score2, _ := parseScore(pairs[j][1])
-			return score1 < score2
-		})
-
-		size := len(pairs)
+		// listpack 中的成员已经按分数升序排列
+		size := z.Len()
 		if start < 0 {
 			start = size + start
 		}
@@ -174,9 +219,14 @@ func (z *zset) RangeByRank(start, stop int) []string {
 
 		// 创建一个切片用于存储结果
 		result := make([]string, 0, stop-start+1)
-		for i := start; i <= stop; i++ {
-			result = append(result, pairs[i][0]) // 添加成员到结果切片中
-		}
+		rank := 0
+		z.listpackForEach(func(pos int, member string, score float64) bool {
+			if rank >= start {
+				result = append(result, member) // 添加成员到结果切片中
+			}
+			rank++
+			return rank <= stop
+		})
 		return result // 返回结果切片
 	}
 	return z.skiplist.RangeByRank(start, stop) // 如果当前编码是 Skiplist，直接调用跳跃表的 RangeByRank 方法
@@ -185,13 +235,10 @@ func (z *zset) RangeByRank(start, stop int) []string {
 // 移除指定成员
 func (z *zset) Remove(member string) bool {
 	if z.encoding == encodingListpack {
-		for i, pair := range z.listpack {
-			if pair[0] == member {
-				// 删除成员
-				// 使用 append 方法将 listpack 切片的前后部分连接起来，跳过要删除的元素
-				z.listpack = append(z.listpack[:i], z.listpack[i+1:]...)
-				return true
-			}
+		if pos := z.listpack.Find(member, 1); pos >= 0 {
+			// 删除成员和分数两个条目
+			z.listpack.Delete(pos, 2)
+			return true
 		}
 		return false
 	} else {
@@ -199,27 +246,165 @@ func (z *zset) Remove(member string) bool {
 		if exists {
 			z.skiplist.Delete(member, score)
 			delete(z.dict, member)
+			z.index.Remove(member)
 			return true
 		}
 		return false
 	}
 }
 
-// 获取指定分数范围内的成员数量
-func (z *zset) Count(min, max float64) int {
-	if z.encoding == encodingListpack {
-		count := 0
-		for _, pair := range z.listpack {
-			score, _ := parseScore(pair[1])
-			if score >= min && score <= max {
-				count++
-			}
+// forEachFrom 按分数和成员升序遍历，先跳过开头 before 返回 true 的成员，直到 consumer 返回 false，
+// before 为 nil 时从第一个成员开始
+func (z *zset) forEachFrom(before func(member string, score float64) bool, consumer func(member string, score float64) bool) {
+	if z.encoding == encodingSkiplist {
+		z.skiplist.ForEach(before, consumer)
+		return
+	}
+	skipping := before != nil
+	z.listpackForEach(func(pos int, member string, score float64) bool {
+		if skipping && before(member, score) {
+			return true
+		}
+		skipping = false
+		return consumer(member, score)
+	})
+}
+
+// forEachBackFrom 按分数和成员降序遍历，先跳过末尾 after 返回 true 的成员，直到 consumer 返回 false，
+// after 为 nil 时从最后一个成员开始
+func (z *zset) forEachBackFrom(after func(member string, score float64) bool, consumer func(member string, score float64) bool) {
+	if z.encoding == encodingSkiplist {
+		z.skiplist.ForEachReverse(after, consumer)
+		return
+	}
+	skipping := after != nil
+	for pos := z.listpack.Last(); pos >= 0; {
+		// 从末尾开始，先是分数，再是成员
+		value, _ := z.listpack.Next(pos)
+		pos = z.listpack.Prev(pos)
+		member, _ := z.listpack.Next(pos)
+		pos = z.listpack.Prev(pos)
+		score, _ := parseScore(value)
+		if skipping && after(member, score) {
+			continue
+		}
+		skipping = false
+		if !consumer(member, score) {
+			return
+		}
+	}
+}
+
+// countRange 统计 before 返回 false 之后、after 返回 true 之前的成员数量
+func (z *zset) countRange(before, after func(member string, score float64) bool) int {
+	count := 0
+	z.forEachFrom(before, func(member string, score float64) bool {
+		if after(member, score) {
+			return false // 之后的成员都超出了范围
 		}
-		return count
+		count++
+		return true
+	})
+	return count
+}
+
+// rangeElements 返回 before 返回 false 之后、after 返回 true 之前的成员，
+// desc 为 true 时从大到小排列，跳过前 offset 个后最多返回 count 个，只访问返回的和跳过的成员
+func (z *zset) rangeElements(before, after func(member string, score float64) bool, offset, count int, desc bool) []Element {
+	result := make([]Element, 0)
+	if offset < 0 || count == 0 {
+		return result
+	}
+	// 逆序时从范围的末尾开始遍历，遇到 before 返回 true 的成员时结束
+	walk, end := z.forEachFrom, after
+	if desc {
+		walk, end = z.forEachBackFrom, before
+		before = after
 	}
+	walk(before, func(member string, score float64) bool {
+		if end(member, score) {
+			return false
+		}
+		if offset > 0 {
+			offset--
+			return true
+		}
+		result = append(result, Element{Member: member, Score: score})
+		return count < 0 || len(result) < count
+	})
+	return result
+}
+
+// 获取指定分数范围内的成员数量
+func (z *zset) Count(min, max ScoreBorder) int {
+	return z.countRange(func(member string, score float64) bool {
+		return min.belowMin(score)
+	}, func(member string, score float64) bool {
+		return max.aboveMax(score)
+	})
+}
 
-	// Using skiplist encoding
-	return z.skiplist.CountInRange(min, max)
+// LexCount 获取指定字典序范围内的成员数量
+func (z *zset) LexCount(min, max LexBorder) int {
+	return z.countRange(func(member string, score float64) bool {
+		return min.belowMin(member)
+	}, func(member string, score float64) bool {
+		return max.aboveMax(member)
+	})
+}
+
+// Range 获取指定排名范围内的成员和分数，desc 为 true 时排名 0 是分数最大的成员
+func (z *zset) Range(start, stop int, desc bool) []Element {
+	size := z.Len()
+	if start < 0 {
+		start = size + start
+	}
+	if stop < 0 {
+		stop = size + stop
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= size {
+		stop = size - 1
+	}
+	if start > stop || start >= size {
+		return []Element{}
+	}
+
+	// 逆序时从最后一个成员开始计算排名
+	walk := z.forEachFrom
+	if desc {
+		walk = z.forEachBackFrom
+	}
+	result := make([]Element, 0, stop-start+1)
+	rank := 0
+	walk(nil, func(member string, score float64) bool {
+		if rank >= start {
+			result = append(result, Element{Member: member, Score: score})
+		}
+		rank++
+		return rank <= stop
+	})
+	return result
+}
+
+// RangeByScore 获取指定分数范围内的成员和分数
+func (z *zset) RangeByScore(min, max ScoreBorder, offset, count int, desc bool) []Element {
+	return z.rangeElements(func(member string, score float64) bool {
+		return min.belowMin(score)
+	}, func(member string, score float64) bool {
+		return max.aboveMax(score)
+	}, offset, count, desc)
+}
+
+// RangeByLex 获取指定字典序范围内的成员和分数
+func (z *zset) RangeByLex(min, max LexBorder, offset, count int, desc bool) []Element {
+	return z.rangeElements(func(member string, score float64) bool {
+		return min.belowMin(member)
+	}, func(member string, score float64) bool {
+		return max.aboveMax(member)
+	}, offset, count, desc)
 }
 
 // 获取当前编码类型
@@ -227,6 +412,14 @@ func (z *zset) Encoding() int {
 	return z.encoding
 }
 
+// ObjectEncoding 返回 OBJECT ENCODING 命令显示的编码名称
+func (z *zset) ObjectEncoding() string {
+	if z.encoding == encodingListpack {
+		return "listpack"
+	}
+	return "skiplist"
+}
+
 // GetSkiplist 返回跳跃表实例
 func (z *zset) GetSkiplist() *skiplist.SkipList {
 	if z.encoding == encodingSkiplist {
@@ -234,3 +427,17 @@ func (z *zset) GetSkiplist() *skiplist.SkipList {
 	}
 	return nil
 }
+
+// Scan 按游标遍历有序集合的成员，返回本次遍历的成员和下一次的游标，游标为0表示遍历结束
+// listpack 编码的有序集合很小，一次返回所有成员，跳跃表编码时只访问游标之后约 count 个成员
+func (z *zset) Scan(cur uint64, count int) ([]string, uint64) {
+	if z.encoding == encodingListpack {
+		members := make([]string, 0, z.Len())
+		z.listpackForEach(func(pos int, member string, score float64) bool {
+			members = append(members, member)
+			return true
+		})
+		return members, 0
+	}
+	return z.index.Scan(cur, count)
+}
@@ -0,0 +1,119 @@
+package zset
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+)
+
+// makeZSets 创建内容相同的 listpack 编码和跳跃表编码的有序集合，成员 m0..m9 的分数为 0..9，另有分数同为 3 的 m3a
+func makeZSets() map[string]ZSet {
+	sets := map[string]ZSet{
+		"listpack": NewZSet(0),
+		"skiplist": NewZSet(1),
+	}
+	for _, z := range sets {
+		for i := 0; i < 10; i++ {
+			z.Add("m"+strconv.Itoa(i), float64(i))
+		}
+		z.Add("m3a", 3)
+	}
+	return sets
+}
+
+func members(elements []Element) []string {
+	result := make([]string, 0, len(elements))
+	for _, e := range elements {
+		result = append(result, e.Member)
+	}
+	return result
+}
+
+func TestRangeByScore(t *testing.T) {
+	tests := []struct {
+		min, max      string
+		offset, count int
+		desc          bool
+		want          []string
+	}{
+		{min: "-inf", max: "+inf", count: -1, want: []string{"m0", "m1", "m2", "m3", "m3a", "m4", "m5", "m6", "m7", "m8", "m9"}},
+		{min: "2", max: "4", count: -1, want: []string{"m2", "m3", "m3a", "m4"}},
+		{min: "(2", max: "(4", count: -1, want: []string{"m3", "m3a"}},
+		{min: "2", max: "4", count: -1, desc: true, want: []string{"m4", "m3a", "m3", "m2"}},
+		{min: "(2", max: "(4", count: -1, desc: true, want: []string{"m3a", "m3"}},
+		{min: "2", max: "6", offset: 1, count: 2, want: []string{"m3", "m3a"}},
+		{min: "2", max: "6", offset: 1, count: 2, desc: true, want: []string{"m5", "m4"}},
+		{min: "-inf", max: "+inf", offset: 9, count: 5, desc: true, want: []string{"m1", "m0"}},
+		{min: "-inf", max: "+inf", offset: 20, count: -1, desc: true, want: []string{}},
+		{min: "5", max: "2", count: -1, desc: true, want: []string{}},
+		{min: "9", max: "+inf", count: 0, want: []string{}},
+	}
+	for name, z := range makeZSets() {
+		for _, tt := range tests {
+			min, _ := ParseScoreBorder(tt.min)
+			max, _ := ParseScoreBorder(tt.max)
+			got := members(z.RangeByScore(min, max, tt.offset, tt.count, tt.desc))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("%s: RangeByScore(%s, %s, %d, %d, %v) = %v, want %v",
+					name, tt.min, tt.max, tt.offset, tt.count, tt.desc, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestRangeByLex(t *testing.T) {
+	sets := map[string]ZSet{
+		"listpack": NewZSet(0),
+		"skiplist": NewZSet(1),
+	}
+	tests := []struct {
+		min, max      string
+		offset, count int
+		desc          bool
+		want          []string
+	}{
+		{min: "-", max: "+", count: -1, want: []string{"a", "b", "c", "d", "e"}},
+		{min: "[b", max: "(d", count: -1, want: []string{"b", "c"}},
+		{min: "[b", max: "(d", count: -1, desc: true, want: []string{"c", "b"}},
+		{min: "-", max: "+", offset: 1, count: 3, desc: true, want: []string{"d", "c", "b"}},
+		{min: "(e", max: "+", count: -1, desc: true, want: []string{}},
+	}
+	for name, z := range sets {
+		for _, member := range []string{"e", "c", "a", "d", "b"} {
+			z.Add(member, 0)
+		}
+		for _, tt := range tests {
+			min, _ := ParseLexBorder(tt.min)
+			max, _ := ParseLexBorder(tt.max)
+			got := members(z.RangeByLex(min, max, tt.offset, tt.count, tt.desc))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("%s: RangeByLex(%s, %s, %d, %d, %v) = %v, want %v",
+					name, tt.min, tt.max, tt.offset, tt.count, tt.desc, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestRange(t *testing.T) {
+	tests := []struct {
+		start, stop int
+		desc        bool
+		want        []string
+	}{
+		{start: 0, stop: 2, want: []string{"m0", "m1", "m2"}},
+		{start: 0, stop: 2, desc: true, want: []string{"m9", "m8", "m7"}},
+		{start: -3, stop: -1, desc: true, want: []string{"m2", "m1", "m0"}},
+		{start: -2, stop: -1, desc: true, want: []string{"m1", "m0"}},
+		{start: 3, stop: 5, desc: true, want: []string{"m6", "m5", "m4"}},
+		{start: 5, stop: 100, desc: true, want: []string{"m4", "m3a", "m3", "m2", "m1", "m0"}},
+		{start: 5, stop: 3, desc: true, want: []string{}},
+	}
+	for name, z := range makeZSets() {
+		for _, tt := range tests {
+			got := members(z.Range(tt.start, tt.stop, tt.desc))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("%s: Range(%d, %d, %v) = %v, want %v", name, tt.start, tt.stop, tt.desc, got, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,317 @@
+// Package dump implements the serialization format of a single value, used by DUMP and RESTORE.
+//
+// A payload is laid out as:
+//
+//	type (1 byte) | body | format version (2 bytes, little endian) | CRC-64/ECMA of all previous bytes (8 bytes, little endian)
+//
+// Lengths in the body are unsigned varints, strings are a length followed by the bytes,
+// scores are IEEE 754 float64 in little endian.
+package dump
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"goredis/config"
+	"goredis/datastruct/hash"
+	"goredis/datastruct/list"
+	"goredis/datastruct/set"
+	"goredis/datastruct/zset"
+	"goredis/interface/database"
+	"hash/crc64"
+	"math"
+	"strconv"
+)
+
+// Version is the format version written by Marshal, payloads of newer versions are rejected
+const Version = 1
+
+// value types of the payload
+const (
+	typeString = iota
+	typeList
+	typeSet
+	typeZSet
+	typeHash
+	typeIntSet      // a set of integers, stored in the intset layout
+	typeHashWithTTL // a hash with fields that expire, every value is followed by its expire time in unix ms as 8 bytes, 0 for none
+)
+
+// footerSize is the size of the version and the checksum
+const footerSize = 2 + 8
+
+var crcTable = crc64.MakeTable(crc64.ECMA)
+
+// ErrBadPayload is returned when a payload is truncated, corrupted or of an unknown version
+var ErrBadPayload = errors.New("DUMP payload version or checksum are wrong")
+
+// Marshal serializes the value of the entity
+func Marshal(entity *database.DataEntity) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	switch val := entity.Data.(type) {
+	case []byte:
+		buf.WriteByte(typeString)
+		writeString(buf, string(val))
+	case int64:
+		buf.WriteByte(typeString)
+		writeString(buf, strconv.FormatInt(val, 10))
+	case *list.QuickList:
+		buf.WriteByte(typeList)
+		writeLength(buf, val.Len())
+		val.ForEach(0, func(i int, element []byte) bool {
+			writeString(buf, string(element))
+			return true
+		})
+	case *hash.Hash:
+		withTTL := val.HasExpires()
+		if withTTL {
+			buf.WriteByte(typeHashWithTTL)
+		} else {
+			buf.WriteByte(typeHash)
+		}
+		fields := val.GetAll()
+		writeLength(buf, len(fields))
+		for field, value := range fields {
+			writeString(buf, field)
+			writeString(buf, value)
+			if withTTL {
+				expireAt, _ := val.ExpireTime(field)
+				var raw [8]byte
+				binary.LittleEndian.PutUint64(raw[:], uint64(expireAt))
+				buf.Write(raw[:])
+			}
+		}
+	case set.Set:
+		if intSet, ok := val.(*set.HashSet); ok {
+			if ints, ok := intSet.Ints(); ok {
+				buf.WriteByte(typeIntSet)
+				writeInts(buf, ints)
+				break
+			}
+		}
+		buf.WriteByte(typeSet)
+		writeLength(buf, val.Len())
+		val.ForEach(func(member string) bool {
+			writeString(buf, member)
+			return true
+		})
+	case zset.ZSet:
+		buf.WriteByte(typeZSet)
+		members := val.RangeByRank(0, -1)
+		writeLength(buf, len(members))
+		for _, member := range members {
+			score, _ := val.Score(member)
+			writeString(buf, member)
+			var raw [8]byte
+			binary.LittleEndian.PutUint64(raw[:], math.Float64bits(score))
+			buf.Write(raw[:])
+		}
+	default:
+		return nil, errors.New("unknown value type")
+	}
+
+	var footer [footerSize]byte
+	binary.LittleEndian.PutUint16(footer[:2], Version)
+	buf.Write(footer[:2])
+	binary.LittleEndian.PutUint64(footer[2:], crc64.Checksum(buf.Bytes(), crcTable))
+	buf.Write(footer[2:])
+	return buf.Bytes(), nil
+}
+
+// Unmarshal checks the version and checksum of the payload and rebuilds the value
+func Unmarshal(payload []byte) (*database.DataEntity, error) {
+	if len(payload) < 1+footerSize {
+		return nil, ErrBadPayload
+	}
+	bodyEnd := len(payload) - footerSize
+	version := binary.LittleEndian.Uint16(payload[bodyEnd:])
+	checksum := binary.LittleEndian.Uint64(payload[bodyEnd+2:])
+	if version > Version || checksum != crc64.Checksum(payload[:bodyEnd+2], crcTable) {
+		return nil, ErrBadPayload
+	}
+
+	r := &reader{buf: payload[1:bodyEnd]}
+	var data interface{}
+	switch payload[0] {
+	case typeString:
+		data = database.MakeStringEntity(r.readBytes()).Data
+	case typeList:
+		lst := list.New(config.Properties.ListMaxListpackSize)
+		for i, n := 0, r.readLength(); i < n && r.err == nil; i++ {
+			lst.PushBack(r.readBytes())
+		}
+		data = lst
+	case typeHash:
+		h := hash.NewHash(config.Properties.HashMaxListpackEntries)
+		for i, n := 0, r.readLength(); i < n && r.err == nil; i++ {
+			field := r.readString()
+			h.Set(field, r.readString())
+		}
+		data = h
+	case typeHashWithTTL:
+		h := hash.NewHash(config.Properties.HashMaxListpackEntries)
+		for i, n := 0, r.readLength(); i < n && r.err == nil; i++ {
+			field := r.readString()
+			h.Set(field, r.readString())
+			if expireAt := r.readInt64(); expireAt > 0 {
+				h.SetExpire(field, expireAt)
+			}
+		}
+		data = h
+	case typeSet:
+		s := set.NewHashSet(setLimits())
+		for i, n := 0, r.readLength(); i < n && r.err == nil; i++ {
+			s.Add(r.readString())
+		}
+		data = s
+	case typeIntSet:
+		s := set.NewHashSet(setLimits())
+		for _, value := range r.readInts() {
+			s.Add(strconv.FormatInt(value, 10))
+		}
+		data = s
+	case typeZSet:
+		z := zset.NewZSet(config.Properties.ZSetMaxListpackEntries)
+		for i, n := 0, r.readLength(); i < n && r.err == nil; i++ {
+			member := r.readString()
+			z.Add(member, r.readScore())
+		}
+		data = z
+	default:
+		return nil, ErrBadPayload
+	}
+	if r.err != nil || len(r.buf) != 0 {
+		return nil, ErrBadPayload
+	}
+	return &database.DataEntity{Data: data}, nil
+}
+
+// setLimits returns the set encoding thresholds of the server
+func setLimits() set.Limits {
+	return set.Limits{
+		MaxIntsetEntries:   config.Properties.SetMaxIntsetEntries,
+		MaxListpackEntries: config.Properties.SetMaxListpackEntries,
+		MaxListpackValue:   config.Properties.SetMaxListpackValue,
+	}
+}
+
+func writeLength(buf *bytes.Buffer, n int) {
+	var raw [binary.MaxVarintLen64]byte
+	buf.Write(raw[:binary.PutUvarint(raw[:], uint64(n))])
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	writeLength(buf, len(s))
+	buf.WriteString(s)
+}
+
+// writeInts writes the integers like an intset: the width of every integer,
+// the count and the integers in little endian with that width
+func writeInts(buf *bytes.Buffer, ints []int64) {
+	width := 2
+	for _, value := range ints {
+		if value < math.MinInt32 || value > math.MaxInt32 {
+			width = 8
+			break
+		}
+		if value < math.MinInt16 || value > math.MaxInt16 {
+			width = 4
+		}
+	}
+	buf.WriteByte(byte(width))
+	writeLength(buf, len(ints))
+	var raw [8]byte
+	for _, value := range ints {
+		binary.LittleEndian.PutUint64(raw[:], uint64(value))
+		buf.Write(raw[:width])
+	}
+}
+
+// reader reads the body of a payload, the first error is kept in err and later reads return zero values
+type reader struct {
+	buf []byte
+	err error
+}
+
+func (r *reader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.buf) {
+		r.err = ErrBadPayload
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *reader) readLength() int {
+	if r.err != nil {
+		return 0
+	}
+	n, size := binary.Uvarint(r.buf)
+	if size <= 0 || n > uint64(len(r.buf)) {
+		// every element takes at least one byte, a longer length is corrupted
+		r.err = ErrBadPayload
+		return 0
+	}
+	r.buf = r.buf[size:]
+	return int(n)
+}
+
+func (r *reader) readBytes() []byte {
+	b := r.next(r.readLength())
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+func (r *reader) readString() string {
+	return string(r.next(r.readLength()))
+}
+
+func (r *reader) readScore() float64 {
+	b := r.next(8)
+	if b == nil {
+		return 0
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(b))
+}
+
+func (r *reader) readInt64() int64 {
+	b := r.next(8)
+	if b == nil {
+		return 0
+	}
+	return int64(binary.LittleEndian.Uint64(b))
+}
+
+func (r *reader) readInts() []int64 {
+	width := r.next(1)
+	if width == nil {
+		return nil
+	}
+	if width[0] != 2 && width[0] != 4 && width[0] != 8 {
+		r.err = ErrBadPayload
+		return nil
+	}
+	n := r.readLength()
+	ints := make([]int64, 0, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		b := r.next(int(width[0]))
+		if b == nil {
+			return nil
+		}
+		switch width[0] {
+		case 2:
+			ints = append(ints, int64(int16(binary.LittleEndian.Uint16(b))))
+		case 4:
+			ints = append(ints, int64(int32(binary.LittleEndian.Uint32(b))))
+		case 8:
+			ints = append(ints, int64(binary.LittleEndian.Uint64(b)))
+		}
+	}
+	return ints
+}
@@ -0,0 +1,152 @@
+package dump
+
+import (
+	"goredis/datastruct/hash"
+	"goredis/datastruct/list"
+	"goredis/datastruct/set"
+	"goredis/datastruct/zset"
+	"goredis/interface/database"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoundTrip(t *testing.T) {
+	bigList := list.New(0)
+	for i := 0; i < 1000; i++ {
+		bigList.PushBack([]byte(strconv.Itoa(i)))
+	}
+	smallHash := hash.NewHash(0)
+	smallHash.Set("f", "v")
+	smallHash.Set("empty", "")
+	expireAt := time.Now().Add(time.Hour).UnixMilli()
+	ttlHash := hash.NewHash(0)
+	ttlHash.Set("f1", "v1")
+	ttlHash.Set("f2", "v2")
+	ttlHash.SetExpire("f2", expireAt)
+	ints := set.NewHashSetFrom(set.Limits{}, []string{"1", "-5", "9223372036854775807"})
+	strs := set.NewHashSetFrom(set.Limits{}, []string{"a", "1", strings.Repeat("b", 100)})
+	scores := zset.NewZSet(0)
+	scores.Add("a", 1.5)
+	scores.Add("b", math.Inf(-1))
+	scores.Add("c", math.Copysign(0, -1))
+
+	tests := []struct {
+		name string
+		data interface{}
+		// check compares the restored value with the original one
+		check func(t *testing.T, restored interface{})
+	}{
+		{name: "string", data: []byte("hello"), check: func(t *testing.T, restored interface{}) {
+			if string(restored.([]byte)) != "hello" {
+				t.Errorf("restored %q", restored)
+			}
+		}},
+		{name: "empty string", data: []byte{}, check: func(t *testing.T, restored interface{}) {
+			if len(restored.([]byte)) != 0 {
+				t.Errorf("restored %q", restored)
+			}
+		}},
+		{name: "integer", data: int64(-42), check: func(t *testing.T, restored interface{}) {
+			if restored != int64(-42) {
+				t.Errorf("restored %v", restored)
+			}
+		}},
+		{name: "list", data: bigList, check: func(t *testing.T, restored interface{}) {
+			if !slices.EqualFunc(restored.(*list.QuickList).Range(0, -1), bigList.Range(0, -1), slices.Equal) {
+				t.Error("restored list differs")
+			}
+		}},
+		{name: "hash", data: smallHash, check: func(t *testing.T, restored interface{}) {
+			if !maps.Equal(restored.(*hash.Hash).GetAll(), smallHash.GetAll()) {
+				t.Errorf("restored %v", restored.(*hash.Hash).GetAll())
+			}
+		}},
+		{name: "hash with ttl", data: ttlHash, check: func(t *testing.T, restored interface{}) {
+			h := restored.(*hash.Hash)
+			if !maps.Equal(h.GetAll(), ttlHash.GetAll()) {
+				t.Errorf("restored %v", h.GetAll())
+			}
+			if at, ok := h.ExpireTime("f2"); !ok || at != expireAt {
+				t.Errorf("expire time of f2 is %d, %v", at, ok)
+			}
+			if _, ok := h.ExpireTime("f1"); ok {
+				t.Error("f1 got an expire time")
+			}
+		}},
+		{name: "intset", data: ints, check: func(t *testing.T, restored interface{}) {
+			s := restored.(*set.HashSet)
+			if s.ObjectEncoding() != "intset" || !sameMembers(s.Members(), ints.Members()) {
+				t.Errorf("restored %v as %s", s.Members(), s.ObjectEncoding())
+			}
+		}},
+		{name: "set", data: strs, check: func(t *testing.T, restored interface{}) {
+			s := restored.(*set.HashSet)
+			if s.ObjectEncoding() != strs.ObjectEncoding() || !sameMembers(s.Members(), strs.Members()) {
+				t.Errorf("restored %v as %s", s.Members(), s.ObjectEncoding())
+			}
+		}},
+		{name: "zset", data: scores, check: func(t *testing.T, restored interface{}) {
+			z := restored.(zset.ZSet)
+			if !slices.Equal(z.RangeByRank(0, -1), scores.RangeByRank(0, -1)) {
+				t.Errorf("restored %v", z.RangeByRank(0, -1))
+			}
+			if score, _ := z.Score("c"); !math.Signbit(score) {
+				t.Error("the sign of -0 is lost")
+			}
+		}},
+	}
+	for _, tt := range tests {
+		payload, err := Marshal(&database.DataEntity{Data: tt.data})
+		if err != nil {
+			t.Errorf("%s: Marshal: %v", tt.name, err)
+			continue
+		}
+		entity, err := Unmarshal(payload)
+		if err != nil {
+			t.Errorf("%s: Unmarshal: %v", tt.name, err)
+			continue
+		}
+		t.Run(tt.name, func(t *testing.T) {
+			tt.check(t, entity.Data)
+		})
+	}
+}
+
+func sameMembers(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
+
+func TestBadPayload(t *testing.T) {
+	payload, err := Marshal(&database.DataEntity{Data: []byte("hello")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt := func(change func(p []byte) []byte) []byte {
+		return change(slices.Clone(payload))
+	}
+	tests := []struct {
+		name    string
+		payload []byte
+	}{
+		{name: "empty", payload: []byte{}},
+		{name: "footer only", payload: payload[len(payload)-footerSize:]},
+		{name: "truncated", payload: payload[1:]},
+		{name: "flipped body byte", payload: corrupt(func(p []byte) []byte { p[2] ^= 1; return p })},
+		{name: "flipped checksum byte", payload: corrupt(func(p []byte) []byte { p[len(p)-1] ^= 1; return p })},
+		{name: "newer version", payload: corrupt(func(p []byte) []byte { p[len(p)-footerSize]++; return p })},
+		{name: "trailing byte", payload: append(slices.Clone(payload), 0)},
+	}
+	for _, tt := range tests {
+		if _, err := Unmarshal(tt.payload); err != ErrBadPayload {
+			t.Errorf("%s: Unmarshal error = %v, want %v", tt.name, err, ErrBadPayload)
+		}
+	}
+}
@@ -1,7 +1,12 @@
 package database
 
 import (
+	"bytes"
 	"goredis/interface/resp"
+	"math/rand"
+	"strconv"
+	"sync/atomic"
+	"time"
 )
 
 type Database interface {
@@ -10,7 +15,114 @@ type Database interface {
 	Close()
 }
 
+// BlockedReply is returned by Exec when a blocking command has to wait,
+// the connection is parked until Wait returns the real reply of the command
+type BlockedReply interface {
+	resp.Reply
+	Wait() resp.Reply
+}
+
+// Encodable is implemented by the data structures with more than one internal encoding,
+// ObjectEncoding returns the name reported by OBJECT ENCODING
+type Encodable interface {
+	ObjectEncoding() string
+}
+
 // used to store the data entity
 type DataEntity struct {
 	Data interface{}
+
+	// access metadata used by the eviction policies, it is updated atomically
+	// because commands that only read a key share its lock
+	accessTime int64  // unix nano of the last access, 0 if never accessed
+	counter    uint32 // logarithmic access counter used by LFU
+}
+
+// MakeStringEntity makes the entity of a string value. A value in the canonical decimal form
+// of an int64 is stored as the int64 itself (the int encoding), which takes less memory.
+// Other values are copied, so writes like SETBIT which modify a value in place never change a command line.
+func MakeStringEntity(value []byte) *DataEntity {
+	if n, ok := ParseInteger(value); ok {
+		return &DataEntity{Data: n}
+	}
+	return &DataEntity{Data: bytes.Clone(value)}
+}
+
+// ParseInteger parses a value in the canonical decimal form of an int64,
+// values with a sign '+', leading zeros or spaces are not integers
+func ParseInteger(value []byte) (int64, bool) {
+	if len(value) == 0 || len(value) > 20 {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil || strconv.FormatInt(n, 10) != string(value) {
+		return 0, false
+	}
+	return n, true
+}
+
+// StringValue returns the value of a string entity, ok is false if the entity holds another type
+func (e *DataEntity) StringValue() ([]byte, bool) {
+	switch val := e.Data.(type) {
+	case []byte:
+		if val == nil {
+			// an empty string is still a value
+			return []byte{}, true
+		}
+		return val, true
+	case int64:
+		return strconv.AppendInt(nil, val, 10), true
+	}
+	return nil, false
+}
+
+const (
+	LFUInitVal   = 5           // LFUInitVal is the counter of a new key, so it is not evicted at once
+	lfuLogFactor = 10          // lfuLogFactor controls how fast the counter saturates
+	lfuDecayTime = time.Minute // the counter is decremented once per lfuDecayTime without access
+)
+
+// Touch records an access to the entity
+func (e *DataEntity) Touch() {
+	now := time.Now()
+	counter := e.decayedCounter(now)
+	if counter < 255 {
+		// the probability of incrementing goes down as the counter goes up
+		base := 0.0
+		if counter > LFUInitVal {
+			base = float64(counter - LFUInitVal)
+		}
+		if rand.Float64() < 1.0/(base*lfuLogFactor+1) {
+			counter++
+		}
+	}
+	atomic.StoreUint32(&e.counter, counter)
+	atomic.StoreInt64(&e.accessTime, now.UnixNano())
+}
+
+// IdleTime returns the time since the last access of the entity
+func (e *DataEntity) IdleTime() time.Duration {
+	accessTime := atomic.LoadInt64(&e.accessTime)
+	if accessTime == 0 {
+		return 0
+	}
+	return time.Since(time.Unix(0, accessTime))
+}
+
+// Frequency returns the LFU counter of the entity, decayed by the time since its last access
+func (e *DataEntity) Frequency() uint8 {
+	return uint8(e.decayedCounter(time.Now()))
+}
+
+func (e *DataEntity) decayedCounter(now time.Time) uint32 {
+	accessTime := atomic.LoadInt64(&e.accessTime)
+	if accessTime == 0 {
+		return LFUInitVal
+	}
+	counter := atomic.LoadUint32(&e.counter)
+	periods := uint32(now.Sub(time.Unix(0, accessTime)) / lfuDecayTime)
+	if periods >= counter {
+		return 0
+	}
+	return counter - periods
 }
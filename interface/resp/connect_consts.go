@@ -5,6 +5,22 @@ type Connection interface {
 	Write(data []byte) error
 	GetDBIndex() int
 	SelectDB(int) error
+
+	// transaction state
+	InMultiState() bool
+	SetMultiState(bool)
+	GetQueuedCmdLine() [][][]byte
+	EnqueueCmd([][]byte)
+	ClearQueuedCmds()
+	GetWatching() map[WatchedKey]uint32
+	AddTxError(err error)
+	GetTxErrors() []error
+}
+
+// a key watched by WATCH, in the db which was selected when it was watched
+type WatchedKey struct {
+	DBIndex int
+	Key     string
 }
 
 // an interface for reply
@@ -0,0 +1,122 @@
+package cursor
+
+import (
+	"goredis/lib/utils"
+	"math/bits"
+)
+
+// minBuckets is the size of the smallest bucket table
+const minBuckets = 4
+
+// Index implements the cursor contract of HSCAN, SSCAN and ZSCAN on unordered collections.
+// A collection in hash table encoding adds its elements to an Index, which keeps them in
+// buckets by their hash, so that a Scan call only visits the buckets holding about count elements.
+//
+// The cursor is the index of the next bucket in reverse binary order, as Redis does.
+// When the table grows between two calls, the buckets already visited map to buckets that come
+// before the cursor in the larger table, so an element that stays in the collection during a full
+// iteration is returned at least once. It may be returned more than once if the table shrinks.
+type Index struct {
+	buckets [][]string
+	size    int
+}
+
+// NewIndex creates an Index that can hold sizeHint elements without growing
+func NewIndex(sizeHint int) *Index {
+	n := minBuckets
+	for n < sizeHint {
+		n <<= 1
+	}
+	return &Index{buckets: make([][]string, n)}
+}
+
+func (idx *Index) bucketOf(element string) int {
+	return int(utils.Fnv32(element) & uint32(len(idx.buckets)-1))
+}
+
+// Len returns the number of elements
+func (idx *Index) Len() int {
+	return idx.size
+}
+
+// Add adds an element, the caller must make sure it is not in the index yet
+func (idx *Index) Add(element string) {
+	if idx.size >= len(idx.buckets) {
+		idx.resize(len(idx.buckets) * 2)
+	}
+	i := idx.bucketOf(element)
+	idx.buckets[i] = append(idx.buckets[i], element)
+	idx.size++
+}
+
+// Remove removes an element, it does nothing if the element is not in the index
+func (idx *Index) Remove(element string) {
+	i := idx.bucketOf(element)
+	bucket := idx.buckets[i]
+	for j := range bucket {
+		if bucket[j] != element {
+			continue
+		}
+		last := len(bucket) - 1
+		bucket[j] = bucket[last]
+		bucket[last] = ""
+		idx.buckets[i] = bucket[:last]
+		idx.size--
+		if len(idx.buckets) > minBuckets && idx.size < len(idx.buckets)/8 {
+			idx.resize(len(idx.buckets) / 2)
+		}
+		return
+	}
+}
+
+// resize moves all elements to a table of n buckets
+func (idx *Index) resize(n int) {
+	old := idx.buckets
+	idx.buckets = make([][]string, n)
+	for _, bucket := range old {
+		for _, element := range bucket {
+			i := idx.bucketOf(element)
+			idx.buckets[i] = append(idx.buckets[i], element)
+		}
+	}
+}
+
+// Random returns a random element: a random non-empty bucket is chosen, then a random element inside it.
+// Buckets hold at most a few elements, so every element has about the same probability to be picked.
+func (idx *Index) Random(intn func(n int) int) (string, bool) {
+	if idx.size == 0 {
+		return "", false
+	}
+	for {
+		bucket := idx.buckets[intn(len(idx.buckets))]
+		if len(bucket) > 0 {
+			return bucket[intn(len(bucket))], true
+		}
+	}
+}
+
+// Scan returns the elements of the buckets from cursor on until about count elements are collected,
+// and the next cursor, which is 0 when the iteration is complete.
+// Elements of the same bucket are always returned together.
+func (idx *Index) Scan(cursor uint64, count int) ([]string, uint64) {
+	if count <= 0 {
+		count = 1
+	}
+	result := make([]string, 0, count)
+	mask := uint64(len(idx.buckets) - 1)
+	// like Redis, give up after visiting many empty buckets so that a sparse table does not block the caller
+	emptyVisits := count * 10
+	for {
+		bucket := idx.buckets[cursor&mask]
+		if len(bucket) == 0 {
+			emptyVisits--
+		}
+		result = append(result, bucket...)
+		// increment the reversed cursor: set the bits above the mask, reverse, add one, reverse back
+		cursor |= ^mask
+		cursor = bits.Reverse64(bits.Reverse64(cursor) + 1)
+		if cursor == 0 || len(result) >= count || emptyVisits <= 0 {
+			return result, cursor
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package cursor
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+// scanAll runs a full iteration, calling between(i) before the i-th call, and returns how often each element was seen
+func scanAll(t *testing.T, idx *Index, count int, between func(i int)) map[string]int {
+	seen := make(map[string]int)
+	var cur uint64
+	for i := 0; ; i++ {
+		if i > 100000 {
+			t.Fatal("iteration does not terminate")
+		}
+		between(i)
+		elements, next := idx.Scan(cur, count)
+		for _, element := range elements {
+			seen[element]++
+		}
+		if next == 0 {
+			return seen
+		}
+		cur = next
+	}
+}
+
+func TestIndexScan(t *testing.T) {
+	tests := []struct {
+		name    string
+		initial int // elements e0..e(initial-1) stay during the whole iteration
+		extra   int // elements tmp0..tmp(extra-1) are added before the iteration
+		count   int
+		// between changes the index before the i-th call
+		between func(idx *Index, i int)
+		// exactlyOnce is false when the table shrinks, elements may then be returned more than once
+		exactlyOnce bool
+	}{
+		{name: "empty", initial: 0, count: 10, exactlyOnce: true},
+		{name: "single", initial: 1, count: 10, exactlyOnce: true},
+		{name: "count 1", initial: 100, count: 1, exactlyOnce: true},
+		{name: "count 10", initial: 1000, count: 10, exactlyOnce: true},
+		{name: "count larger than size", initial: 50, count: 100, exactlyOnce: true},
+		{
+			name: "grows during iteration", initial: 100, count: 5, exactlyOnce: true,
+			between: func(idx *Index, i int) {
+				for j := 0; j < 20; j++ {
+					idx.Add("new" + strconv.Itoa(i*20+j))
+				}
+			},
+		},
+		{
+			name: "shrinks during iteration", initial: 20, extra: 2000, count: 3,
+			between: func(idx *Index, i int) {
+				if i == 2 {
+					for j := 0; j < 2000; j++ {
+						idx.Remove("tmp" + strconv.Itoa(j))
+					}
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		idx := NewIndex(0)
+		for i := 0; i < tt.initial; i++ {
+			idx.Add("e" + strconv.Itoa(i))
+		}
+		for i := 0; i < tt.extra; i++ {
+			idx.Add("tmp" + strconv.Itoa(i))
+		}
+		seen := scanAll(t, idx, tt.count, func(i int) {
+			if tt.between != nil {
+				tt.between(idx, i)
+			}
+		})
+		for i := 0; i < tt.initial; i++ {
+			n := seen["e"+strconv.Itoa(i)]
+			if n == 0 || (tt.exactlyOnce && n != 1) {
+				t.Errorf("%s: e%d returned %d times", tt.name, i, n)
+			}
+		}
+	}
+}
+
+func TestIndexScanCount(t *testing.T) {
+	idx := NewIndex(0)
+	for i := 0; i < 10000; i++ {
+		idx.Add(strconv.Itoa(i))
+	}
+	// every call visits about count elements, not the whole index
+	elements, next := idx.Scan(0, 10)
+	if len(elements) < 10 || len(elements) > 30 || next == 0 {
+		t.Errorf("Scan(0, 10) returned %d elements, next %d", len(elements), next)
+	}
+}
+
+func TestIndexRemove(t *testing.T) {
+	idx := NewIndex(0)
+	for i := 0; i < 1000; i++ {
+		idx.Add(strconv.Itoa(i))
+	}
+	for i := 0; i < 1000; i += 2 {
+		idx.Remove(strconv.Itoa(i))
+	}
+	idx.Remove("missing")
+	if idx.Len() != 500 {
+		t.Fatalf("Len() = %d, want 500", idx.Len())
+	}
+	seen := scanAll(t, idx, 7, func(int) {})
+	for i := 0; i < 1000; i++ {
+		if want := i % 2; seen[strconv.Itoa(i)] != want {
+			t.Errorf("%d returned %d times, want %d", i, seen[strconv.Itoa(i)], want)
+		}
+	}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		element, ok := idx.Random(r.Intn)
+		if n, _ := strconv.Atoi(element); !ok || n%2 != 1 {
+			t.Errorf("Random() = %q, %v", element, ok)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package lock
+
+import (
+	"goredis/lib/utils"
+	"sort"
+	"sync"
+)
+
+// Locks is a table of read/write locks, every key is mapped to one of them.
+// Keys share locks, so the table stays small no matter how many keys there are.
+// Locks of several keys are always acquired in ascending index order to avoid deadlock.
+type Locks struct {
+	table []*sync.RWMutex
+}
+
+// Make creates a lock table, the size is rounded up to a power of two
+func Make(tableSize int) *Locks {
+	size := 1
+	for size < tableSize {
+		size <<= 1
+	}
+	table := make([]*sync.RWMutex, size)
+	for i := range table {
+		table[i] = &sync.RWMutex{}
+	}
+	return &Locks{
+		table: table,
+	}
+}
+
+func (locks *Locks) spread(hashCode uint32) uint32 {
+	return hashCode & uint32(len(locks.table)-1)
+}
+
+// Lock acquires the write lock of the key
+func (locks *Locks) Lock(key string) {
+	locks.table[locks.spread(utils.Fnv32(key))].Lock()
+}
+
+// UnLock releases the write lock of the key
+func (locks *Locks) UnLock(key string) {
+	locks.table[locks.spread(utils.Fnv32(key))].Unlock()
+}
+
+// toLockIndices returns the distinct lock indices of the keys in ascending order,
+// and the set of indices that must be locked for writing
+func (locks *Locks) toLockIndices(writeKeys []string, readKeys []string) ([]uint32, map[uint32]struct{}) {
+	indexSet := make(map[uint32]struct{})
+	writeIndexSet := make(map[uint32]struct{})
+	for _, key := range writeKeys {
+		index := locks.spread(utils.Fnv32(key))
+		indexSet[index] = struct{}{}
+		writeIndexSet[index] = struct{}{}
+	}
+	for _, key := range readKeys {
+		indexSet[locks.spread(utils.Fnv32(key))] = struct{}{}
+	}
+	indices := make([]uint32, 0, len(indexSet))
+	for index := range indexSet {
+		indices = append(indices, index)
+	}
+	sort.Slice(indices, func(i, j int) bool {
+		return indices[i] < indices[j]
+	})
+	return indices, writeIndexSet
+}
+
+// RWLocks acquires write locks of writeKeys and read locks of readKeys,
+// a key in both lists is locked for writing
+func (locks *Locks) RWLocks(writeKeys []string, readKeys []string) {
+	indices, writeIndexSet := locks.toLockIndices(writeKeys, readKeys)
+	for _, index := range indices {
+		mu := locks.table[index]
+		if _, ok := writeIndexSet[index]; ok {
+			mu.Lock()
+		} else {
+			mu.RLock()
+		}
+	}
+}
+
+// RWUnLocks releases the locks acquired by RWLocks with the same arguments
+func (locks *Locks) RWUnLocks(writeKeys []string, readKeys []string) {
+	indices, writeIndexSet := locks.toLockIndices(writeKeys, readKeys)
+	for i := len(indices) - 1; i >= 0; i-- {
+		index := indices[i]
+		mu := locks.table[index]
+		if _, ok := writeIndexSet[index]; ok {
+			mu.Unlock()
+		} else {
+			mu.RUnlock()
+		}
+	}
+}
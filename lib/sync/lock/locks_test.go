@@ -0,0 +1,111 @@
+package lock
+
+import (
+	"goredis/lib/utils"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestToLockIndices(t *testing.T) {
+	locks := Make(8)
+	index := func(key string) uint32 {
+		return utils.Fnv32(key) & 7
+	}
+	tests := []struct {
+		name       string
+		writeKeys  []string
+		readKeys   []string
+		wantWrites []string // keys whose lock must be a write lock
+	}{
+		{name: "none"},
+		{name: "write only", writeKeys: []string{"a", "b", "c"}, wantWrites: []string{"a", "b", "c"}},
+		{name: "read only", readKeys: []string{"a", "b", "c"}},
+		{name: "mixed", writeKeys: []string{"a"}, readKeys: []string{"b", "c"}, wantWrites: []string{"a"}},
+		{name: "key read and written", writeKeys: []string{"a"}, readKeys: []string{"a", "b"}, wantWrites: []string{"a"}},
+		{name: "duplicate keys", writeKeys: []string{"a", "a"}, readKeys: []string{"b", "b"}, wantWrites: []string{"a"}},
+	}
+	for _, tt := range tests {
+		indices, writeIndexSet := locks.toLockIndices(tt.writeKeys, tt.readKeys)
+		if !slices.IsSorted(indices) || len(slices.Compact(slices.Clone(indices))) != len(indices) {
+			t.Errorf("%s: indices %v are not distinct and ascending", tt.name, indices)
+		}
+		for _, key := range append(slices.Clone(tt.writeKeys), tt.readKeys...) {
+			if !slices.Contains(indices, index(key)) {
+				t.Errorf("%s: lock of %q is missing", tt.name, key)
+			}
+		}
+		for _, key := range tt.wantWrites {
+			if _, ok := writeIndexSet[index(key)]; !ok {
+				t.Errorf("%s: lock of %q is not a write lock", tt.name, key)
+			}
+		}
+		for _, key := range tt.readKeys {
+			_, isWrite := writeIndexSet[index(key)]
+			if isWrite && !slices.ContainsFunc(tt.writeKeys, func(w string) bool { return index(w) == index(key) }) {
+				t.Errorf("%s: lock of read key %q is a write lock", tt.name, key)
+			}
+		}
+	}
+}
+
+// TestRWLocksOrdering locks the same keys in opposite orders from many goroutines,
+// which deadlocks unless the locks are always acquired in the same order
+func TestRWLocksOrdering(t *testing.T) {
+	locks := Make(16)
+	keys := make([]string, 8)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	reversed := slices.Clone(keys)
+	slices.Reverse(reversed)
+
+	done := make(chan struct{})
+	go func() {
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < 1000; i++ {
+					writeKeys, readKeys := keys[:4], reversed[:4]
+					if g%2 == 1 {
+						writeKeys, readKeys = reversed, keys[2:6]
+					}
+					locks.RWLocks(writeKeys, readKeys)
+					locks.RWUnLocks(writeKeys, readKeys)
+				}
+			}(g)
+		}
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("deadlock")
+	}
+}
+
+func TestRWLocksExclusion(t *testing.T) {
+	locks := Make(16)
+	counter := 0
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				locks.RWLocks([]string{"counter"}, []string{"other"})
+				counter++
+				locks.RWUnLocks([]string{"counter"}, []string{"other"})
+			}
+		}()
+	}
+	wg.Wait()
+	if counter != 8000 {
+		t.Errorf("counter = %d, want 8000", counter)
+	}
+}
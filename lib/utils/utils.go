@@ -18,3 +18,13 @@ func ToCmdLineWithName(name string, args ...[]byte) [][]byte {
 	}
 	return cmd
 }
+
+// Fnv32 computes the FNV-1a hash of the key
+func Fnv32(key string) uint32 {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= uint32(16777619)
+	}
+	return hash
+}